@@ -6,6 +6,8 @@
 package config
 
 import (
+	"strings"
+
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/configuration"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
 	log "github.com/sirupsen/logrus"
@@ -17,6 +19,36 @@ type (
 		DbHost, DbPort, DbUser, DbPass, DbSSLMode, DbName string
 		TelemetryEndpoint, TelemetryDataStoreName         string
 		ResponseLimit                                     int
+		DeadLetterMaxAttempts                             int
+		DeadLetterRetryIntervalSeconds                    int
+		DeadLetterBackoffSeconds                          int
+		DeadLetterMaxBackoffSeconds                       int
+		EdgexDeviceNames, EdgexValueDescriptors           []string
+		EdgexIngestionRules                               map[string]map[string]string
+		IngestionSource                                   string
+		MqttBroker, MqttTopic, MqttClientID               string
+		MqttUsername, MqttPassword                        string
+		MqttCAFile, MqttCertFile, MqttKeyFile             string
+		MqttQoS                                           int
+		DropFolder                                        string
+		DropFolderIntervalSeconds                         int
+		DropFolderSettleSeconds                           int
+		IdempotencyWindowSeconds                          int
+		IdempotencyLeaseSeconds                           int
+		IngestionWorkers, IngestionQueueDepth             int
+		IngestionBatchSize                                int
+		IngestionEnqueueTimeoutSeconds                    int
+		AuthAPIKeys                                       []string
+		AuthJwtSecret, AuthJwksFile                       string
+		AuthJwtIssuer, AuthJwtAudience                    string
+		TLSCertFile, TLSKeyFile, TLSClientCAFile          string
+		TLSReloadIntervalSeconds                          int
+		RateLimits                                        map[string]map[string]string
+		RequestBodyLimits                                 map[string]int64
+		ProductCacheSize, ProductCacheTTLSeconds          int
+		QueryTimeoutSeconds, MaxFilterComplexity          int
+		ViewRefreshIntervalSeconds                        int
+		APIDeprecations                                   map[string]map[string]string
 	}
 )
 
@@ -74,6 +106,271 @@ func InitConfig() error {
 	AppConfig.TelemetryDataStoreName, err = config.GetString("telemetryDataStoreName")
 	errorHandler(err)
 
+	// Number of ingestion attempts of a failed event before it is parked in the dead-letter store
+	AppConfig.DeadLetterMaxAttempts, err = config.GetInt("deadLetterMaxAttempts")
+	if err != nil {
+		AppConfig.DeadLetterMaxAttempts = 10
+	}
+
+	// How often the dead-letter store is checked for events due for a retry
+	AppConfig.DeadLetterRetryIntervalSeconds, err = config.GetInt("deadLetterRetryIntervalSeconds")
+	if err != nil || AppConfig.DeadLetterRetryIntervalSeconds < 1 {
+		AppConfig.DeadLetterRetryIntervalSeconds = 30
+	}
+
+	// Delay before the first retry of a failed event, doubled on every following attempt
+	AppConfig.DeadLetterBackoffSeconds, err = config.GetInt("deadLetterBackoffSeconds")
+	if err != nil {
+		AppConfig.DeadLetterBackoffSeconds = 60
+	}
+
+	AppConfig.DeadLetterMaxBackoffSeconds, err = config.GetInt("deadLetterMaxBackoffSeconds")
+	if err != nil {
+		AppConfig.DeadLetterMaxBackoffSeconds = 3600
+	}
+
+	// EdgeX devices sending product data
+	AppConfig.EdgexDeviceNames, err = config.GetStringSlice("edgexDeviceNames")
+	if err != nil || len(AppConfig.EdgexDeviceNames) == 0 {
+		AppConfig.EdgexDeviceNames = []string{"SKU_Data_Device"}
+	}
+
+	// Readings of the devices to ingest, all of them if empty
+	AppConfig.EdgexValueDescriptors, err = config.GetStringSlice("edgexValueDescriptors")
+	if err != nil {
+		AppConfig.EdgexValueDescriptors = []string{}
+	}
+
+	// Ingestion mode and payload format per "device" or "device/valueDescriptor"
+	AppConfig.EdgexIngestionRules, err = config.GetNestedMapOfMapString("edgexIngestionRules")
+	if err != nil {
+		AppConfig.EdgexIngestionRules = map[string]map[string]string{}
+	}
+
+	// Where product data is received from, "edgex" or "mqtt"
+	AppConfig.IngestionSource, err = config.GetString("ingestionSource")
+	if err != nil || AppConfig.IngestionSource == "" {
+		AppConfig.IngestionSource = "edgex"
+	}
+
+	// MQTT broker and topic used when the ingestion source is "mqtt"
+	AppConfig.MqttBroker, err = config.GetString("mqttBroker")
+	if err != nil || AppConfig.MqttBroker == "" {
+		AppConfig.MqttBroker = "tcp://localhost:1883"
+	}
+
+	AppConfig.MqttTopic, err = config.GetString("mqttTopic")
+	if err != nil || AppConfig.MqttTopic == "" {
+		AppConfig.MqttTopic = "product-data"
+	}
+
+	AppConfig.MqttQoS, err = config.GetInt("mqttQoS")
+	if err != nil {
+		AppConfig.MqttQoS = 1
+	}
+
+	AppConfig.MqttClientID, err = config.GetString("mqttClientId")
+	if err != nil || AppConfig.MqttClientID == "" {
+		AppConfig.MqttClientID = "product-data-service"
+	}
+
+	AppConfig.MqttUsername, err = config.GetString("mqttUsername")
+	if err != nil {
+		AppConfig.MqttUsername = ""
+	}
+
+	AppConfig.MqttPassword, err = helper.GetSecret("mqttPassword")
+	if err != nil {
+		AppConfig.MqttPassword, err = config.GetString("mqttPassword")
+		if err != nil {
+			AppConfig.MqttPassword = ""
+		}
+	}
+
+	// TLS is used with an "ssl://" or "tls://" broker, client certificates enable mutual TLS
+	AppConfig.MqttCAFile, err = config.GetString("mqttCAFile")
+	if err != nil {
+		AppConfig.MqttCAFile = ""
+	}
+
+	AppConfig.MqttCertFile, err = config.GetString("mqttCertFile")
+	if err != nil {
+		AppConfig.MqttCertFile = ""
+	}
+
+	AppConfig.MqttKeyFile, err = config.GetString("mqttKeyFile")
+	if err != nil {
+		AppConfig.MqttKeyFile = ""
+	}
+
+	// Folder watched for product data files, disabled if empty
+	AppConfig.DropFolder, err = config.GetString("dropFolder")
+	if err != nil {
+		AppConfig.DropFolder = ""
+	}
+
+	AppConfig.DropFolderIntervalSeconds, err = config.GetInt("dropFolderIntervalSeconds")
+	if err != nil || AppConfig.DropFolderIntervalSeconds < 1 {
+		AppConfig.DropFolderIntervalSeconds = 10
+	}
+
+	// Files are imported once left untouched for this long, so that partial writes are not picked up
+	AppConfig.DropFolderSettleSeconds, err = config.GetInt("dropFolderSettleSeconds")
+	if err != nil {
+		AppConfig.DropFolderSettleSeconds = 30
+	}
+
+	// How long the responses of requests and events sent with an idempotency key are kept
+	AppConfig.IdempotencyWindowSeconds, err = config.GetInt("idempotencyWindowSeconds")
+	if err != nil {
+		AppConfig.IdempotencyWindowSeconds = 86400
+	}
+
+	// How long a request or event can be processed before its idempotency key is considered abandoned
+	AppConfig.IdempotencyLeaseSeconds, err = config.GetInt("idempotencyLeaseSeconds")
+	if err != nil || AppConfig.IdempotencyLeaseSeconds < 1 {
+		AppConfig.IdempotencyLeaseSeconds = 300
+	}
+
+	// Number of EdgeX payloads stored concurrently, each one using a database connection
+	AppConfig.IngestionWorkers, err = config.GetInt("ingestionWorkers")
+	if err != nil || AppConfig.IngestionWorkers < 1 {
+		AppConfig.IngestionWorkers = 2
+	}
+
+	// Number of decoded payloads waiting for a worker before the EdgeX pipeline is blocked
+	AppConfig.IngestionQueueDepth, err = config.GetInt("ingestionQueueDepth")
+	if err != nil {
+		AppConfig.IngestionQueueDepth = 100
+	}
+
+	// Number of SKUs above which waiting payloads are no longer combined into one insert
+	AppConfig.IngestionBatchSize, err = config.GetInt("ingestionBatchSize")
+	if err != nil {
+		AppConfig.IngestionBatchSize = 500
+	}
+
+	// How long the EdgeX pipeline waits for room in a full queue before the reading is dead-lettered, 0 not waiting
+	AppConfig.IngestionEnqueueTimeoutSeconds, err = config.GetInt("ingestionEnqueueTimeoutSeconds")
+	if err != nil {
+		AppConfig.IngestionEnqueueTimeoutSeconds = 5
+	}
+
+	// Static API keys, one per line in the authApiKeys secret, each followed by the scopes it grants.
+	// The REST API is not authenticated when no API key, JWT secret or JWKS file is configured.
+	apiKeys, err := helper.GetSecret("authApiKeys")
+	if err == nil {
+		AppConfig.AuthAPIKeys = strings.Split(apiKeys, "\n")
+	} else {
+		AppConfig.AuthAPIKeys, err = config.GetStringSlice("authApiKeys")
+		if err != nil {
+			AppConfig.AuthAPIKeys = []string{}
+		}
+	}
+
+	// Shared secret of HS256/HS384/HS512 bearer tokens
+	AppConfig.AuthJwtSecret, err = helper.GetSecret("authJwtSecret")
+	if err != nil {
+		AppConfig.AuthJwtSecret, err = config.GetString("authJwtSecret")
+		if err != nil {
+			AppConfig.AuthJwtSecret = ""
+		}
+	}
+
+	// JSON Web Key Set of the identity provider signing RSA and ECDSA bearer tokens
+	AppConfig.AuthJwksFile, err = config.GetString("authJwksFile")
+	if err != nil {
+		AppConfig.AuthJwksFile = ""
+	}
+
+	AppConfig.AuthJwtIssuer, err = config.GetString("authJwtIssuer")
+	if err != nil {
+		AppConfig.AuthJwtIssuer = ""
+	}
+
+	AppConfig.AuthJwtAudience, err = config.GetString("authJwtAudience")
+	if err != nil {
+		AppConfig.AuthJwtAudience = ""
+	}
+
+	// Certificate and key of the REST API, served over plain HTTP if not set
+	AppConfig.TLSCertFile, err = config.GetString("tlsCertFile")
+	if err != nil {
+		AppConfig.TLSCertFile = ""
+	}
+
+	AppConfig.TLSKeyFile, err = config.GetString("tlsKeyFile")
+	if err != nil {
+		AppConfig.TLSKeyFile = ""
+	}
+
+	// CA bundle verifying the certificates that clients must present, for mutual TLS
+	AppConfig.TLSClientCAFile, err = config.GetString("tlsClientCAFile")
+	if err != nil {
+		AppConfig.TLSClientCAFile = ""
+	}
+
+	// How often the certificate, key and CA bundle are checked for renewal
+	AppConfig.TLSReloadIntervalSeconds, err = config.GetInt("tlsReloadIntervalSeconds")
+	if err != nil || AppConfig.TLSReloadIntervalSeconds < 1 {
+		AppConfig.TLSReloadIntervalSeconds = 60
+	}
+
+	// Requests per second and burst allowed to each client per route group, groups not listed are not limited
+	AppConfig.RateLimits, err = config.GetNestedMapOfMapString("rateLimits")
+	if err != nil {
+		AppConfig.RateLimits = map[string]map[string]string{}
+	}
+
+	// Size limit in bytes of request bodies per route name, "default" applying to the routes not listed
+	AppConfig.RequestBodyLimits = map[string]int64{}
+	bodyLimits, err := config.GetNestedJSON("requestBodyLimits")
+	if err == nil {
+		for route, limit := range bodyLimits {
+			if bytes, ok := limit.(float64); ok && bytes > 0 {
+				AppConfig.RequestBodyLimits[route] = int64(bytes)
+			}
+		}
+	}
+
+	// Number of product ID lookups kept in memory, 0 disabling the cache
+	AppConfig.ProductCacheSize, err = config.GetInt("productCacheSize")
+	if err != nil || AppConfig.ProductCacheSize < 0 {
+		AppConfig.ProductCacheSize = 10000
+	}
+
+	// How long a cached product ID lookup is served before being read again, bounding the staleness
+	// of lookups on instances that did not process the write themselves
+	AppConfig.ProductCacheTTLSeconds, err = config.GetInt("productCacheTTLSeconds")
+	if err != nil || AppConfig.ProductCacheTTLSeconds < 1 {
+		AppConfig.ProductCacheTTLSeconds = 60
+	}
+
+	// How long a query of the REST API can run before being cancelled, 0 leaving it unbounded
+	AppConfig.QueryTimeoutSeconds, err = config.GetInt("queryTimeoutSeconds")
+	if err != nil || AppConfig.QueryTimeoutSeconds < 0 {
+		AppConfig.QueryTimeoutSeconds = 30
+	}
+
+	// Complexity allowed in OData filters, each condition and operator counting for 1 and those
+	// within lambdas counting twice per level of nesting, 0 leaving it unbounded
+	AppConfig.MaxFilterComplexity, err = config.GetInt("maxFilterComplexity")
+	if err != nil || AppConfig.MaxFilterComplexity < 0 {
+		AppConfig.MaxFilterComplexity = 50
+	}
+
+	// How often the materialized views of the saved views are refreshed when the SKUs changed
+	AppConfig.ViewRefreshIntervalSeconds, err = config.GetInt("viewRefreshIntervalSeconds")
+	if err != nil || AppConfig.ViewRefreshIntervalSeconds < 1 {
+		AppConfig.ViewRefreshIntervalSeconds = 60
+	}
+
+	// Deprecation date, and optionally sunset date and documentation link, of each deprecated API version
+	AppConfig.APIDeprecations, err = config.GetNestedMapOfMapString("apiDeprecations")
+	if err != nil {
+		AppConfig.APIDeprecations = map[string]map[string]string{}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,312 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package deadletter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+const deadLetterTable = "dead_letters"
+
+// columns in the order they are scanned into a Letter
+const letterColumns = "id, source, device, value_descriptor, payload, error, attempts, status, created, last_attempt, next_attempt"
+
+// summaryColumns are scanned like letterColumns but leave the payload out
+const summaryColumns = "id, source, device, value_descriptor, ''::bytea, error, attempts, status, created, last_attempt, next_attempt"
+
+// retryBatchSize is the maximum number of letters claimed on each retry pass
+const retryBatchSize = 50
+
+// Processor ingests the payload of a letter again
+type Processor func(letter Letter) error
+
+// Store persists events that failed ingestion and retries them with backoff
+type Store struct {
+	db      *sql.DB
+	process Processor
+	policy  RetryPolicy
+}
+
+// NewStore creates a dead-letter store replaying letters through process
+func NewStore(db *sql.DB, process Processor, policy RetryPolicy) *Store {
+	return &Store{db: db, process: process, policy: policy}
+}
+
+// Add records a failed event, scheduling its first retry
+func (store *Store) Add(letter Letter) error {
+
+	// Metrics
+	mAdded := metrics.GetOrRegisterGauge(`Product-Data.DeadLetter.Added`, nil)
+	mAddErr := metrics.GetOrRegisterGauge(`Product-Data.DeadLetter.Add-Error`, nil)
+
+	insertQuery := fmt.Sprintf(`INSERT INTO %s (source, device, value_descriptor, payload, error, attempts, status, next_attempt)
+								VALUES ($1, $2, $3, $4, $5, 1, $6, $7)`,
+		pq.QuoteIdentifier(deadLetterTable),
+	)
+
+	status, nextAttempt := store.schedule(1)
+
+	_, err := store.db.Exec(insertQuery,
+		letter.Source,
+		letter.Device,
+		letter.ValueDescriptor,
+		letter.Payload,
+		letter.Error,
+		status,
+		nextAttempt,
+	)
+	if err != nil {
+		mAddErr.Update(1)
+		return err
+	}
+
+	mAdded.Update(1)
+	return nil
+}
+
+// List returns the letters with the given status, or all of them if status is empty,
+// oldest first and without their payload
+func (store *Store) List(status string, limit int) ([]Letter, error) {
+
+	listQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE ($1 = '' OR status = $1) ORDER BY created LIMIT $2`,
+		summaryColumns,
+		pq.QuoteIdentifier(deadLetterTable),
+	)
+
+	rows, err := store.db.Query(listQuery, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := make([]Letter, 0)
+	for rows.Next() {
+		letter, err := scanLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letter.Payload = nil
+		letters = append(letters, letter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return letters, nil
+}
+
+// Get returns a letter with its payload
+func (store *Store) Get(id string) (Letter, error) {
+
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE id = $1`,
+		letterColumns,
+		pq.QuoteIdentifier(deadLetterTable),
+	)
+
+	letter, err := scanLetter(store.db.QueryRow(selectQuery, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Letter{}, web.NotFoundError()
+		}
+		return Letter{}, err
+	}
+
+	return letter, nil
+}
+
+// Replay ingests a letter again regardless of its status or schedule.
+// The letter is removed when it succeeds, otherwise the attempt is recorded and the error returned.
+func (store *Store) Replay(id string) error {
+
+	letter, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+
+	return store.attempt(letter)
+}
+
+// Discard removes a letter without replaying it
+func (store *Store) Discard(id string) error {
+
+	deleteQuery := fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, pq.QuoteIdentifier(deadLetterTable))
+
+	result, err := store.db.Exec(deleteQuery, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return web.NotFoundError()
+	}
+
+	metrics.GetOrRegisterGauge(`Product-Data.DeadLetter.Discarded`, nil).Update(1)
+	return nil
+}
+
+// RetryDue replays the pending letters whose retry is due and returns how many succeeded
+func (store *Store) RetryDue() (int, error) {
+
+	// Claim due letters by pushing back their next attempt, so that other instances
+	// or a slow pass do not pick them up at the same time
+	claimQuery := fmt.Sprintf(`UPDATE %s SET next_attempt = now() + $1 * interval '1 second'
+								WHERE id IN (
+									SELECT id FROM %s
+									WHERE status = $2 AND next_attempt <= now()
+									ORDER BY next_attempt
+									LIMIT $3
+									FOR UPDATE SKIP LOCKED)
+								RETURNING %s`,
+		pq.QuoteIdentifier(deadLetterTable),
+		pq.QuoteIdentifier(deadLetterTable),
+		letterColumns,
+	)
+
+	rows, err := store.db.Query(claimQuery, store.policy.MaxBackoff.Seconds(), StatusPending, retryBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var letters []Letter
+	for rows.Next() {
+		letter, err := scanLetter(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		letters = append(letters, letter)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, letter := range letters {
+		if err := store.attempt(letter); err != nil {
+			log.WithFields(log.Fields{
+				"Method":   "deadletter.RetryDue",
+				"Action":   "Retry dead letter",
+				"ID":       letter.ID,
+				"Attempts": letter.Attempts + 1,
+				"Error":    err.Error(),
+			}).Warn("dead letter retry failed")
+			continue
+		}
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+// Run retries due letters every policy interval until the context is done
+func (store *Store) Run(ctx context.Context) {
+
+	ticker := time.NewTicker(store.policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := store.RetryDue(); err != nil {
+				log.WithFields(log.Fields{
+					"Method": "deadletter.Run",
+					"Action": "Retry dead letters",
+					"Error":  err.Error(),
+				}).Error("unable to retry dead letters")
+			}
+		}
+	}
+}
+
+// attempt processes a letter, deleting it on success or recording the failure
+func (store *Store) attempt(letter Letter) error {
+
+	// Metrics
+	mReplayed := metrics.GetOrRegisterGauge(`Product-Data.DeadLetter.Replayed`, nil)
+	mReplayErr := metrics.GetOrRegisterGauge(`Product-Data.DeadLetter.Replay-Error`, nil)
+
+	processErr := store.process(letter)
+	if processErr == nil {
+		deleteQuery := fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, pq.QuoteIdentifier(deadLetterTable))
+		if _, err := store.db.Exec(deleteQuery, letter.ID); err != nil {
+			return err
+		}
+		mReplayed.Update(1)
+		return nil
+	}
+
+	mReplayErr.Update(1)
+
+	attempts := letter.Attempts + 1
+	status, nextAttempt := store.schedule(attempts)
+
+	updateQuery := fmt.Sprintf(`UPDATE %s SET attempts = $1, status = $2, error = $3, last_attempt = now(), next_attempt = $4
+								WHERE id = $5`,
+		pq.QuoteIdentifier(deadLetterTable),
+	)
+
+	if _, err := store.db.Exec(updateQuery, attempts, status, processErr.Error(), nextAttempt, letter.ID); err != nil {
+		return err
+	}
+
+	return processErr
+}
+
+// schedule returns the status and next attempt of a letter after the given number of attempts
+func (store *Store) schedule(attempts int) (string, *time.Time) {
+	if store.policy.exhausted(attempts) {
+		return StatusFailed, nil
+	}
+	next := time.Now().Add(store.policy.backoff(attempts))
+	return StatusPending, &next
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLetter(row scanner) (Letter, error) {
+	var letter Letter
+	var nextAttempt pq.NullTime
+
+	err := row.Scan(
+		&letter.ID,
+		&letter.Source,
+		&letter.Device,
+		&letter.ValueDescriptor,
+		&letter.Payload,
+		&letter.Error,
+		&letter.Attempts,
+		&letter.Status,
+		&letter.Created,
+		&letter.LastAttempt,
+		&nextAttempt,
+	)
+	if err != nil {
+		return Letter{}, err
+	}
+
+	if nextAttempt.Valid {
+		letter.NextAttempt = &nextAttempt.Time
+	}
+
+	return letter, nil
+}
@@ -0,0 +1,182 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package deadletter
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+func TestMain(m *testing.M) {
+
+	if err := config.InitConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+
+}
+
+var testPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     time.Second,
+	Interval:       time.Second,
+}
+
+func TestBackoff(t *testing.T) {
+
+	policy := RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     10 * time.Minute,
+	}
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+
+	for i, delay := range expected {
+		if actual := policy.backoff(i + 1); actual != delay {
+			t.Errorf("Backoff after %d attempts expected: %v, received: %v", i+1, delay, actual)
+		}
+	}
+
+	if policy.exhausted(9) || !policy.exhausted(10) {
+		t.Error("Expected letters to be exhausted after 10 attempts")
+	}
+}
+
+func TestRetryDue(t *testing.T) {
+
+	db := dbSetup(t)
+	cleanDeadLetters(db, t)
+
+	processed := 0
+	store := NewStore(db, func(letter Letter) error {
+		processed++
+		if string(letter.Payload) == "bad" {
+			return errors.New("still failing")
+		}
+		return nil
+	}, testPolicy)
+
+	for _, payload := range []string{"good", "bad"} {
+		if err := store.Add(Letter{Source: "test", Device: "SKU_Data_Device", Payload: []byte(payload), Error: "failed"}); err != nil {
+			t.Fatalf("Unable to add dead letter: %+v", err)
+		}
+	}
+
+	// Wait for the first retry to be due
+	time.Sleep(10 * time.Millisecond)
+
+	replayed, err := store.RetryDue()
+	if err != nil {
+		t.Fatalf("Unable to retry dead letters: %+v", err)
+	}
+
+	if replayed != 1 || processed != 2 {
+		t.Errorf("Expected 1 of 2 letters to be replayed, got %d of %d", replayed, processed)
+	}
+
+	letters, err := store.List("", 10)
+	if err != nil {
+		t.Fatalf("Unable to list dead letters: %+v", err)
+	}
+
+	if len(letters) != 1 {
+		t.Fatalf("Expected the failing letter to remain, got %d letters", len(letters))
+	}
+
+	if letters[0].Attempts != 2 || letters[0].Error != "still failing" || letters[0].Payload != nil {
+		t.Errorf("Unexpected dead letter after retry: %+v", letters[0])
+	}
+}
+
+func TestReplayExhaustsAttempts(t *testing.T) {
+
+	db := dbSetup(t)
+	cleanDeadLetters(db, t)
+
+	store := NewStore(db, func(letter Letter) error {
+		return errors.New("still failing")
+	}, testPolicy)
+
+	if err := store.Add(Letter{Source: "test", Payload: []byte("bad"), Error: "failed"}); err != nil {
+		t.Fatalf("Unable to add dead letter: %+v", err)
+	}
+
+	letters, err := store.List(StatusPending, 10)
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("Expected one pending letter, got %v, %+v", letters, err)
+	}
+
+	id := letters[0].ID
+	for i := 0; i < testPolicy.MaxAttempts; i++ {
+		if err := store.Replay(id); err == nil {
+			t.Fatal("Expected replay to fail")
+		}
+	}
+
+	letter, err := store.Get(id)
+	if err != nil {
+		t.Fatalf("Unable to get dead letter: %+v", err)
+	}
+
+	if letter.Status != StatusFailed || letter.NextAttempt != nil {
+		t.Errorf("Expected letter to be parked as failed, got %+v", letter)
+	}
+
+	if string(letter.Payload) != "bad" {
+		t.Errorf("Expected payload to be kept, got %s", letter.Payload)
+	}
+
+	if err := store.Discard(id); err != nil {
+		t.Fatalf("Unable to discard dead letter: %+v", err)
+	}
+
+	if _, err := store.Get(id); !web.IsNotFoundError(err) {
+		t.Errorf("Expected discarded letter to be not found, got %v", err)
+	}
+
+	if err := store.Discard(id); !web.IsNotFoundError(err) {
+		t.Errorf("Expected discarding twice to be not found, got %v", err)
+	}
+}
+
+func cleanDeadLetters(db *sql.DB, t *testing.T) {
+	if _, err := db.Exec("DELETE FROM dead_letters"); err != nil {
+		t.Fatalf("Unable to clean dead letters: %+v", err)
+	}
+}
+
+func dbSetup(t *testing.T) *sql.DB {
+
+	// Connect to PostgreSQL
+	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=%s", config.AppConfig.DbHost,
+		config.AppConfig.DbPort,
+		config.AppConfig.DbUser,
+		config.AppConfig.DbName,
+		config.AppConfig.DbSSLMode)
+	if config.AppConfig.DbPass != "" {
+		psqlInfo += " password=" + config.AppConfig.DbPass
+	}
+
+	db, err := sql.Open("postgres", psqlInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Create table
+	db.Exec(DbSchema)
+
+	return db
+}
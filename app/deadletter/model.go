@@ -0,0 +1,91 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package deadletter
+
+import (
+	"time"
+)
+
+// DbSchema postgresql db schema for events that failed ingestion
+const DbSchema = `
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+CREATE TABLE IF NOT EXISTS dead_letters (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	source TEXT NOT NULL,
+	device TEXT NOT NULL DEFAULT '',
+	value_descriptor TEXT NOT NULL DEFAULT '',
+	payload BYTEA NOT NULL,
+	error TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 1,
+	status TEXT NOT NULL DEFAULT 'pending',
+	created TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_attempt TIMESTAMPTZ NOT NULL DEFAULT now(),
+	next_attempt TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_next_attempt
+ON dead_letters (next_attempt) WHERE status = 'pending';
+`
+
+// Letter statuses
+const (
+	// StatusPending letters are retried automatically
+	StatusPending = "pending"
+	// StatusFailed letters exhausted their attempts and are only replayed on request
+	StatusFailed = "failed"
+)
+
+// Letter is an event that could not be ingested, kept with its raw payload so it can be replayed
+type Letter struct {
+	ID string `json:"id"`
+	// Source is the ingestion path the event came from, such as "edgex" or "mqtt"
+	Source string `json:"source"`
+	// Device and ValueDescriptor identify the EdgeX reading the payload came from,
+	// ValueDescriptor holding the topic of MQTT messages
+	Device          string `json:"device,omitempty"`
+	ValueDescriptor string `json:"valueDescriptor,omitempty"`
+	// Payload is the raw value as received, before any decoding
+	Payload     []byte     `json:"payload,omitempty"`
+	Error       string     `json:"error"`
+	Attempts    int        `json:"attempts"`
+	Status      string     `json:"status"`
+	Created     time.Time  `json:"created"`
+	LastAttempt time.Time  `json:"lastAttempt"`
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+}
+
+// RetryPolicy controls how often and how many times letters are retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the original one, before a letter is parked as failed
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubled on each following attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts
+	MaxBackoff time.Duration
+	// Interval is how often due letters are looked up
+	Interval time.Duration
+}
+
+// backoff returns the delay to wait after the given number of attempts
+func (policy RetryPolicy) backoff(attempts int) time.Duration {
+	delay := policy.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+	}
+	if delay > policy.MaxBackoff {
+		return policy.MaxBackoff
+	}
+	return delay
+}
+
+// exhausted returns true when no further automatic attempt should be made
+func (policy RetryPolicy) exhausted(attempts int) bool {
+	return attempts >= policy.MaxAttempts
+}
@@ -0,0 +1,152 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+const idempotencyTable = "idempotency_keys"
+
+// Store records the keys of processed requests and events along with their outcome
+type Store struct {
+	db     *sql.DB
+	window time.Duration
+	lease  time.Duration
+}
+
+// NewStore creates an idempotency store remembering keys for the given window. Keys claimed
+// but neither completed nor released within the lease, for instance because the service
+// stopped while processing them, are abandoned and can be claimed again.
+func NewStore(db *sql.DB, window time.Duration, lease time.Duration) *Store {
+	return &Store{db: db, window: window, lease: lease}
+}
+
+// Claim reserves a key before processing the request or event it identifies.
+// It returns nil if the key is new, expired or abandoned, in which case the caller must
+// either Complete or Release it, and the recorded response if it was already processed.
+// A key still being processed is a conflict, and a key reused for a different
+// fingerprint is unprocessable.
+func (store *Store) Claim(scope string, key string, fingerprint string) (*Response, error) {
+
+	// Metrics
+	mReplayed := metrics.GetOrRegisterGauge(`Product-Data.Idempotency.Replayed`, nil)
+
+	// Expired and abandoned keys are forgotten, so that they are processed again
+	deleteQuery := fmt.Sprintf(`DELETE FROM %s WHERE scope = $1 AND key = $2 AND (created < now() - $3 * interval '1 second'
+		OR (status IS NULL AND created < now() - $4 * interval '1 second'))`,
+		pq.QuoteIdentifier(idempotencyTable),
+	)
+	if _, err := store.db.Exec(deleteQuery, scope, key, store.window.Seconds(), store.lease.Seconds()); err != nil {
+		return nil, err
+	}
+
+	insertQuery := fmt.Sprintf(`INSERT INTO %s (scope, key, fingerprint) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		pq.QuoteIdentifier(idempotencyTable),
+	)
+	result, err := store.db.Exec(insertQuery, scope, key, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if inserted == 1 {
+		return nil, nil
+	}
+
+	selectQuery := fmt.Sprintf(`SELECT fingerprint, status, content_type, body FROM %s WHERE scope = $1 AND key = $2`,
+		pq.QuoteIdentifier(idempotencyTable),
+	)
+
+	var storedFingerprint string
+	var status sql.NullInt64
+	var response Response
+	err = store.db.QueryRow(selectQuery, scope, key).Scan(&storedFingerprint, &status, &response.ContentType, &response.Body)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Released in the meantime
+			return store.Claim(scope, key, fingerprint)
+		}
+		return nil, err
+	}
+
+	if storedFingerprint != fingerprint {
+		return nil, web.UnprocessableEntityError(fmt.Sprintf("%s was already used for a different request", HeaderName))
+	}
+	if !status.Valid {
+		return nil, web.ConflictError(fmt.Sprintf("A request with the same %s is being processed", HeaderName))
+	}
+
+	response.Status = int(status.Int64)
+	mReplayed.Update(1)
+	return &response, nil
+}
+
+// Complete records the response of a claimed key
+func (store *Store) Complete(scope string, key string, response Response) error {
+
+	updateQuery := fmt.Sprintf(`UPDATE %s SET status = $1, content_type = $2, body = $3 WHERE scope = $4 AND key = $5`,
+		pq.QuoteIdentifier(idempotencyTable),
+	)
+
+	_, err := store.db.Exec(updateQuery, response.Status, response.ContentType, response.Body, scope, key)
+	return err
+}
+
+// Release forgets a claimed key, so that the request or event can be processed again
+func (store *Store) Release(scope string, key string) error {
+
+	deleteQuery := fmt.Sprintf(`DELETE FROM %s WHERE scope = $1 AND key = $2`, pq.QuoteIdentifier(idempotencyTable))
+
+	_, err := store.db.Exec(deleteQuery, scope, key)
+	return err
+}
+
+// Purge removes the keys older than the window and returns how many were removed
+func (store *Store) Purge() (int64, error) {
+
+	deleteQuery := fmt.Sprintf(`DELETE FROM %s WHERE created < now() - $1 * interval '1 second'`,
+		pq.QuoteIdentifier(idempotencyTable),
+	)
+
+	result, err := store.db.Exec(deleteQuery, store.window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Run purges expired keys every interval until the context is done
+func (store *Store) Run(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := store.Purge(); err != nil {
+				log.WithFields(log.Fields{
+					"Method": "idempotency.Run",
+					"Action": "Purge idempotency keys",
+					"Error":  err.Error(),
+				}).Error("unable to purge idempotency keys")
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/middlewares"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+)
+
+func TestMain(m *testing.M) {
+
+	if err := config.InitConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+
+}
+
+func TestClaim(t *testing.T) {
+
+	db := dbSetup(t)
+	defer db.Close()
+	cleanKeys(db, t)
+
+	store := NewStore(db, time.Hour, time.Minute)
+
+	stored, err := store.Claim("POST /skus", "key-1", "fingerprint")
+	if err != nil || stored != nil {
+		t.Fatalf("Expected a new key to be claimed, but got %+v, %+v", stored, err)
+	}
+
+	// Still being processed
+	if _, err := store.Claim("POST /skus", "key-1", "fingerprint"); !isCode(err, http.StatusConflict) {
+		t.Errorf("Expected a conflict, but got %+v", err)
+	}
+
+	if err := store.Complete("POST /skus", "key-1", Response{Status: http.StatusCreated, Body: []byte(`"Successful"`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err = store.Claim("POST /skus", "key-1", "fingerprint")
+	if err != nil || stored == nil || stored.Status != http.StatusCreated || string(stored.Body) != `"Successful"` {
+		t.Errorf("Expected the recorded response, but got %+v, %+v", stored, err)
+	}
+
+	if _, err := store.Claim("POST /skus", "key-1", "other fingerprint"); !isCode(err, http.StatusUnprocessableEntity) {
+		t.Errorf("Expected the key reuse to be rejected, but got %+v", err)
+	}
+
+	// Keys are scoped
+	if stored, err := store.Claim("PUT /skus", "key-1", "other fingerprint"); err != nil || stored != nil {
+		t.Errorf("Expected the key to be claimed in another scope, but got %+v, %+v", stored, err)
+	}
+
+	// Keys claimed for longer than the lease are abandoned
+	abandoning := NewStore(db, time.Hour, time.Millisecond)
+	if stored, err := abandoning.Claim("DELETE /skus", "key-1", "fingerprint"); err != nil || stored != nil {
+		t.Fatalf("Expected a new key to be claimed, but got %+v, %+v", stored, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if stored, err := abandoning.Claim("DELETE /skus", "key-1", "fingerprint"); err != nil || stored != nil {
+		t.Errorf("Expected an abandoned key to be claimed again, but got %+v, %+v", stored, err)
+	}
+
+	if err := store.Release("PUT /skus", "key-1"); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := store.Claim("PUT /skus", "key-1", "fingerprint"); err != nil || stored != nil {
+		t.Errorf("Expected a released key to be claimed again, but got %+v, %+v", stored, err)
+	}
+}
+
+func TestMiddlewareReplaysResponse(t *testing.T) {
+
+	db := dbSetup(t)
+	defer db.Close()
+	cleanKeys(db, t)
+
+	calls := 0
+	handler := Middleware(NewStore(db, time.Hour, time.Minute))(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		calls++
+		web.Respond(ctx, writer, nil, http.StatusCreated)
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		request := httptest.NewRequest("POST", "/skus", strings.NewReader(`{"data":[]}`))
+		request.Header.Set(HeaderName, "retried-request")
+		recorder := httptest.NewRecorder()
+
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusCreated || recorder.Body.String() != `"Successful"` {
+			t.Errorf("Unexpected response %d %s", recorder.Code, recorder.Body.String())
+		}
+		if replayed := recorder.Header().Get(ReplayedHeader) == "true"; replayed != (i == 1) {
+			t.Errorf("Expected only the second response to be replayed")
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected the request to be processed once, but it was processed %d times", calls)
+	}
+}
+
+func TestMiddlewareScopesKeysToCallers(t *testing.T) {
+
+	db := dbSetup(t)
+	defer db.Close()
+	cleanKeys(db, t)
+
+	auth, err := middlewares.NewAuthenticator(middlewares.AuthConfig{APIKeys: []string{"first-key", "second-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	handler := auth.Authenticate(Middleware(NewStore(db, time.Hour, time.Minute))(
+		func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+			calls++
+			principal, _ := middlewares.PrincipalFromContext(ctx)
+			web.Respond(ctx, writer, principal.Subject, http.StatusCreated)
+			return nil
+		}))
+
+	// Both callers choose the same key, neither getting the response of the other
+	for _, apiKey := range []string{"first-key", "second-key"} {
+		request := httptest.NewRequest("POST", "/skus", strings.NewReader(`{"data":[]}`))
+		request.Header.Set(HeaderName, "shared-key")
+		request.Header.Set(middlewares.APIKeyHeader, apiKey)
+		recorder := httptest.NewRecorder()
+
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusCreated || recorder.Header().Get(ReplayedHeader) != "" {
+			t.Errorf("%s: expected a new response, but got %d %v", apiKey, recorder.Code, recorder.Header())
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected the request of each caller to be processed, but %d were", calls)
+	}
+}
+
+func TestMiddlewareWithoutKey(t *testing.T) {
+
+	// Requests without a key never reach the store
+	handler := Middleware(nil)(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		web.Respond(ctx, writer, nil, http.StatusCreated)
+		return nil
+	})
+
+	request := httptest.NewRequest("POST", "/skus", strings.NewReader(`{"data":[]}`))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusCreated {
+		t.Errorf("Expected %d, but got %d", http.StatusCreated, recorder.Code)
+	}
+
+	request = httptest.NewRequest("POST", "/skus", strings.NewReader(`{"data":[]}`))
+	request.Header.Set(HeaderName, strings.Repeat("k", maxKeyLength+1))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected %d for a key too long, but got %d", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func isCode(err error, code int) bool {
+	common, ok := err.(web.CommonError)
+	return ok && common.Code == code
+}
+
+func cleanKeys(db *sql.DB, t *testing.T) {
+	if _, err := db.Exec("DELETE FROM idempotency_keys"); err != nil {
+		t.Fatalf("Unable to clean idempotency keys: %+v", err)
+	}
+}
+
+func dbSetup(t *testing.T) *sql.DB {
+
+	// Connect to PostgreSQL
+	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=%s", config.AppConfig.DbHost,
+		config.AppConfig.DbPort,
+		config.AppConfig.DbUser,
+		config.AppConfig.DbName,
+		config.AppConfig.DbSSLMode)
+	if config.AppConfig.DbPass != "" {
+		psqlInfo += " password=" + config.AppConfig.DbPass
+	}
+
+	db, err := sql.Open("postgres", psqlInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Create table
+	db.Exec(DbSchema)
+
+	return db
+}
@@ -0,0 +1,139 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/middlewares"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	log "github.com/sirupsen/logrus"
+)
+
+// Middleware returns the recorded response of requests repeated with the same Idempotency-Key
+// header by the same caller within the window instead of processing them again. It must be
+// wrapped by the Authenticate middleware for the keys to be scoped to the caller. Requests without the header are
+// processed as usual, and server errors are not recorded so that they can be retried.
+func Middleware(store *Store) web.Middleware {
+	return func(next web.Handler) web.Handler {
+		return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+			key := request.Header.Get(HeaderName)
+			if key == "" {
+				return next(ctx, writer, request)
+			}
+			if len(key) > maxKeyLength {
+				return web.ValidationError("Idempotency-Key is too long")
+			}
+
+			body, err := ioutil.ReadAll(request.Body)
+			if err != nil {
+				return err
+			}
+			request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			scope := requestScope(ctx, request)
+			fingerprint := Checksum(body)
+
+			stored, err := store.Claim(scope, key, fingerprint)
+			if err != nil {
+				return err
+			}
+			if stored != nil {
+				if stored.ContentType != "" {
+					writer.Header().Set("Content-Type", stored.ContentType)
+				}
+				writer.Header().Set(ReplayedHeader, "true")
+				writer.WriteHeader(stored.Status)
+				_, err := writer.Write(stored.Body)
+				return err
+			}
+
+			recorder := &responseRecorder{ResponseWriter: writer, status: http.StatusOK}
+
+			// The key is released if the handler panics, the panic being handled further up
+			defer func() {
+				if r := recover(); r != nil {
+					release(store, scope, key)
+					panic(r)
+				}
+			}()
+
+			if err := next(ctx, recorder, request); err != nil {
+				// Errors are written here so that client errors are recorded like any other response
+				web.Error(ctx, recorder, err)
+			}
+
+			if recorder.status >= http.StatusInternalServerError {
+				release(store, scope, key)
+				return nil
+			}
+
+			response := Response{
+				Status:      recorder.status,
+				ContentType: recorder.Header().Get("Content-Type"),
+				Body:        recorder.body.Bytes(),
+			}
+			if err := store.Complete(scope, key, response); err != nil {
+				log.WithFields(log.Fields{
+					"Method": "idempotency.Middleware",
+					"Action": "Record response",
+					"Error":  err.Error(),
+				}).Error("unable to record idempotent response")
+			}
+
+			return nil
+		})
+	}
+}
+
+// requestScope scopes the keys to the route and to the authenticated caller, so that clients
+// choosing the same key neither replay nor conflict with each other's requests
+func requestScope(ctx context.Context, request *http.Request) string {
+	scope := request.Method + " " + request.URL.Path
+	if principal, ok := middlewares.PrincipalFromContext(ctx); ok {
+		scope = principal.Method + " " + principal.Subject + " " + scope
+	}
+	return scope
+}
+
+// Checksum returns the hex encoded SHA-256 of a payload
+func Checksum(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+func release(store *Store, scope string, key string) {
+	if err := store.Release(scope, key); err != nil {
+		log.WithFields(log.Fields{
+			"Method": "idempotency.Middleware",
+			"Action": "Release key",
+			"Error":  err.Error(),
+		}).Error("unable to release idempotency key")
+	}
+}
+
+// responseRecorder writes the response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.body.Write(data)
+	return recorder.ResponseWriter.Write(data)
+}
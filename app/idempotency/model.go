@@ -0,0 +1,40 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package idempotency
+
+// DbSchema postgresql db schema for the idempotency keys of requests and events
+const DbSchema = `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	scope TEXT NOT NULL,
+	key TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	status INTEGER,
+	content_type TEXT NOT NULL DEFAULT '',
+	body BYTEA,
+	-- When the key was claimed, the lease of keys being processed starting then as well
+	created TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created
+ON idempotency_keys (created);
+`
+
+// HeaderName is the request header carrying the idempotency key
+const HeaderName = "Idempotency-Key"
+
+// ReplayedHeader is set on responses returned from the store instead of being processed again
+const ReplayedHeader = "Idempotent-Replayed"
+
+// maxKeyLength bounds the size of client supplied keys
+const maxKeyLength = 255
+
+// Response is the outcome recorded for a key, returned again for repeated requests
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
@@ -0,0 +1,380 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package ingestion
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/productdata"
+	"github.com/pkg/errors"
+)
+
+// Payload formats
+const (
+	// EnvelopeFormat is an IncomingData array wrapped as {"data": [...], "sent_on": <epoch ms>}
+	EnvelopeFormat = "envelope"
+	// SKUDataFormat is the {"data": [{"sku": ..., "productList": [...]}]} document of the REST API
+	SKUDataFormat = "skuData"
+	// NDJSONFormat has one IncomingData JSON object per line
+	NDJSONFormat = "ndjson"
+	// CSVFormat has a header row naming the IncomingData attributes, other columns become metadata
+	CSVFormat = "csv"
+	// AutoFormat detects the format from the payload content
+	AutoFormat = "auto"
+)
+
+// maxDecompressedSize caps the size of a gzip compressed payload once inflated
+const maxDecompressedSize = 64 << 20
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Batch is the product data held by one payload
+type Batch struct {
+	SKUs []productdata.SKUData
+	// SentOn is when the source sent the data, in milliseconds since epoch, or 0 when unknown
+	SentOn int64
+}
+
+// Decoder turns a payload into product data. Fields renames the attributes of the payload,
+// mapping the name used by the source to the name expected by the format.
+type Decoder func(payload []byte, fields map[string]string) (Batch, error)
+
+var decoders = map[string]Decoder{
+	IncomingDataFormat: decodeIncomingData,
+	EnvelopeFormat:     decodeEnvelope,
+	SKUDataFormat:      decodeSKUData,
+	NDJSONFormat:       decodeNDJSON,
+	CSVFormat:          decodeCSV,
+}
+
+// RegisterDecoder makes a payload format available to the ingestion rules.
+// It is meant to be called before the rules are loaded.
+func RegisterDecoder(format string, decoder Decoder) {
+	decoders[format] = decoder
+}
+
+func knownFormat(format string) bool {
+	if format == AutoFormat {
+		return true
+	}
+	_, ok := decoders[format]
+	return ok
+}
+
+// Decode decodes a payload with the format and field names of the rule.
+// Gzip compressed payloads are inflated first, whatever the format.
+func (rule Rule) Decode(payload []byte) (Batch, error) {
+
+	if bytes.HasPrefix(payload, gzipMagic) {
+		inflated, err := gunzip(payload)
+		if err != nil {
+			return Batch{}, err
+		}
+		payload = inflated
+	}
+
+	format := rule.Format
+	if format == AutoFormat {
+		format = detectFormat(payload)
+	}
+
+	decoder, ok := decoders[format]
+	if !ok {
+		return Batch{}, errors.Errorf("unknown payload format '%s'", format)
+	}
+
+	batch, err := decoder(payload, rule.Fields)
+	if err != nil {
+		return Batch{}, errors.Wrapf(err, "unable to decode %s payload", format)
+	}
+
+	return batch, nil
+}
+
+func gunzip(payload []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid gzip payload")
+	}
+	defer reader.Close()
+
+	inflated, err := ioutil.ReadAll(io.LimitReader(reader, maxDecompressedSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid gzip payload")
+	}
+	if len(inflated) > maxDecompressedSize {
+		return nil, errors.Errorf("gzip payload exceeds %d bytes once decompressed", maxDecompressedSize)
+	}
+
+	return inflated, nil
+}
+
+// detectFormat guesses the format of a payload from its first characters
+func detectFormat(payload []byte) string {
+
+	trimmed := bytes.TrimSpace(payload)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return IncomingDataFormat
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var document struct {
+			Data []map[string]json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(trimmed, &document); err == nil && len(document.Data) > 0 {
+			if _, ok := document.Data[0]["productList"]; ok {
+				return SKUDataFormat
+			}
+		}
+		return EnvelopeFormat
+	default:
+		return CSVFormat
+	}
+}
+
+func decodeIncomingData(payload []byte, fields map[string]string) (Batch, error) {
+
+	items, err := unmarshalIncomingData(payload, fields)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	return Batch{SKUs: groupBySku(items)}, nil
+}
+
+func decodeEnvelope(payload []byte, fields map[string]string) (Batch, error) {
+
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		SentOn int64           `json:"sent_on"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return Batch{}, err
+	}
+	if envelope.Data == nil {
+		return Batch{}, errors.New("missing data attribute")
+	}
+
+	items, err := unmarshalIncomingData(envelope.Data, fields)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	return Batch{SKUs: groupBySku(items), SentOn: envelope.SentOn}, nil
+}
+
+func decodeSKUData(payload []byte, fields map[string]string) (Batch, error) {
+
+	var root struct {
+		Data []map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &root); err != nil {
+		return Batch{}, err
+	}
+
+	skus := make([]productdata.SKUData, 0, len(root.Data))
+	for _, object := range root.Data {
+		renameFields(object, fields)
+
+		// Products are renamed on their own before the SKU is decoded
+		if productList, ok := object["productList"]; ok && len(fields) > 0 {
+			var products []map[string]json.RawMessage
+			if err := json.Unmarshal(productList, &products); err != nil {
+				return Batch{}, err
+			}
+			for _, product := range products {
+				renameFields(product, fields)
+			}
+			renamed, err := json.Marshal(products)
+			if err != nil {
+				return Batch{}, err
+			}
+			object["productList"] = renamed
+		}
+
+		var sku productdata.SKUData
+		if err := remarshal(object, &sku); err != nil {
+			return Batch{}, err
+		}
+		skus = append(skus, sku)
+	}
+
+	return Batch{SKUs: skus}, nil
+}
+
+func decodeNDJSON(payload []byte, fields map[string]string) (Batch, error) {
+
+	// Lines are joined into a JSON array so they are decoded like the IncomingData format
+	var array bytes.Buffer
+	array.WriteByte('[')
+	for _, line := range bytes.Split(payload, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if array.Len() > 1 {
+			array.WriteByte(',')
+		}
+		array.Write(line)
+	}
+	array.WriteByte(']')
+
+	items, err := unmarshalIncomingData(array.Bytes(), fields)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	return Batch{SKUs: groupBySku(items)}, nil
+}
+
+// csvNumbers are the IncomingData attributes parsed as numbers in a CSV payload
+var csvNumbers = map[string]bool{
+	"beingRead":        true,
+	"becomingReadable": true,
+	"exitError":        true,
+	"dailyTurn":        true,
+}
+
+func decodeCSV(payload []byte, fields map[string]string) (Batch, error) {
+
+	reader := csv.NewReader(bytes.NewReader(payload))
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return Batch{}, err
+	}
+	if len(records) == 0 {
+		return Batch{}, errors.New("missing header row")
+	}
+
+	header := records[0]
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if name, ok := fields[column]; ok {
+			column = name
+		}
+		header[i] = column
+	}
+
+	items := make([]productdata.IncomingData, 0, len(records)-1)
+	for line, record := range records[1:] {
+		object := make(map[string]interface{}, len(record))
+		metadata := make(map[string]interface{})
+
+		for i, value := range record {
+			// Empty cells are left out so the stored value is kept
+			if value == "" {
+				continue
+			}
+			column := header[i]
+			switch {
+			case column == "sku" || column == "upc":
+				object[column] = value
+			case csvNumbers[column]:
+				number, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return Batch{}, errors.Errorf("line %d: %s is not a number", line+2, column)
+				}
+				object[column] = number
+			default:
+				metadata[column] = value
+			}
+		}
+		if len(metadata) > 0 {
+			object["metadata"] = metadata
+		}
+
+		var item productdata.IncomingData
+		if err := remarshal(object, &item); err != nil {
+			return Batch{}, err
+		}
+		items = append(items, item)
+	}
+
+	return Batch{SKUs: groupBySku(items)}, nil
+}
+
+func unmarshalIncomingData(data []byte, fields map[string]string) ([]productdata.IncomingData, error) {
+
+	if len(fields) == 0 {
+		var items []productdata.IncomingData
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	items := make([]productdata.IncomingData, len(objects))
+	for i, object := range objects {
+		renameFields(object, fields)
+		if err := remarshal(object, &items[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
+// renameFields renames the attributes of an object, mapping source names to format names
+func renameFields(object map[string]json.RawMessage, fields map[string]string) {
+	for source, name := range fields {
+		if value, ok := object[source]; ok {
+			delete(object, source)
+			object[name] = value
+		}
+	}
+}
+
+// remarshal decodes a generic object into target, so that custom unmarshalling
+// such as attribute presence tracking applies
+func remarshal(object interface{}, target interface{}) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// groupBySku transforms the incoming data into the list of products of each SKU
+func groupBySku(items []productdata.IncomingData) []productdata.SKUData {
+
+	prodDataMap := make(map[string]productdata.SKUData)
+	order := make([]string, 0)
+	for _, item := range items {
+		productData := item.ProductData()
+		skuData, repeatSKU := prodDataMap[item.SKU]
+		if repeatSKU {
+			skuData.ProductList = append(skuData.ProductList, productData)
+		} else {
+			skuData = productdata.SKUData{
+				SKU:         item.SKU,
+				ProductList: []productdata.ProductData{productData},
+			}
+			order = append(order, item.SKU)
+		}
+		prodDataMap[item.SKU] = skuData
+	}
+
+	// extract the values to a list
+	prodDataList := make([]productdata.SKUData, 0, len(prodDataMap))
+	for _, sku := range order {
+		prodDataList = append(prodDataList, prodDataMap[sku])
+	}
+
+	return prodDataList
+}
@@ -0,0 +1,117 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package ingestion
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/productdata"
+)
+
+func TestDecodeFormats(t *testing.T) {
+
+	testCases := []struct {
+		format  string
+		payload string
+		sentOn  int64
+	}{
+		{IncomingDataFormat, `[{"sku":"12345678","upc":"123456789789","dailyTurn":0.04,"metadata":{"color":"blue"}}]`, 0},
+		{EnvelopeFormat, `{"data":[{"sku":"12345678","upc":"123456789789","dailyTurn":0.04,"metadata":{"color":"blue"}}],"sent_on":1501872400247}`, 1501872400247},
+		{SKUDataFormat, `{"data":[{"sku":"12345678","productList":[{"productId":"123456789789","dailyTurn":0.04,"metadata":{"color":"blue"}}]}]}`, 0},
+		{CSVFormat, "sku,upc,dailyTurn,color\n12345678,123456789789,0.04,blue\n", 0},
+	}
+
+	for _, testCase := range testCases {
+		for _, format := range []string{testCase.format, AutoFormat} {
+			rule := Rule{Mode: productdata.MergeMode, Format: format}
+
+			for _, payload := range [][]byte{[]byte(testCase.payload), gzipped(t, testCase.payload)} {
+				batch, err := rule.Decode(payload)
+				if err != nil {
+					t.Fatalf("Unable to decode %s payload as %s: %+v", testCase.format, format, err)
+				}
+				if batch.SentOn != testCase.sentOn {
+					t.Errorf("Expected sent_on %d, but got %d", testCase.sentOn, batch.SentOn)
+				}
+				assertSingleProduct(t, testCase.format, batch)
+			}
+		}
+	}
+}
+
+func TestDecodeFieldMapping(t *testing.T) {
+
+	rules, err := NewRules(map[string]map[string]string{
+		"Partner_Device": {"format": "auto", "fields.upc": "gtin", "fields.sku": "item"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := rules.Match("Partner_Device", "SKU_data")
+
+	payloads := []string{
+		`[{"item":"12345678","gtin":"123456789789","dailyTurn":0.04,"metadata":{"color":"blue"}}]`,
+		"item,gtin,dailyTurn,color\n12345678,123456789789,0.04,blue\n",
+	}
+
+	for _, payload := range payloads {
+		batch, err := rule.Decode([]byte(payload))
+		if err != nil {
+			t.Fatalf("Unable to decode payload: %+v", err)
+		}
+		assertSingleProduct(t, rule.Format, batch)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+
+	testCases := []struct {
+		format  string
+		payload string
+	}{
+		{IncomingDataFormat, `{"sku":"12345678"}`},
+		{EnvelopeFormat, `{"sent_on":1501872400247}`},
+		{CSVFormat, "sku,upc,dailyTurn\n12345678,123456789789,often\n"},
+		{CSVFormat, ""},
+	}
+
+	for _, testCase := range testCases {
+		rule := Rule{Mode: productdata.MergeMode, Format: testCase.format}
+		if _, err := rule.Decode([]byte(testCase.payload)); err == nil {
+			t.Errorf("Expected an error decoding %q as %s", testCase.payload, testCase.format)
+		}
+	}
+}
+
+func assertSingleProduct(t *testing.T, format string, batch Batch) {
+
+	if len(batch.SKUs) != 1 || len(batch.SKUs[0].ProductList) != 1 {
+		t.Fatalf("Expected a single product decoding %s, but got %+v", format, batch.SKUs)
+	}
+
+	sku := batch.SKUs[0]
+	product := sku.ProductList[0]
+	if sku.SKU != "12345678" || product.ProductID != "123456789789" {
+		t.Errorf("Unexpected SKU %s and product %s decoding %s", sku.SKU, product.ProductID, format)
+	}
+	if product.DailyTurn != 0.04 || product.Metadata["color"] != "blue" {
+		t.Errorf("Unexpected product attributes decoding %s: %+v", format, product)
+	}
+}
+
+func gzipped(t *testing.T, payload string) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,270 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// FolderSource is the device name matched against the ingestion rules for dropped files,
+// the file name being the value descriptor
+const FolderSource = "folder"
+
+// Subfolders of the drop folder where files are moved once imported
+const (
+	ProcessedFolder = "processed"
+	FailedFolder    = "failed"
+)
+
+// folderBatchSize is the number of SKUs stored at once, so that large catalogs are not
+// imported in a single statement
+const folderBatchSize = 500
+
+// reportSuffix is appended to the name of a moved file for its sidecar report
+const reportSuffix = ".report.json"
+
+// fileFormats maps the extensions of the files picked up to their payload format,
+// a ".gz" extension being allowed after them
+var fileFormats = map[string]string{
+	".json":   AutoFormat,
+	".ndjson": NDJSONFormat,
+	".jsonl":  NDJSONFormat,
+	".csv":    CSVFormat,
+}
+
+// partialSuffixes mark files that are still being written under a temporary name
+var partialSuffixes = []string{".tmp", ".part", ".partial", ".filepart", ".crdownload"}
+
+// Store persists the product data of a batch according to its rule
+type Store func(batch Batch, rule Rule) error
+
+// FolderConfig holds the settings of the drop folder
+type FolderConfig struct {
+	Dir string
+	// Interval is how often the folder is scanned
+	Interval time.Duration
+	// Settle is how long a file must be left untouched before it is imported
+	Settle time.Duration
+}
+
+// FileReport is written next to an imported file once it is moved
+type FileReport struct {
+	File     string    `json:"file"`
+	Status   string    `json:"status"`
+	SKUs     int       `json:"skus"`
+	Products int       `json:"products"`
+	Imported int       `json:"imported"`
+	Error    string    `json:"error,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// FolderWatcher imports the product data files dropped in a folder
+type FolderWatcher struct {
+	config FolderConfig
+	rules  Rules
+	store  Store
+	// pending holds the size and modification time of the files seen on the previous scan
+	pending map[string]os.FileInfo
+}
+
+// NewFolderWatcher creates the processed and failed subfolders of the drop folder
+func NewFolderWatcher(config FolderConfig, rules Rules, store Store) (*FolderWatcher, error) {
+
+	for _, folder := range []string{ProcessedFolder, FailedFolder} {
+		if err := os.MkdirAll(filepath.Join(config.Dir, folder), 0755); err != nil {
+			return nil, errors.Wrap(err, "unable to create drop folder")
+		}
+	}
+
+	return &FolderWatcher{
+		config:  config,
+		rules:   rules,
+		store:   store,
+		pending: make(map[string]os.FileInfo),
+	}, nil
+}
+
+// Run scans the folder every interval until the context is done
+func (watcher *FolderWatcher) Run(ctx context.Context) {
+
+	ticker := time.NewTicker(watcher.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := watcher.Scan(); err != nil {
+				log.WithFields(log.Fields{
+					"Method": "ingestion.FolderWatcher.Run",
+					"Action": "Scan drop folder",
+					"Error":  err.Error(),
+				}).Error("unable to scan drop folder")
+			}
+		}
+	}
+}
+
+// Scan imports the files that did not change since the previous scan and were left
+// untouched for the settle time, so that files still being written are not picked up
+func (watcher *FolderWatcher) Scan() error {
+
+	files, err := ioutil.ReadDir(watcher.config.Dir)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]os.FileInfo, len(files))
+	for _, file := range files {
+		name := file.Name()
+		if !file.Mode().IsRegular() || partialFile(name) {
+			continue
+		}
+
+		previous, ok := watcher.pending[name]
+		if !ok || previous.Size() != file.Size() || !previous.ModTime().Equal(file.ModTime()) ||
+			time.Since(file.ModTime()) < watcher.config.Settle {
+			seen[name] = file
+			continue
+		}
+
+		watcher.importFile(name)
+	}
+	watcher.pending = seen
+
+	return nil
+}
+
+// importFile imports a file and moves it with its report to the processed or failed subfolder
+func (watcher *FolderWatcher) importFile(name string) {
+
+	// Metrics
+	mProcessed := metrics.GetOrRegisterGauge(`Product-Data.DropFolder.Processed`, nil)
+	mFailed := metrics.GetOrRegisterGauge(`Product-Data.DropFolder.Failed`, nil)
+
+	report := FileReport{File: name, Status: ProcessedFolder, Started: time.Now().UTC()}
+
+	if err := watcher.ingest(name, &report); err != nil {
+		report.Status = FailedFolder
+		report.Error = err.Error()
+		mFailed.Update(1)
+		log.WithFields(log.Fields{
+			"Method":   "ingestion.FolderWatcher",
+			"Action":   "Import file",
+			"File":     name,
+			"Imported": report.Imported,
+			"Error":    err.Error(),
+		}).Error("unable to import product data file")
+	} else {
+		mProcessed.Update(1)
+		log.WithFields(log.Fields{
+			"Method": "ingestion.FolderWatcher",
+			"Action": "Import file",
+			"File":   name,
+			"SKUs":   report.SKUs,
+		}).Info("product data file imported")
+	}
+	report.Finished = time.Now().UTC()
+
+	// Files are prefixed with the import time so that a nightly export of the same name does not
+	// overwrite the previous one
+	target := filepath.Join(watcher.config.Dir, report.Status, report.Started.Format("20060102T150405.000Z")+"-"+name)
+	if err := os.Rename(filepath.Join(watcher.config.Dir, name), target); err != nil {
+		log.WithFields(log.Fields{
+			"Method": "ingestion.FolderWatcher",
+			"Action": "Move file",
+			"File":   name,
+			"Error":  err.Error(),
+		}).Error("unable to move product data file, it will be imported again")
+		return
+	}
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(target+reportSuffix, content, 0644)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "ingestion.FolderWatcher",
+			"Action": "Write report",
+			"File":   name,
+			"Error":  err.Error(),
+		}).Error("unable to write product data file report")
+	}
+}
+
+func (watcher *FolderWatcher) ingest(name string, report *FileReport) error {
+
+	format, ok := fileFormat(name)
+	if !ok {
+		return errors.Errorf("unsupported file type, expected one of .json, .ndjson, .jsonl or .csv")
+	}
+
+	payload, err := ioutil.ReadFile(filepath.Join(watcher.config.Dir, name))
+	if err != nil {
+		return err
+	}
+
+	rule := watcher.rules.Match(FolderSource, name)
+	rule.Format = format
+
+	batch, err := rule.Decode(payload)
+	if err != nil {
+		return err
+	}
+
+	report.SKUs = len(batch.SKUs)
+	for _, sku := range batch.SKUs {
+		report.Products += len(sku.ProductList)
+	}
+
+	for start := 0; start < len(batch.SKUs); start += folderBatchSize {
+		end := start + folderBatchSize
+		if end > len(batch.SKUs) {
+			end = len(batch.SKUs)
+		}
+		chunk := Batch{SKUs: batch.SKUs[start:end], SentOn: batch.SentOn}
+		if err := watcher.store(chunk, rule); err != nil {
+			return err
+		}
+		report.Imported = end
+	}
+
+	return nil
+}
+
+// fileFormat returns the payload format of a file from its extension
+func fileFormat(name string) (string, bool) {
+	extension := strings.ToLower(filepath.Ext(strings.TrimSuffix(strings.ToLower(name), ".gz")))
+	format, ok := fileFormats[extension]
+	return format, ok
+}
+
+// partialFile tells whether a file is hidden or still being written under a temporary name
+func partialFile(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, suffix := range partialSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package ingestion
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFolderWatcher(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "drop-folder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var stored []Batch
+	watcher, err := NewFolderWatcher(FolderConfig{Dir: dir}, Rules{}, func(batch Batch, rule Rule) error {
+		if batch.SKUs[0].SKU == "broken" {
+			return errors.New("database unavailable")
+		}
+		stored = append(stored, batch)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"catalog.json":      `[{"sku":"12345678","upc":"123456789789"}]`,
+		"catalog.ndjson":    "{\"sku\":\"12345679\",\"upc\":\"123456789790\"}\n{\"sku\":\"12345679\",\"upc\":\"123456789791\"}\n",
+		"catalog.csv":       "sku,upc,color\n12345680,123456789792,blue\n",
+		"broken.csv":        "sku,upc\nbroken,123456789793\n",
+		"catalog.txt":       "sku,upc\n12345681,123456789794\n",
+		"catalog.json.part": `[{"sku":"12345682",`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Files are only imported once they did not change between two scans
+	if err := watcher.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 0 {
+		t.Fatalf("Expected no file to be imported on the first scan, but got %d", len(stored))
+	}
+	if err := watcher.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 3 {
+		t.Errorf("Expected 3 files to be imported, but got %d", len(stored))
+	}
+
+	// Only the file being written is left in the drop folder
+	remaining, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range remaining {
+		if file.Mode().IsRegular() && file.Name() != "catalog.json.part" {
+			t.Errorf("Expected %s to be moved", file.Name())
+		}
+	}
+
+	assertReports(t, filepath.Join(dir, ProcessedFolder), map[string]int{"catalog.json": 1, "catalog.ndjson": 2, "catalog.csv": 1})
+	assertReports(t, filepath.Join(dir, FailedFolder), map[string]int{"broken.csv": 1, "catalog.txt": 0})
+}
+
+func assertReports(t *testing.T, folder string, expected map[string]int) {
+
+	reports, err := filepath.Glob(filepath.Join(folder, "*"+reportSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != len(expected) {
+		t.Fatalf("Expected %d reports in %s, but got %d", len(expected), folder, len(reports))
+	}
+
+	for _, path := range reports {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report FileReport
+		if err := json.Unmarshal(content, &report); err != nil {
+			t.Fatal(err)
+		}
+
+		products, ok := expected[report.File]
+		if !ok {
+			t.Errorf("Unexpected report for %s", report.File)
+			continue
+		}
+		if report.Products != products || report.Status != filepath.Base(folder) {
+			t.Errorf("Unexpected report for %s: %+v", report.File, report)
+		}
+		if report.Status == FailedFolder && report.Error == "" {
+			t.Errorf("Expected an error in the report of %s", report.File)
+		}
+		if _, err := os.Stat(strings.TrimSuffix(path, reportSuffix)); err != nil {
+			t.Errorf("Expected %s to be moved next to its report", report.File)
+		}
+	}
+}
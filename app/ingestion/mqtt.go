@@ -0,0 +1,154 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package ingestion
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// MQTTSource is the device name matched against the ingestion rules for MQTT messages,
+// the topic being the value descriptor
+const MQTTSource = "mqtt"
+
+// mqttTimeout bounds the connection and subscription to the broker
+const mqttTimeout = 30 * time.Second
+
+// MQTTConfig holds the connection settings of the MQTT broker
+type MQTTConfig struct {
+	// Broker is the URL of the broker, such as tcp://localhost:1883 or ssl://broker:8883
+	Broker   string
+	Topic    string
+	QoS      byte
+	ClientID string
+	Username string
+	Password string
+	// CAFile verifies the broker certificate, CertFile and KeyFile authenticate the client
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// MessageHandler processes the payload of a message received on a topic
+type MessageHandler func(topic string, payload []byte)
+
+// MQTTSubscriber feeds the messages of an MQTT topic to a handler
+type MQTTSubscriber struct {
+	client mqtt.Client
+}
+
+// NewMQTTSubscriber connects to the broker and subscribes to the topic.
+// The subscription is restored whenever the connection is lost and established again.
+func NewMQTTSubscriber(config MQTTConfig, handler MessageHandler) (*MQTTSubscriber, error) {
+
+	if config.QoS > 2 {
+		return nil, errors.Errorf("invalid MQTT QoS %d", config.QoS)
+	}
+
+	options := mqtt.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetAutoReconnect(true).
+		// A persistent session keeps the messages published while the service is down
+		SetCleanSession(config.QoS == 0).
+		SetConnectTimeout(mqttTimeout)
+
+	if config.CAFile != "" || config.CertFile != "" {
+		tlsConfig, err := mqttTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		options.SetTLSConfig(tlsConfig)
+	}
+
+	onMessage := func(_ mqtt.Client, message mqtt.Message) {
+		metrics.GetOrRegisterGauge(`Product-Data.MQTT.Received`, nil).Update(1)
+		handler(message.Topic(), message.Payload())
+	}
+
+	options.SetOnConnectHandler(func(client mqtt.Client) {
+		token := client.Subscribe(config.Topic, config.QoS, onMessage)
+		if token.WaitTimeout(mqttTimeout) && token.Error() == nil {
+			log.WithFields(log.Fields{
+				"Method": "ingestion.NewMQTTSubscriber",
+				"Broker": config.Broker,
+				"Topic":  config.Topic,
+			}).Info("subscribed to MQTT topic")
+			return
+		}
+		metrics.GetOrRegisterGauge(`Product-Data.MQTT.Subscribe-Error`, nil).Update(1)
+		log.WithFields(log.Fields{
+			"Method": "ingestion.NewMQTTSubscriber",
+			"Broker": config.Broker,
+			"Topic":  config.Topic,
+			"Error":  errorOf(token),
+		}).Error("unable to subscribe to MQTT topic")
+	})
+
+	options.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		metrics.GetOrRegisterGauge(`Product-Data.MQTT.Connection-Lost`, nil).Update(1)
+		log.WithFields(log.Fields{
+			"Method": "ingestion.NewMQTTSubscriber",
+			"Broker": config.Broker,
+			"Error":  err.Error(),
+		}).Warn("MQTT connection lost, reconnecting")
+	})
+
+	client := mqtt.NewClient(options)
+	token := client.Connect()
+	if !token.WaitTimeout(mqttTimeout) || token.Error() != nil {
+		return nil, errors.Errorf("unable to connect to MQTT broker %s: %s", config.Broker, errorOf(token))
+	}
+
+	return &MQTTSubscriber{client: client}, nil
+}
+
+// Close unsubscribes and disconnects from the broker
+func (subscriber *MQTTSubscriber) Close() {
+	subscriber.client.Disconnect(uint(time.Second / time.Millisecond))
+}
+
+func mqttTLSConfig(config MQTTConfig) (*tls.Config, error) {
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if config.CAFile != "" {
+		caCert, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read MQTT CA file")
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("no certificate found in MQTT CA file")
+		}
+	}
+
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load MQTT client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func errorOf(token mqtt.Token) string {
+	if token.Error() != nil {
+		return token.Error().Error()
+	}
+	return "timeout"
+}
@@ -0,0 +1,243 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package ingestion
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestMQTTSubscriber(t *testing.T) {
+
+	broker := newTestBroker(t)
+	defer broker.close()
+
+	received := make(chan []byte, 1)
+	subscriber, err := NewMQTTSubscriber(MQTTConfig{
+		Broker:   broker.url(),
+		Topic:    "product-data",
+		QoS:      1,
+		ClientID: "product-data-service",
+	}, func(topic string, payload []byte) {
+		if topic == "product-data" {
+			received <- payload
+		}
+	})
+	if err != nil {
+		t.Fatalf("Unable to subscribe: %+v", err)
+	}
+	defer subscriber.Close()
+
+	broker.waitSubscribed(t, "product-data")
+
+	publisher := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker.url()).SetClientID("publisher"))
+	if token := publisher.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	defer publisher.Disconnect(0)
+
+	payload := `[{"sku":"12345678","upc":"123456789789"}]`
+	if token := publisher.Publish("product-data", 1, false, payload); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	select {
+	case message := <-received:
+		if string(message) != payload {
+			t.Errorf("Expected payload %s, but got %s", payload, message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No message received")
+	}
+}
+
+func TestMQTTSubscriberInvalidConfig(t *testing.T) {
+
+	testCases := []MQTTConfig{
+		{Broker: "tcp://127.0.0.1:1", Topic: "product-data", QoS: 3},
+		{Broker: "ssl://127.0.0.1:1", Topic: "product-data", CAFile: "missing-ca.pem"},
+	}
+
+	for _, config := range testCases {
+		if _, err := NewMQTTSubscriber(config, func(string, []byte) {}); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+}
+
+// testBroker is a minimal MQTT 3.1.1 broker forwarding messages to the subscribers of the
+// exact same topic at QoS 0
+type testBroker struct {
+	listener    net.Listener
+	mutex       sync.Mutex
+	subscribers map[string][]*brokerConn
+}
+
+type brokerConn struct {
+	net.Conn
+	mutex sync.Mutex
+}
+
+// MQTT control packet types
+const (
+	connectPacket     = 1
+	publishPacket     = 3
+	subscribePacket   = 8
+	unsubscribePacket = 10
+	pingPacket        = 12
+	disconnectPacket  = 14
+)
+
+func newTestBroker(t *testing.T) *testBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := &testBroker{listener: listener, subscribers: make(map[string][]*brokerConn)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(&brokerConn{Conn: conn})
+		}
+	}()
+
+	return broker
+}
+
+func (broker *testBroker) url() string {
+	return "tcp://" + broker.listener.Addr().String()
+}
+
+func (broker *testBroker) close() {
+	broker.listener.Close()
+}
+
+func (broker *testBroker) waitSubscribed(t *testing.T, topic string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		broker.mutex.Lock()
+		subscribed := len(broker.subscribers[topic]) > 0
+		broker.mutex.Unlock()
+		if subscribed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("No subscriber for %s", topic)
+}
+
+func (broker *testBroker) serve(conn *brokerConn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		header, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		body, err := readPacketBody(reader)
+		if err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case connectPacket:
+			conn.write(0x20, []byte{0, 0})
+		case publishPacket:
+			topicLength := int(body[0])<<8 | int(body[1])
+			topic := string(body[2 : 2+topicLength])
+			payload := body[2+topicLength:]
+			if qos := (header >> 1) & 3; qos > 0 {
+				conn.write(0x40, payload[:2])
+				payload = payload[2:]
+			}
+			broker.forward(topic, payload)
+		case subscribePacket:
+			granted := append([]byte{}, body[:2]...)
+			for position := 2; position < len(body); {
+				topicLength := int(body[position])<<8 | int(body[position+1])
+				topic := string(body[position+2 : position+2+topicLength])
+				position += 3 + topicLength
+				broker.mutex.Lock()
+				broker.subscribers[topic] = append(broker.subscribers[topic], conn)
+				broker.mutex.Unlock()
+				granted = append(granted, 0)
+			}
+			conn.write(0x90, granted)
+		case unsubscribePacket:
+			conn.write(0xB0, body[:2])
+		case pingPacket:
+			conn.write(0xD0, nil)
+		case disconnectPacket:
+			return
+		}
+	}
+}
+
+func (broker *testBroker) forward(topic string, payload []byte) {
+	body := append([]byte{byte(len(topic) >> 8), byte(len(topic))}, topic...)
+	body = append(body, payload...)
+
+	broker.mutex.Lock()
+	subscribers := broker.subscribers[topic]
+	broker.mutex.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber.write(0x30, body)
+	}
+}
+
+func (conn *brokerConn) write(header byte, body []byte) {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.Write(packet) // nolint: errcheck
+}
+
+func readPacketBody(reader *bufio.Reader) ([]byte, error) {
+	length, multiplier := 0, 1
+	for {
+		digit, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(digit&0x7F) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
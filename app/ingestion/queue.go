@@ -0,0 +1,250 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package ingestion
+
+import (
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/pkg/errors"
+)
+
+// ErrQueueFull is returned when a job could not be queued before the timeout
+var ErrQueueFull = errors.New("ingestion queue is full")
+
+// ErrQueueStopped is returned when a job is queued after the queue was stopped
+var ErrQueueStopped = errors.New("ingestion queue is stopped")
+
+// Job is a decoded payload waiting to be stored
+type Job struct {
+	Batch Batch
+	Rule  Rule
+	// Done is called once the job is stored, or with the error that prevented it
+	Done func(err error)
+
+	enqueued time.Time
+}
+
+// QueueConfig bounds the resources used by the ingestion
+type QueueConfig struct {
+	// Workers is the number of jobs stored concurrently, each holding a database connection
+	Workers int
+	// Depth is the number of jobs waiting to be stored before producers are blocked
+	Depth int
+	// BatchSize is the number of SKUs above which queued jobs are no longer combined
+	BatchSize int
+	// Timeout is how long a producer waits for room in a full queue
+	Timeout time.Duration
+}
+
+// Queue stores decoded payloads with a bounded number of workers, combining small
+// jobs waiting in the queue into a single store call
+type Queue struct {
+	config QueueConfig
+	store  Store
+	jobs   chan Job
+
+	mutex   sync.RWMutex
+	stopped bool
+	workers sync.WaitGroup
+}
+
+// NewQueue starts the workers of an ingestion queue
+func NewQueue(config QueueConfig, store Store) *Queue {
+
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.Depth < 0 {
+		config.Depth = 0
+	}
+
+	queue := &Queue{
+		config: config,
+		store:  store,
+		jobs:   make(chan Job, config.Depth),
+	}
+
+	queue.workers.Add(config.Workers)
+	for i := 0; i < config.Workers; i++ {
+		go queue.work()
+	}
+
+	return queue
+}
+
+// Enqueue adds a job to the queue, waiting up to the configured timeout when it is full, or not at all
+// when the timeout is not positive.
+// ErrQueueFull tells the producer to slow down, the job being left to the caller.
+func (queue *Queue) Enqueue(job Job) error {
+
+	// Metrics
+	mRejected := metrics.GetOrRegisterGauge(`Product-Data.Queue.Rejected`, nil)
+	mLength := metrics.GetOrRegisterGauge(`Product-Data.Queue.Length`, nil)
+
+	queue.mutex.RLock()
+	defer queue.mutex.RUnlock()
+
+	if queue.stopped {
+		return ErrQueueStopped
+	}
+
+	job.enqueued = time.Now()
+
+	// The timer is only started once the queue is full, as a ready timer could be picked over a free slot
+	select {
+	case queue.jobs <- job:
+		mLength.Update(int64(len(queue.jobs)))
+		return nil
+	default:
+	}
+	if queue.config.Timeout <= 0 {
+		mRejected.Update(1)
+		return ErrQueueFull
+	}
+
+	timer := time.NewTimer(queue.config.Timeout)
+	defer timer.Stop()
+
+	select {
+	case queue.jobs <- job:
+		mLength.Update(int64(len(queue.jobs)))
+		return nil
+	case <-timer.C:
+		mRejected.Update(1)
+		return ErrQueueFull
+	}
+}
+
+// Length returns the number of jobs waiting in the queue
+func (queue *Queue) Length() int {
+	return len(queue.jobs)
+}
+
+// Stop stops accepting jobs and waits for the queued ones to be stored
+func (queue *Queue) Stop() {
+
+	queue.mutex.Lock()
+	if !queue.stopped {
+		queue.stopped = true
+		close(queue.jobs)
+	}
+	queue.mutex.Unlock()
+
+	queue.workers.Wait()
+}
+
+func (queue *Queue) work() {
+	defer queue.workers.Done()
+
+	// carry is a job taken from the queue that could not be combined with the previous ones
+	var carry *Job
+
+	for {
+		var job Job
+		if carry != nil {
+			job, carry = *carry, nil
+		} else {
+			var ok bool
+			if job, ok = <-queue.jobs; !ok {
+				return
+			}
+		}
+
+		jobs := []Job{job}
+		skus := make(map[string]bool)
+		addSkus(skus, job.Batch)
+
+		// Combine the jobs already waiting, as long as they can be stored together
+		for len(skus) < queue.config.BatchSize && carry == nil {
+			var next Job
+			var ok bool
+			select {
+			case next, ok = <-queue.jobs:
+			default:
+			}
+			if !ok {
+				break
+			}
+			if !combinable(job, next, skus) {
+				carry = &next
+				break
+			}
+			jobs = append(jobs, next)
+			addSkus(skus, next.Batch)
+		}
+
+		queue.process(jobs)
+	}
+}
+
+// process stores the jobs in a single call, falling back to one call per job on failure
+// so that the error is reported to the job that caused it
+func (queue *Queue) process(jobs []Job) {
+
+	// Metrics
+	mLength := metrics.GetOrRegisterGauge(`Product-Data.Queue.Length`, nil)
+	mLag := metrics.GetOrRegisterTimer(`Product-Data.Queue.Lag`, nil)
+	mCombined := metrics.GetOrRegisterGaugeCollection(`Product-Data.Queue.Combined-Jobs`, nil)
+	mStoreLatency := metrics.GetOrRegisterTimer(`Product-Data.Queue.Store-Latency`, nil)
+
+	mLength.Update(int64(len(queue.jobs)))
+	for _, job := range jobs {
+		mLag.Update(time.Since(job.enqueued))
+	}
+	mCombined.Add(int64(len(jobs)))
+
+	startTime := time.Now()
+	defer func() { mStoreLatency.Update(time.Since(startTime)) }()
+
+	if len(jobs) == 1 {
+		jobs[0].done(queue.store(jobs[0].Batch, jobs[0].Rule))
+		return
+	}
+
+	combined := Batch{SentOn: jobs[0].Batch.SentOn}
+	for _, job := range jobs {
+		combined.SKUs = append(combined.SKUs, job.Batch.SKUs...)
+	}
+
+	if err := queue.store(combined, jobs[0].Rule); err == nil {
+		for _, job := range jobs {
+			job.done(nil)
+		}
+		return
+	}
+
+	for _, job := range jobs {
+		job.done(queue.store(job.Batch, job.Rule))
+	}
+}
+
+func (job Job) done(err error) {
+	if job.Done != nil {
+		job.Done(err)
+	}
+}
+
+// combinable tells whether a job can be stored along with the previous ones. The SKUs must
+// be distinct, as storing the same SKU twice in one call would not see the first update.
+func combinable(first Job, next Job, skus map[string]bool) bool {
+	if next.Rule.Mode != first.Rule.Mode || next.Batch.SentOn != first.Batch.SentOn {
+		return false
+	}
+	for _, sku := range next.Batch.SKUs {
+		if skus[sku.SKU] {
+			return false
+		}
+	}
+	return true
+}
+
+func addSkus(skus map[string]bool, batch Batch) {
+	for _, sku := range batch.SKUs {
+		skus[sku.SKU] = true
+	}
+}
@@ -0,0 +1,149 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package ingestion
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/productdata"
+	"github.com/pkg/errors"
+)
+
+func TestQueueCombinesJobs(t *testing.T) {
+
+	var mutex sync.Mutex
+	var calls [][]string
+	started := make(chan struct{}, 1)
+	block := make(chan struct{})
+
+	store := func(batch Batch, rule Rule) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-block
+		mutex.Lock()
+		defer mutex.Unlock()
+		var skus []string
+		for _, sku := range batch.SKUs {
+			skus = append(skus, sku.SKU)
+		}
+		calls = append(calls, skus)
+		for _, sku := range skus {
+			if sku == "broken" {
+				return errors.New("unable to store")
+			}
+		}
+		return nil
+	}
+
+	queue := NewQueue(QueueConfig{Workers: 1, Depth: 10, BatchSize: 100, Timeout: time.Second}, store)
+
+	results := make(map[string]error)
+	enqueue := func(skus ...string) {
+		batch := Batch{}
+		for _, sku := range skus {
+			batch.SKUs = append(batch.SKUs, productdata.SKUData{SKU: sku})
+		}
+		name := strings.Join(skus, ",")
+		job := Job{Batch: batch, Rule: DefaultRule, Done: func(err error) {
+			mutex.Lock()
+			results[name] = err
+			mutex.Unlock()
+		}}
+		if err := queue.Enqueue(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first job keeps the worker busy while the others wait in the queue
+	enqueue("first")
+	<-started
+	enqueue("a")
+	enqueue("b")
+	enqueue("a", "c") // same SKU as a waiting job, stored after them
+	enqueue("broken")
+	close(block)
+	queue.Stop()
+
+	expected := [][]string{{"first"}, {"a", "b"}, {"a", "c", "broken"}, {"a", "c"}, {"broken"}}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected store calls %v, but got %v", expected, calls)
+	}
+
+	for name, err := range results {
+		if (err != nil) != strings.Contains(name, "broken") {
+			t.Errorf("Unexpected result for %s: %v", name, err)
+		}
+	}
+	if len(results) != 5 {
+		t.Errorf("Expected 5 jobs to be done, but got %d", len(results))
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+
+	block := make(chan struct{})
+	queue := NewQueue(QueueConfig{Workers: 1, Depth: 1, BatchSize: 1, Timeout: 10 * time.Millisecond},
+		func(batch Batch, rule Rule) error {
+			<-block
+			return nil
+		})
+
+	job := Job{Batch: Batch{SKUs: []productdata.SKUData{{SKU: "12345678"}}}, Rule: DefaultRule}
+
+	// One job is being stored and one is waiting
+	if err := queue.Enqueue(job); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := queue.Enqueue(job); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := queue.Enqueue(job); err != ErrQueueFull {
+		t.Errorf("Expected the queue to be full, but got %v", err)
+	}
+
+	close(block)
+	queue.Stop()
+
+	if err := queue.Enqueue(job); err != ErrQueueStopped {
+		t.Errorf("Expected the queue to be stopped, but got %v", err)
+	}
+}
+
+func TestQueueWithoutTimeout(t *testing.T) {
+
+	block := make(chan struct{})
+	queue := NewQueue(QueueConfig{Workers: 1, Depth: 10, BatchSize: 1}, func(batch Batch, rule Rule) error {
+		<-block
+		return nil
+	})
+
+	// Jobs are queued while there is room, and rejected right away once the queue is full
+	job := Job{Batch: Batch{SKUs: []productdata.SKUData{{SKU: "12345678"}}}, Rule: DefaultRule}
+	for i := 0; i < 10; i++ {
+		if err := queue.Enqueue(job); err != nil {
+			t.Fatalf("Expected job %d to be queued, but got %v", i, err)
+		}
+	}
+	for queue.Length() < 10 {
+		if err := queue.Enqueue(job); err != nil {
+			t.Fatalf("Expected the job to be queued, but got %v", err)
+		}
+	}
+	if err := queue.Enqueue(job); err != ErrQueueFull {
+		t.Errorf("Expected the queue to be full, but got %v", err)
+	}
+
+	close(block)
+	queue.Stop()
+}
@@ -0,0 +1,112 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package ingestion
+
+import (
+	"strings"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/productdata"
+	"github.com/pkg/errors"
+)
+
+// wildcard matches any device or value descriptor in a rule key
+const wildcard = "*"
+
+// fieldPrefix introduces a rule attribute renaming a payload field, such as "fields.upc": "gtin"
+const fieldPrefix = "fields."
+
+// IncomingDataFormat is the base64 encoded JSON array of productdata.IncomingData sent by the Broker
+const IncomingDataFormat = "incomingData"
+
+// Rule describes how the readings of a device and value descriptor are ingested
+type Rule struct {
+	// Mode tells how the products are combined with the stored ones
+	Mode productdata.Mode
+	// Format is the payload format of the readings
+	Format string
+	// Fields maps the field names used by the source to the ones of the format
+	Fields map[string]string
+}
+
+// DefaultRule applies to readings not matching any configured rule
+var DefaultRule = Rule{Mode: productdata.MergeMode, Format: IncomingDataFormat}
+
+// Rules maps devices and value descriptors to the way their readings are ingested
+type Rules struct {
+	rules map[string]Rule
+}
+
+// NewRules builds the rules from the configuration, which maps a key to the "mode", "format"
+// and "fields.<name>" renames of the matching readings. A key is either a device name or
+// "device/valueDescriptor", where "*" matches any device or value descriptor.
+func NewRules(config map[string]map[string]string) (Rules, error) {
+
+	rules := Rules{rules: make(map[string]Rule, len(config))}
+
+	for key, values := range config {
+		rule := DefaultRule
+
+		for name, value := range values {
+			switch name {
+			case "mode":
+				mode := productdata.Mode(value)
+				if mode != productdata.MergeMode && mode != productdata.ReplaceMode {
+					return Rules{}, errors.Errorf("invalid ingestion mode '%s' for '%s'", value, key)
+				}
+				rule.Mode = mode
+			case "format":
+				if !knownFormat(value) {
+					return Rules{}, errors.Errorf("invalid payload format '%s' for '%s'", value, key)
+				}
+				rule.Format = value
+			default:
+				if strings.HasPrefix(name, fieldPrefix) && value != "" {
+					if rule.Fields == nil {
+						rule.Fields = make(map[string]string)
+					}
+					rule.Fields[value] = strings.TrimPrefix(name, fieldPrefix)
+					continue
+				}
+				return Rules{}, errors.Errorf("unknown ingestion rule attribute '%s' for '%s'", name, key)
+			}
+		}
+
+		device, valueDescriptor := splitKey(key)
+		rules.rules[device+"/"+valueDescriptor] = rule
+	}
+
+	return rules, nil
+}
+
+// Match returns the rule of a reading, preferring the most specific key
+func (rules Rules) Match(device string, valueDescriptor string) Rule {
+
+	candidates := []string{
+		device + "/" + valueDescriptor,
+		device + "/" + wildcard,
+		wildcard + "/" + valueDescriptor,
+		wildcard + "/" + wildcard,
+	}
+
+	for _, key := range candidates {
+		if rule, ok := rules.rules[key]; ok {
+			return rule
+		}
+	}
+
+	return DefaultRule
+}
+
+func splitKey(key string) (string, string) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) == 1 || parts[1] == "" {
+		return parts[0], wildcard
+	}
+	if parts[0] == "" {
+		return wildcard, parts[1]
+	}
+	return parts[0], parts[1]
+}
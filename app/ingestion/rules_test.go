@@ -0,0 +1,63 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package ingestion
+
+import (
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/productdata"
+)
+
+func TestNewRulesInvalid(t *testing.T) {
+
+	testCases := []map[string]map[string]string{
+		{"SKU_Data_Device": {"mode": "append"}},
+		{"SKU_Data_Device": {"format": "unknown"}},
+		{"SKU_Data_Device": {"color": "blue"}},
+	}
+
+	for _, config := range testCases {
+		if _, err := NewRules(config); err == nil {
+			t.Errorf("Expected an error for %v", config)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+
+	rules, err := NewRules(map[string]map[string]string{
+		"SKU_Data_Device":      {"mode": "merge"},
+		"SKU_Data_Device/full": {"mode": "replace"},
+		"*/catalog":            {"mode": "replace"},
+		"ERP_Device/*":         {"mode": "merge"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		device          string
+		valueDescriptor string
+		expected        productdata.Mode
+	}{
+		{"SKU_Data_Device", "full", productdata.ReplaceMode},
+		{"SKU_Data_Device", "catalog", productdata.MergeMode},
+		{"ERP_Device", "catalog", productdata.MergeMode},
+		{"Other_Device", "catalog", productdata.ReplaceMode},
+		{"Other_Device", "SKU_data", DefaultRule.Mode},
+	}
+
+	for _, testCase := range testCases {
+		rule := rules.Match(testCase.device, testCase.valueDescriptor)
+		if rule.Mode != testCase.expected {
+			t.Errorf("Expected mode %s for %s/%s, but got %s",
+				testCase.expected, testCase.device, testCase.valueDescriptor, rule.Mode)
+		}
+		if rule.Format != IncomingDataFormat {
+			t.Errorf("Expected format %s, but got %s", IncomingDataFormat, rule.Format)
+		}
+	}
+}
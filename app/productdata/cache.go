@@ -0,0 +1,185 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package productdata
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+)
+
+// metadataCache holds the results of GetProductMetadata, it is nil until EnableCache is called
+var metadataCache *Cache
+
+// Cache is a least recently used cache of SKUs by product ID whose entries expire after a TTL
+type Cache struct {
+	mutex   sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+	// generation changes on every invalidation, so that lookups started before
+	// a write do not add what they read once the write invalidated it
+	generation uint64
+	now        func() time.Time
+}
+
+type cacheEntry struct {
+	productID string
+	skuData   SKUData
+	expires   time.Time
+}
+
+// NewCache creates a cache holding up to size SKUs for ttl
+func NewCache(size int, ttl time.Duration) *Cache {
+	return &Cache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// EnableCache caches the results of GetProductMetadata, a size of 0 disabling the cache.
+// It must be called before the lookups start.
+func EnableCache(size int, ttl time.Duration) {
+	if size <= 0 || ttl <= 0 {
+		metadataCache = nil
+		return
+	}
+	metadataCache = NewCache(size, ttl)
+}
+
+// FlushCache empties the cache of GetProductMetadata and returns the number of entries removed
+func FlushCache() int {
+	return metadataCache.Flush()
+}
+
+// Get returns the SKU cached for a product ID. On a miss, it returns the generation to pass to Add.
+// The SKU is shared with the cache and must not be modified.
+func (cache *Cache) Get(productID string) (SKUData, uint64, bool) {
+
+	if cache == nil {
+		return SKUData{}, 0, false
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.entries[productID]
+	if !ok {
+		metrics.GetOrRegisterCounter("Product-Data.Cache.Miss", nil).Inc(1)
+		return SKUData{}, cache.generation, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if cache.now().After(entry.expires) {
+		cache.remove(element)
+		metrics.GetOrRegisterCounter("Product-Data.Cache.Expired", nil).Inc(1)
+		metrics.GetOrRegisterCounter("Product-Data.Cache.Miss", nil).Inc(1)
+		return SKUData{}, cache.generation, false
+	}
+
+	cache.order.MoveToFront(element)
+	metrics.GetOrRegisterCounter("Product-Data.Cache.Hit", nil).Inc(1)
+	return entry.skuData, 0, true
+}
+
+// Add caches the SKU of a product ID read from the database, unless the cache
+// was invalidated since the generation returned by Get
+func (cache *Cache) Add(productID string, skuData SKUData, generation uint64) {
+
+	if cache == nil {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if generation != cache.generation {
+		return
+	}
+
+	if element, ok := cache.entries[productID]; ok {
+		cache.remove(element)
+	}
+	cache.entries[productID] = cache.order.PushFront(&cacheEntry{
+		productID: productID,
+		skuData:   skuData,
+		expires:   cache.now().Add(cache.ttl),
+	})
+
+	for cache.order.Len() > cache.size {
+		cache.remove(cache.order.Back())
+		metrics.GetOrRegisterCounter("Product-Data.Cache.Evicted", nil).Inc(1)
+	}
+	metrics.GetOrRegisterGauge("Product-Data.Cache.Size", nil).Update(int64(cache.order.Len()))
+}
+
+// Invalidate removes the entries of the written SKUs, and of their product IDs in case
+// the products were cached as part of another SKU
+func (cache *Cache) Invalidate(skuData []SKUData) {
+
+	if cache == nil {
+		return
+	}
+
+	skus := make(map[string]bool, len(skuData))
+	for _, item := range skuData {
+		skus[item.SKU] = true
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generation++
+
+	var removed int64
+	for _, item := range skuData {
+		for _, product := range item.ProductList {
+			if element, ok := cache.entries[product.ProductID]; ok {
+				cache.remove(element)
+				removed++
+			}
+		}
+	}
+	for _, element := range cache.entries {
+		if skus[element.Value.(*cacheEntry).skuData.SKU] {
+			cache.remove(element)
+			removed++
+		}
+	}
+
+	metrics.GetOrRegisterCounter("Product-Data.Cache.Invalidated", nil).Inc(removed)
+	metrics.GetOrRegisterGauge("Product-Data.Cache.Size", nil).Update(int64(cache.order.Len()))
+}
+
+// Flush removes all the entries and returns how many there were
+func (cache *Cache) Flush() int {
+
+	if cache == nil {
+		return 0
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generation++
+	flushed := cache.order.Len()
+	cache.entries = make(map[string]*list.Element, cache.size)
+	cache.order.Init()
+
+	metrics.GetOrRegisterGauge("Product-Data.Cache.Size", nil).Update(0)
+	return flushed
+}
+
+func (cache *Cache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*cacheEntry).productID)
+}
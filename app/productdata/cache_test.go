@@ -0,0 +1,101 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package productdata
+
+import (
+	"testing"
+	"time"
+)
+
+func cachedSku(sku string, productIDs ...string) SKUData {
+	skuData := SKUData{SKU: sku}
+	for _, productID := range productIDs {
+		skuData.ProductList = append(skuData.ProductList, ProductData{ProductID: productID})
+	}
+	return skuData
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+
+	cache := NewCache(2, time.Minute)
+
+	for _, productID := range []string{"00888446671444", "889319762751"} {
+		_, generation, _ := cache.Get(productID)
+		cache.Add(productID, cachedSku("MS122-32", productID), generation)
+	}
+
+	// The first product is used again, so the second one is evicted
+	if _, _, ok := cache.Get("00888446671444"); !ok {
+		t.Fatal("Expected a cache hit")
+	}
+	_, generation, _ := cache.Get("90388987132758")
+	cache.Add("90388987132758", cachedSku("MS122-34", "90388987132758"), generation)
+
+	if _, _, ok := cache.Get("889319762751"); ok {
+		t.Error("Expected the least recently used product to be evicted")
+	}
+	if _, _, ok := cache.Get("00888446671444"); !ok {
+		t.Error("Expected the recently used product to be kept")
+	}
+}
+
+func TestCacheExpires(t *testing.T) {
+
+	cache := NewCache(10, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	_, generation, _ := cache.Get("00888446671444")
+	cache.Add("00888446671444", cachedSku("MS122-32", "00888446671444"), generation)
+
+	now = now.Add(2 * time.Minute)
+	if _, _, ok := cache.Get("00888446671444"); ok {
+		t.Error("Expected the entry to expire")
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+
+	cache := NewCache(10, time.Minute)
+	for productID, sku := range map[string]string{"00888446671444": "MS122-32", "889319762751": "MS122-32", "90388987132758": "MS122-34"} {
+		_, generation, _ := cache.Get(productID)
+		cache.Add(productID, cachedSku(sku, productID), generation)
+	}
+
+	// A lookup started before the write does not cache what it read
+	_, staleGeneration, _ := cache.Get("12345678912345")
+
+	// The products of a written SKU are invalidated, as well as products moved to it
+	cache.Invalidate([]SKUData{cachedSku("MS122-32", "00888446671444", "12345678912345")})
+	cache.Invalidate([]SKUData{cachedSku("MS122-35", "90388987132758")})
+
+	for _, productID := range []string{"00888446671444", "889319762751", "90388987132758"} {
+		if _, _, ok := cache.Get(productID); ok {
+			t.Errorf("Expected %s to be invalidated", productID)
+		}
+	}
+
+	cache.Add("12345678912345", cachedSku("MS122-33", "12345678912345"), staleGeneration)
+	if _, _, ok := cache.Get("12345678912345"); ok {
+		t.Error("Expected a lookup older than the write not to be cached")
+	}
+
+	_, generation, _ := cache.Get("12345678912345")
+	cache.Add("12345678912345", cachedSku("MS122-32", "12345678912345"), generation)
+	if flushed := cache.Flush(); flushed != 1 {
+		t.Errorf("Expected 1 entry to be flushed, but got %d", flushed)
+	}
+}
+
+func TestDisabledCache(t *testing.T) {
+
+	var cache *Cache
+	cache.Add("00888446671444", cachedSku("MS122-32", "00888446671444"), 0)
+	cache.Invalidate([]SKUData{cachedSku("MS122-32", "00888446671444")})
+	if _, _, ok := cache.Get("00888446671444"); ok || cache.Flush() != 0 {
+		t.Error("Expected a nil cache to cache nothing")
+	}
+}
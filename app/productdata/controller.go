@@ -6,6 +6,7 @@
 package productdata
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
@@ -13,25 +14,39 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	odata "github.com/intel/rsp-sw-toolkit-im-suite-go-odata/postgresql"
+	"github.com/intel/rsp-sw-toolkit-im-suite-gojsonschema"
 	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 const productDataTable = "skus"
 const jsonbColumn = "data"
 
+// changes counts the writes of this instance to the SKUs
+var changes uint64
+
+// Changes returns a number that changes whenever this instance writes SKUs, so that what is
+// derived from them knows when to be refreshed
+func Changes() uint64 {
+	return atomic.LoadUint64(&changes)
+}
+
 type prodDataWrapper struct {
 	ID   []uint8 `db:"id" json:"id"`
 	Data SKUData `db:"data" json:"data"`
 }
 
-// Retrieve gets the data out of the DB
-func Retrieve(db *sql.DB, query url.Values, maxSize int) ([]SKUData, *CountType, error) {
+// Retrieve gets the SKUs matching an OData query out of the DB, as stored or as projected by
+// its $select. Queries reaching into the products, like $select=sku,productList/productId or
+// $filter=productList/any(p: p/metadata/color eq 'red'), also trim the products of the SKUs
+// to the matching ones. The query is cancelled with ctx or once it runs for the query timeout.
+func Retrieve(ctx context.Context, db *sql.DB, query url.Values, maxSize int) ([]json.RawMessage, *CountType, error) {
 
 	// Metrics
 	metrics.GetOrRegisterGauge(`Product-Data.Retrieve.Attempt`, nil).Update(1)
@@ -52,15 +67,21 @@ func Retrieve(db *sql.DB, query url.Values, maxSize int) ([]SKUData, *CountType,
 
 		var count int
 
-		row := db.QueryRow("SELECT count(*) FROM skus")
-		err := row.Scan(&count)
+		err := runQuery(ctx, db, "SELECT count(*) FROM skus", func(rows *sql.Rows) error {
+			for rows.Next() {
+				if err := rows.Scan(&count); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 		if err != nil {
 			mCountErr.Update(1)
-			return []SKUData{}, nil, err
+			return []json.RawMessage{}, nil, err
 		}
 
 		mSuccess.Update(1)
-		return []SKUData{}, &CountType{Count: count}, nil
+		return []json.RawMessage{}, &CountType{Count: count}, nil
 	}
 
 	// Apply size limit if needed
@@ -68,7 +89,7 @@ func Retrieve(db *sql.DB, query url.Values, maxSize int) ([]SKUData, *CountType,
 
 		topVal, err := strconv.Atoi(query["$top"][0])
 		if err != nil {
-			return []SKUData{}, nil, web.ValidationError("invalid $top value")
+			return []json.RawMessage{}, nil, web.ValidationError("invalid $top value")
 		}
 
 		if topVal > maxSize {
@@ -79,38 +100,34 @@ func Retrieve(db *sql.DB, query url.Values, maxSize int) ([]SKUData, *CountType,
 		query["$top"] = []string{strconv.Itoa(maxSize)} // Apply size limit to the odata query
 	}
 
-	// Else, run filter query and return slice of SKUData
-	retrieveTimer := time.Now()
-
-	// Run OData PostgreSQL
-	rows, err := odata.ODataSQLQuery(query, productDataTable, jsonbColumn, db)
+	selectQuery, err := odataSelectSQL(query)
 	if err != nil {
-		if errors.Cause(err) == odata.ErrInvalidInput {
-			mInputErr.Update(1)
-			return []SKUData{}, nil, web.InvalidInputError(err)
-		}
-		return []SKUData{}, nil, errors.Wrap(err, "db.Select")
+		mInputErr.Update(1)
+		return []json.RawMessage{}, nil, err
 	}
 
-	defer rows.Close()
+	// Else, run filter query and return slice of SKUs
+	retrieveTimer := time.Now()
 
-	prodSlice := make([]SKUData, 0)
+	prodSlice := make([]json.RawMessage, 0)
 
-	// Loop through the results and append them to a slice
-	for rows.Next() {
+	err = runQuery(ctx, db, selectQuery, func(rows *sql.Rows) error {
+		// Loop through the results and append them to a slice
+		for rows.Next() {
 
-		prodDataWrapper := new(prodDataWrapper)
-		err := rows.Scan(&prodDataWrapper.ID, &prodDataWrapper.Data)
-		if err != nil {
-			mRetrieveErr.Update(1)
-			return []SKUData{}, nil, err
-		}
-		prodSlice = append(prodSlice, prodDataWrapper.Data)
+			var id []uint8
+			var data []byte
+			if err := rows.Scan(&id, &data); err != nil {
+				return err
+			}
+			prodSlice = append(prodSlice, json.RawMessage(data))
 
-	}
-	if err = rows.Err(); err != nil {
+		}
+		return nil
+	})
+	if err != nil {
 		mRetrieveErr.Update(1)
-		return []SKUData{}, nil, err
+		return []json.RawMessage{}, nil, err
 	}
 	mRetrieveLatency.Update(time.Since(retrieveTimer))
 
@@ -122,7 +139,7 @@ func Retrieve(db *sql.DB, query url.Values, maxSize int) ([]SKUData, *CountType,
 		return prodSlice, &CountType{Count: len(prodSlice)}, nil
 	} else if len(countQuery) > 0 {
 		mSuccess.Update(1)
-		return []SKUData{}, &CountType{Count: len(prodSlice)}, nil
+		return []json.RawMessage{}, &CountType{Count: len(prodSlice)}, nil
 	}
 
 	mSuccess.Update(1)
@@ -130,6 +147,39 @@ func Retrieve(db *sql.DB, query url.Values, maxSize int) ([]SKUData, *CountType,
 
 }
 
+// RetrievePositioned gets a page of the SKUs of a relation created from PositionedSQL, such as a
+// materialized view, in the order of their position. The query is cancelled with ctx or once it
+// runs for the query timeout.
+func RetrievePositioned(ctx context.Context, db *sql.DB, relation string, top int, skip int) ([]json.RawMessage, error) {
+
+	if db == nil {
+		return nil, errors.New("No database connection")
+	}
+
+	selectQuery := fmt.Sprintf("SELECT %s FROM %s ORDER BY position LIMIT %d OFFSET %d",
+		pq.QuoteIdentifier(jsonbColumn),
+		pq.QuoteIdentifier(relation),
+		top,
+		skip,
+	)
+
+	results := make([]json.RawMessage, 0)
+	err := runQuery(ctx, db, selectQuery, func(rows *sql.Rows) error {
+		for rows.Next() {
+			var data []byte
+			if err := rows.Scan(&data); err != nil {
+				return err
+			}
+			results = append(results, json.RawMessage(data))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 // Value implements driver.Valuer inferfaces
 func (s SKUData) Value() (driver.Value, error) {
 	return json.Marshal(s)
@@ -145,12 +195,13 @@ func (s *SKUData) Scan(value interface{}) error {
 	return json.Unmarshal(b, &s)
 }
 
-func findAndUpdateSkus(db *sql.DB, skuData *[]SKUData) error {
+// findSkus returns the stored SKUs matching the given ones
+func findSkus(ctx context.Context, db *sql.DB, skuData []SKUData) ([]SKUData, error) {
 
 	var skusList strings.Builder
-	for id, sku := range *skuData {
+	for id, sku := range skuData {
 		skusList.WriteString(pq.QuoteLiteral(sku.SKU))
-		if len(*skuData) > id+1 {
+		if len(skuData) > id+1 {
 			skusList.WriteString(",")
 		}
 	}
@@ -162,9 +213,9 @@ func findAndUpdateSkus(db *sql.DB, skuData *[]SKUData) error {
 		skusList.String(),
 	)
 
-	rows, err := db.Query(selectQuery)
+	rows, err := db.QueryContext(ctx, selectQuery)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -175,18 +226,81 @@ func findAndUpdateSkus(db *sql.DB, skuData *[]SKUData) error {
 		prodDataWrapper := new(prodDataWrapper)
 		err := rows.Scan(&prodDataWrapper.Data)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		prodSlice = append(prodSlice, prodDataWrapper.Data)
 
 	}
 	if err = rows.Err(); err != nil {
-		return err
+		return nil, err
 	}
 
-	mergeProductList(skuData, &prodSlice)
+	return prodSlice, nil
+}
 
-	return nil
+// stampSentOn records when the source sent the SKUs and their products
+func stampSentOn(skuData []SKUData, sentOn int64) {
+	for i := range skuData {
+		skuData[i].LastUpdated = sentOn
+		for j := range skuData[i].ProductList {
+			skuData[i].ProductList[j].LastUpdated = sentOn
+		}
+	}
+}
+
+// discardStale removes the incoming SKUs that are older than the stored ones and returns the
+// remaining ones with the number of products skipped. When merging, a SKU is only removed if all
+// of its products are older, the others being left to mergeProduct.
+func discardStale(incoming []SKUData, current []SKUData, mode Mode) ([]SKUData, int) {
+
+	currentMap := make(map[string]SKUData, len(current))
+	for _, item := range current {
+		currentMap[item.SKU] = item
+	}
+
+	skipped := 0
+	fresh := make([]SKUData, 0, len(incoming))
+
+	for _, item := range incoming {
+		currentSku, ok := currentMap[item.SKU]
+		if !ok {
+			fresh = append(fresh, item)
+			continue
+		}
+
+		stale := 0
+		if mode == ReplaceMode {
+			if currentSku.LastUpdated > item.LastUpdated {
+				stale = len(item.ProductList)
+			}
+		} else {
+			for _, product := range item.ProductList {
+				for _, currentProduct := range currentSku.ProductList {
+					if product.ProductID == currentProduct.ProductID && currentProduct.LastUpdated > product.LastUpdated {
+						stale++
+						break
+					}
+				}
+			}
+		}
+
+		if stale > 0 {
+			log.WithFields(log.Fields{
+				"Method":      "productdata.Upsert",
+				"SKU":         item.SKU,
+				"SentOn":      item.LastUpdated,
+				"LastUpdated": currentSku.LastUpdated,
+				"Stale":       stale,
+			}).Warn("skipping product data older than the stored one")
+			skipped += stale
+		}
+
+		if stale < len(item.ProductList) {
+			fresh = append(fresh, item)
+		}
+	}
+
+	return fresh, skipped
 }
 
 func mergeProductList(incoming *[]SKUData, current *[]SKUData) {
@@ -204,6 +318,10 @@ func mergeProductList(incoming *[]SKUData, current *[]SKUData) {
 			continue
 		}
 
+		if currentSku.LastUpdated > (*incoming)[incomingIndex].LastUpdated {
+			(*incoming)[incomingIndex].LastUpdated = currentSku.LastUpdated
+		}
+
 		var newProductList []ProductData
 
 		for _, product := range (*incoming)[incomingIndex].ProductList {
@@ -211,12 +329,7 @@ func mergeProductList(incoming *[]SKUData, current *[]SKUData) {
 			// Merge ProductIDs eliminating duplicates
 			for _, currentProduct := range currentSku.ProductList {
 				if product.ProductID == currentProduct.ProductID {
-					currentProduct.Metadata = product.Metadata
-					currentProduct.DailyTurn = product.DailyTurn
-					currentProduct.BecomingReadable = product.BecomingReadable
-					currentProduct.BeingRead = product.BeingRead
-					currentProduct.ExitError = product.ExitError
-					newProductList = append(newProductList, currentProduct)
+					newProductList = append(newProductList, mergeProduct(currentProduct, product))
 					found = true
 					break
 				}
@@ -231,8 +344,61 @@ func mergeProductList(incoming *[]SKUData, current *[]SKUData) {
 	}
 }
 
-// Insert receives a slice of sku mapping and inserts them to the database
-func Insert(db *sql.DB, skuData []SKUData) error {
+// mergeProduct applies the attributes supplied in the incoming product to the current one.
+// Attributes and metadata keys that were not supplied keep their current values,
+// and metadata keys set to null are removed. The current product is kept as is when
+// it was updated by a more recent source event.
+func mergeProduct(current ProductData, incoming ProductData) ProductData {
+
+	if incoming.LastUpdated > 0 {
+		if current.LastUpdated > incoming.LastUpdated {
+			return current
+		}
+		current.LastUpdated = incoming.LastUpdated
+	}
+
+	if incoming.has("beingRead") {
+		current.BeingRead = incoming.BeingRead
+	}
+	if incoming.has("becomingReadable") {
+		current.BecomingReadable = incoming.BecomingReadable
+	}
+	if incoming.has("exitError") {
+		current.ExitError = incoming.ExitError
+	}
+	if incoming.has("dailyTurn") {
+		current.DailyTurn = incoming.DailyTurn
+	}
+	if incoming.has("metadata") && incoming.Metadata != nil {
+		metadata := make(map[string]interface{}, len(current.Metadata)+len(incoming.Metadata))
+		for key, value := range current.Metadata {
+			metadata[key] = value
+		}
+		for key, value := range incoming.Metadata {
+			if value == nil {
+				delete(metadata, key)
+				continue
+			}
+			metadata[key] = value
+		}
+		current.Metadata = metadata
+	}
+
+	return current
+}
+
+// Insert receives a slice of sku mapping and inserts them to the database,
+// merging the products with the ones already stored
+func Insert(ctx context.Context, db *sql.DB, skuData []SKUData) error {
+	return Upsert(ctx, db, skuData, MergeMode, 0)
+}
+
+// Upsert receives a slice of sku mapping and inserts them to the database,
+// combining the products with the ones already stored according to mode.
+// sentOn is when the source sent the data, in milliseconds since epoch. When set, it is recorded
+// as the lastUpdated of the SKUs and products, and data older than the stored one is skipped.
+// The writes are cancelled with ctx, but not bounded by the query timeout since batches can be large.
+func Upsert(ctx context.Context, db *sql.DB, skuData []SKUData, mode Mode, sentOn int64) error {
 
 	// Metrics
 	metrics.GetOrRegisterGauge(`Product-Data.Insert.Attempt`, nil).Update(1)
@@ -240,6 +406,7 @@ func Insert(db *sql.DB, skuData []SKUData) error {
 	mInsertErr := metrics.GetOrRegisterGauge("Product-Data.Insert.Insert-Error", nil)
 	mInsertLatency := metrics.GetOrRegisterTimer(`Product-Data.Insert.Insert-Latency`, nil)
 	mSkuInsertCount := metrics.GetOrRegisterGaugeCollection("Product-Data.Insert.Count", nil)
+	mStaleCount := metrics.GetOrRegisterGaugeCollection("Product-Data.Insert.Stale-Count", nil)
 
 	// TODO: Consider a total bytes processed metric for this function.  Check with dev team.
 
@@ -248,9 +415,31 @@ func Insert(db *sql.DB, skuData []SKUData) error {
 	//Create Bulk upsert interface input
 	skus := make([]interface{}, len(skuData)*2)
 
+	if sentOn > 0 {
+		stampSentOn(skuData, sentOn)
+	}
+
 	// Find and merge product list with existing data in db
-	if err := findAndUpdateSkus(db, &skuData); err != nil {
-		return err
+	if mode == MergeMode || sentOn > 0 {
+		current, err := findSkus(ctx, db, skuData)
+		if err != nil {
+			return err
+		}
+
+		if sentOn > 0 {
+			var skipped int
+			if skuData, skipped = discardStale(skuData, current, mode); skipped > 0 {
+				mStaleCount.Add(int64(skipped))
+			}
+			if len(skuData) == 0 {
+				mSuccess.Update(1)
+				return nil
+			}
+		}
+
+		if mode == MergeMode {
+			mergeProductList(&skuData, &current)
+		}
 	}
 
 	var upsertStmt strings.Builder
@@ -280,9 +469,19 @@ func Insert(db *sql.DB, skuData []SKUData) error {
 		//  "productList": [ {"productId": "12345678912345", "metadata": {"color":"red"} } ]
 		//  }';
 
+		// A SKU updated by a more recent source event in the meantime is left untouched
+		var staleGuard string
+		if item.LastUpdated > 0 {
+			staleGuard = fmt.Sprintf(" WHERE COALESCE((%s.%s ->> 'lastUpdated')::bigint, 0) <= %d",
+				pq.QuoteIdentifier(productDataTable),
+				pq.QuoteIdentifier(jsonbColumn),
+				item.LastUpdated,
+			)
+		}
+
 		upsertClause := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) 
 									 ON CONFLICT (( %s  ->> 'sku' )) 
-									 DO UPDATE SET %s = %s.%s || %s; `,
+									 DO UPDATE SET %s = %s.%s || %s%s; `,
 			pq.QuoteIdentifier(productDataTable),
 			pq.QuoteIdentifier(jsonbColumn),
 			pq.QuoteLiteral(string(obj)),
@@ -291,6 +490,7 @@ func Insert(db *sql.DB, skuData []SKUData) error {
 			pq.QuoteIdentifier(productDataTable),
 			pq.QuoteIdentifier(jsonbColumn),
 			pq.QuoteLiteral(string(obj)),
+			staleGuard,
 		)
 
 		// Making all upsert sql statements into one network call
@@ -299,7 +499,10 @@ func Insert(db *sql.DB, skuData []SKUData) error {
 	}
 
 	// Not able to implement transactions since they do not support multiple sql statements
-	_, err := db.Exec(upsertStmt.String())
+	_, err := db.ExecContext(ctx, upsertStmt.String())
+	// Some of the statements may have been applied even when others failed
+	metadataCache.Invalidate(skuData)
+	atomic.AddUint64(&changes, 1)
 	if err != nil {
 		mInsertErr.Update(1)
 		return err
@@ -311,6 +514,180 @@ func Insert(db *sql.DB, skuData []SKUData) error {
 	return nil
 }
 
+// ETag returns the entity tag of a SKU document, which changes whenever any of its products does
+func ETag(skuData SKUData) (string, error) {
+	obj, err := json.Marshal(skuData)
+	if err != nil {
+		return "", err
+	}
+	return web.ETag(obj), nil
+}
+
+// GetSku looks up and returns the document of a SKU
+func GetSku(ctx context.Context, db *sql.DB, sku string) (SKUData, error) {
+
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	selectQuery := fmt.Sprintf("SELECT %s FROM %s WHERE %s ->> 'sku' = $1",
+		pq.QuoteIdentifier(jsonbColumn),
+		pq.QuoteIdentifier(productDataTable),
+		pq.QuoteIdentifier(jsonbColumn),
+	)
+
+	var skuData SKUData
+	if err := db.QueryRowContext(ctx, selectQuery, sku).Scan(&skuData); err != nil {
+		if err == sql.ErrNoRows {
+			return SKUData{}, web.NotFoundError()
+		}
+		return SKUData{}, queryError(ctx, err, "db.Select")
+	}
+	return skuData, nil
+}
+
+// PatchProduct applies a JSON Merge Patch (RFC 7396) to a product of a SKU and returns the updated
+// product along with the new ETag of the SKU. When ifMatch is set, the patch is only applied if it
+// matches the current ETag of the SKU, which is checked while the SKU is locked. The transaction
+// is rolled back when ctx is cancelled before it is committed.
+func PatchProduct(ctx context.Context, db *sql.DB, sku string, productID string, ifMatch string, patch map[string]interface{}) (ProductData, string, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Product-Data.PatchProduct.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Product-Data.PatchProduct.Success`, nil)
+	mPatchErr := metrics.GetOrRegisterGauge("Product-Data.PatchProduct.Patch-Error", nil)
+	mPatchLatency := metrics.GetOrRegisterTimer(`Product-Data.PatchProduct.Patch-Latency`, nil)
+
+	startTime := time.Now()
+
+	if value, ok := patch["productId"]; ok && value != productID {
+		return ProductData{}, "", web.ValidationError("productId cannot be modified")
+	}
+	if _, ok := patch["lastUpdated"]; ok {
+		return ProductData{}, "", web.ValidationError("lastUpdated is set by the source events and cannot be modified")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		mPatchErr.Update(1)
+		return ProductData{}, "", err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback() // nolint: errcheck
+
+	selectQuery := fmt.Sprintf("SELECT %s FROM %s WHERE %s ->> 'sku' = $1 FOR UPDATE",
+		pq.QuoteIdentifier(jsonbColumn),
+		pq.QuoteIdentifier(productDataTable),
+		pq.QuoteIdentifier(jsonbColumn),
+	)
+
+	var skuData SKUData
+	if err := tx.QueryRowContext(ctx, selectQuery, sku).Scan(&skuData); err != nil {
+		if err == sql.ErrNoRows {
+			return ProductData{}, "", web.NotFoundError()
+		}
+		mPatchErr.Update(1)
+		return ProductData{}, "", err
+	}
+
+	if ifMatch != "" {
+		etag, err := ETag(skuData)
+		if err != nil {
+			return ProductData{}, "", err
+		}
+		if !web.EntityETagMatches(ifMatch, etag) {
+			metrics.GetOrRegisterGauge("Product-Data.PatchProduct.Precondition-Failed", nil).Update(1)
+			return ProductData{}, "", web.PreconditionFailedError()
+		}
+	}
+
+	index := -1
+	for i, product := range skuData.ProductList {
+		if product.ProductID == productID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return ProductData{}, "", web.NotFoundError()
+	}
+
+	product, err := applyProductPatch(skuData.ProductList[index], patch)
+	if err != nil {
+		return ProductData{}, "", err
+	}
+	skuData.ProductList[index] = product
+
+	obj, err := json.Marshal(skuData)
+	if err != nil {
+		return ProductData{}, "", err
+	}
+
+	updateQuery := fmt.Sprintf("UPDATE %s SET %s = $1 WHERE %s ->> 'sku' = $2",
+		pq.QuoteIdentifier(productDataTable),
+		pq.QuoteIdentifier(jsonbColumn),
+		pq.QuoteIdentifier(jsonbColumn),
+	)
+
+	if _, err := tx.ExecContext(ctx, updateQuery, string(obj), sku); err != nil {
+		mPatchErr.Update(1)
+		return ProductData{}, "", err
+	}
+
+	err = tx.Commit()
+	metadataCache.Invalidate([]SKUData{skuData})
+	if err != nil {
+		mPatchErr.Update(1)
+		return ProductData{}, "", err
+	}
+	atomic.AddUint64(&changes, 1)
+
+	mPatchLatency.Update(time.Since(startTime))
+	mSuccess.Update(1)
+	return product, web.ETag(obj), nil
+}
+
+// applyProductPatch merges the patch into the product and validates the result against ProductSchema
+func applyProductPatch(product ProductData, patch map[string]interface{}) (ProductData, error) {
+
+	current, err := json.Marshal(product)
+	if err != nil {
+		return ProductData{}, err
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(current, &document); err != nil {
+		return ProductData{}, err
+	}
+
+	document = mergePatch(document, patch)
+
+	schemaLoader := gojsonschema.NewStringLoader(ProductSchema)
+	result, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewGoLoader(document))
+	if err != nil {
+		return ProductData{}, web.InvalidInputError(err)
+	}
+
+	if !result.Valid() {
+		descriptions := make([]string, 0, len(result.Errors()))
+		for _, resultErr := range result.Errors() {
+			descriptions = append(descriptions, resultErr.String())
+		}
+		return ProductData{}, web.ValidationError(strings.Join(descriptions, "; "))
+	}
+
+	patched, err := json.Marshal(document)
+	if err != nil {
+		return ProductData{}, err
+	}
+
+	var patchedProduct ProductData
+	if err := json.Unmarshal(patched, &patchedProduct); err != nil {
+		return ProductData{}, err
+	}
+
+	return patchedProduct, nil
+}
+
 func removeDuplicateProducts(productItems []ProductData) []ProductData {
 
 	productMap := make(map[string]bool)
@@ -328,8 +705,9 @@ func removeDuplicateProducts(productItems []ProductData) []ProductData {
 
 }
 
-// GetProductMetadata receives a product ID (upc) and looks up and returns the corresponding metadata
-func GetProductMetadata(db *sql.DB, productID string) (SKUData, error) {
+// GetProductMetadata receives a product ID (upc) and looks up and returns the corresponding metadata,
+// from the cache when it is enabled
+func GetProductMetadata(ctx context.Context, db *sql.DB, productID string) (SKUData, error) {
 
 	metrics.GetOrRegisterGauge("Product-Data.GetProductMetadata.Attempt", nil).Update(1)
 	startTime := time.Now()
@@ -337,7 +715,11 @@ func GetProductMetadata(db *sql.DB, productID string) (SKUData, error) {
 	mSuccess := metrics.GetOrRegisterGauge("Product-Data.GetProductMetadata.Success", nil)
 	mDbErr := metrics.GetOrRegisterGauge("Product-Data.GetProductMetadata.DbError", nil)
 
-	var skuData SKUData
+	skuData, generation, ok := metadataCache.Get(productID)
+	if ok {
+		mSuccess.Update(1)
+		return skuData, nil
+	}
 
 	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s -> 'productList' @> '[{"productId": %s }]' LIMIT 1`,
 		pq.QuoteIdentifier(jsonbColumn),
@@ -346,7 +728,10 @@ func GetProductMetadata(db *sql.DB, productID string) (SKUData, error) {
 		pq.QuoteIdentifier(productID),
 	)
 
-	if err := db.QueryRow(selectQuery).Scan(&skuData); err != nil {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if err := db.QueryRowContext(ctx, selectQuery).Scan(&skuData); err != nil {
 
 		if err == sql.ErrNoRows {
 			mSuccess.Update(1)
@@ -354,9 +739,73 @@ func GetProductMetadata(db *sql.DB, productID string) (SKUData, error) {
 		}
 
 		mDbErr.Update(1)
-		return SKUData{}, err
+		return SKUData{}, queryError(ctx, err, "db.Select")
 	}
 
+	metadataCache.Add(productID, skuData, generation)
 	mSuccess.Update(1)
 	return skuData, nil
 }
+
+// GetProduct looks up the product of a product ID along with its SKU and the IDs of the other products
+// of the SKU, from the cache when it is enabled. Only the metadata keys listed in fields are returned,
+// all of them being returned when fields is empty.
+func GetProduct(ctx context.Context, db *sql.DB, productID string, fields []string) (SKUProduct, error) {
+
+	skuData, err := GetProductMetadata(ctx, db, productID)
+	if err != nil {
+		return SKUProduct{}, err
+	}
+
+	product, ok := findProduct(skuData, productID, fields)
+	if !ok {
+		return SKUProduct{}, web.NotFoundError()
+	}
+	return product, nil
+}
+
+// findProduct picks the product of a product ID among the products of its SKU. The metadata is copied,
+// the SKU being shared with the cache.
+func findProduct(skuData SKUData, productID string, fields []string) (SKUProduct, bool) {
+
+	found := false
+	result := SKUProduct{SKU: skuData.SKU, SiblingProductIDs: []string{}}
+	for _, product := range skuData.ProductList {
+		if product.ProductID != productID {
+			result.SiblingProductIDs = append(result.SiblingProductIDs, product.ProductID)
+			continue
+		}
+		if !found {
+			result.ProductData = product
+			found = true
+		}
+	}
+	if !found {
+		return SKUProduct{}, false
+	}
+
+	result.Metadata = selectMetadata(result.Metadata, fields)
+	return result, true
+}
+
+// selectMetadata copies the metadata keys listed in fields, or all of them when fields is empty
+func selectMetadata(metadata map[string]interface{}, fields []string) map[string]interface{} {
+
+	if metadata == nil {
+		return nil
+	}
+
+	selected := make(map[string]interface{}, len(metadata))
+	if len(fields) == 0 {
+		for key, value := range metadata {
+			selected[key] = value
+		}
+		return selected
+	}
+	for _, field := range fields {
+		if value, ok := metadata[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected
+}
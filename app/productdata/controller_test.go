@@ -6,6 +6,7 @@
 package productdata
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"reflect"
 	"strconv"
 	"testing"
 
@@ -54,7 +56,7 @@ func TestInsertDuplicateProductIDsSKUMapping(t *testing.T) {
 		t.Error("Failed to parse test URL")
 	}
 
-	result, _, err := Retrieve(db, testURL.Query(), 100)
+	result, _, err := Retrieve(context.Background(), db, testURL.Query(), 100)
 	if err != nil {
 		t.Fatalf("Error reteiving SKUs: %s", err.Error())
 	}
@@ -84,7 +86,7 @@ func TestRetrieveCount(t *testing.T) {
 
 	insertSampleData(db, t)
 
-	results, count, err := Retrieve(db, testURL.Query(), 1000)
+	results, count, err := Retrieve(context.Background(), db, testURL.Query(), 1000)
 	if err != nil {
 		t.Error("Unable to retrieve SKUs")
 	}
@@ -107,7 +109,7 @@ func TestRetrieveCountWithFilterQuery(t *testing.T) {
 
 	insertSampleData(db, t)
 
-	results, count, err := Retrieve(db, testURL.Query(), 1000)
+	results, count, err := Retrieve(context.Background(), db, testURL.Query(), 1000)
 	if err != nil {
 		t.Errorf("Unable to retrieve SKUs. Error: %s", err.Error())
 	}
@@ -132,7 +134,7 @@ func TestRetrieveInlinecount(t *testing.T) {
 
 	insertSampleData(db, t)
 
-	results, count, err := Retrieve(db, testURL.Query(), 1000)
+	results, count, err := Retrieve(context.Background(), db, testURL.Query(), 1000)
 
 	if count == nil {
 		t.Error("expecting inlinecount result")
@@ -154,7 +156,7 @@ func TestRetrieveCountNoDatabase(t *testing.T) {
 	}
 
 	// No database session, so query should fail
-	if _, _, err = Retrieve(nil, testURL.Query(), 1000); err == nil {
+	if _, _, err = Retrieve(context.Background(), nil, testURL.Query(), 1000); err == nil {
 		t.Error("Expected an error, but Retrieve returned a value")
 	}
 }
@@ -169,13 +171,43 @@ func TestRetrieveWithFilter(t *testing.T) {
 
 	insertSampleData(db, t)
 
-	_, _, err = Retrieve(db, testURL.Query(), 1000)
+	_, _, err = Retrieve(context.Background(), db, testURL.Query(), 1000)
 	if err != nil {
 		t.Errorf("Retrieve failed with error %v", err.Error())
 	}
 
 }
 
+func TestRetrieveNestedQuery(t *testing.T) {
+
+	db := dbSetup(t)
+
+	insertSampleData(db, t)
+
+	query := url.Values{
+		"$filter": {"productList/any(p: p/productId eq 'test')"},
+		"$select": {"sku,productList/productId"},
+	}
+	results, _, err := Retrieve(context.Background(), db, query, 1000)
+	if err != nil {
+		t.Fatalf("Retrieve failed with error %v", err)
+	}
+
+	bytes, _ := json.Marshal(results)
+	expected := `[{"sku":"MS122-32","productList":[{"productId":"test"}]}]`
+	if string(bytes) != expected {
+		t.Errorf("Expected %s, but got %s", expected, bytes)
+	}
+
+	count, err := Count(context.Background(), db, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 SKU, but counted %d", count)
+	}
+}
+
 func TestRetrieveSizeLimitWithTop(t *testing.T) {
 
 	var sizeLimit = 1
@@ -190,7 +222,7 @@ func TestRetrieveSizeLimitWithTop(t *testing.T) {
 
 	insertSampleData(db, t)
 
-	results, count, err := Retrieve(db, testURL.Query(), sizeLimit)
+	results, count, err := Retrieve(context.Background(), db, testURL.Query(), sizeLimit)
 	if err != nil {
 		t.Errorf("Retrieve failed with error %v", err.Error())
 	}
@@ -213,7 +245,7 @@ func TestRetrieveSizeLimitInvalidTop(t *testing.T) {
 
 	db := dbSetup(t)
 
-	_, _, err = Retrieve(db, testURL.Query(), sizeLimit)
+	_, _, err = Retrieve(context.Background(), db, testURL.Query(), sizeLimit)
 	if err == nil {
 		t.Errorf("Expecting an error for invalid $top value")
 	}
@@ -230,7 +262,7 @@ func TestRetrieveWithBadQuery(t *testing.T) {
 
 	insertSampleData(db, t)
 
-	_, _, err = Retrieve(db, testURL.Query(), 1000)
+	_, _, err = Retrieve(context.Background(), db, testURL.Query(), 1000)
 	if err == nil {
 		t.Error("Expected an error, but Retrieve function returned a value")
 	}
@@ -257,7 +289,7 @@ func insertSampleData(db *sql.DB, t *testing.T) []SKUData {
 		t.Fatal("Not able to Unmarshal JSON object: " + err.Error())
 	}
 
-	if err := Insert(db, expectedMappings); err != nil {
+	if err := Insert(context.Background(), db, expectedMappings); err != nil {
 		t.Error("Not able to insert into database: " + err.Error())
 	}
 
@@ -282,7 +314,7 @@ func insertSampleDuplicateData(db *sql.DB, t *testing.T) []SKUData {
 		t.Fatal("Not able to Unmarshal JSON object: " + err.Error())
 	}
 
-	if err := Insert(db, expectedMappings); err != nil {
+	if err := Insert(context.Background(), db, expectedMappings); err != nil {
 		t.Error("Not able to insert into database: " + err.Error())
 	}
 
@@ -314,7 +346,7 @@ func TestBulkInsert(t *testing.T) {
 		expectedMappings[i] = mapObj
 	}
 
-	if err := Insert(db, expectedMappings); err != nil {
+	if err := Insert(context.Background(), db, expectedMappings); err != nil {
 		t.Error("Not able to insert into database: " + err.Error())
 	}
 
@@ -345,7 +377,7 @@ func dbSetup(t *testing.T) *sql.DB {
 func TestGetProductIDMetadataNotFound(t *testing.T) {
 	db := dbSetup(t)
 
-	result, err := GetProductMetadata(db, "00000000000000")
+	result, err := GetProductMetadata(context.Background(), db, "00000000000000")
 	if err != nil {
 		if common, ok := err.(web.CommonError); !ok || common.Code != http.StatusNotFound {
 			t.Errorf("Retrieve failed with error %+v", err)
@@ -363,7 +395,7 @@ func TestGetProductIDMetadataFound(t *testing.T) {
 	InsertSampleProductMetadata(db, t)
 
 	productID := "12345678912345"
-	result, err := GetProductMetadata(db, productID)
+	result, err := GetProductMetadata(context.Background(), db, productID)
 	if err != nil {
 		t.Errorf("Retrieve failed with error %+v", err)
 	}
@@ -399,9 +431,295 @@ func InsertSampleProductMetadata(db *sql.DB, t *testing.T) []SKUData {
 		t.Fatal("Not able to Unmarshal JSON object: " + err.Error())
 	}
 
-	if err := Insert(db, expectedMappings); err != nil {
+	if err := Insert(context.Background(), db, expectedMappings); err != nil {
 		t.Error("Not able to insert into database: " + err.Error())
 	}
 
 	return expectedMappings
 }
+
+func TestFindProduct(t *testing.T) {
+
+	skuData := SKUData{
+		SKU: "MS122-32",
+		ProductList: []ProductData{
+			{ProductID: "00888446671444", Metadata: map[string]interface{}{"color": "blue", "size": "M"}},
+			{ProductID: "889319762751", DailyTurn: 0.5, Metadata: map[string]interface{}{"color": "red", "size": "S", "name": "slacks"}},
+			{ProductID: "90388987132758"},
+		},
+	}
+
+	testCases := []struct {
+		productID string
+		fields    []string
+		expected  string
+	}{
+		// The product requested is returned, not the first one of its SKU
+		{"889319762751", nil,
+			`{"sku":"MS122-32","productId":"889319762751","beingRead":0,"becomingReadable":0,"exitError":0,"dailyTurn":0.5,` +
+				`"metadata":{"color":"red","name":"slacks","size":"S"},"siblingProductIds":["00888446671444","90388987132758"]}`},
+		{"00888446671444", []string{"size", "unknown"},
+			`{"sku":"MS122-32","productId":"00888446671444","beingRead":0,"becomingReadable":0,"exitError":0,"dailyTurn":0,` +
+				`"metadata":{"size":"M"},"siblingProductIds":["889319762751","90388987132758"]}`},
+		{"90388987132758", []string{"color"},
+			`{"sku":"MS122-32","productId":"90388987132758","beingRead":0,"becomingReadable":0,"exitError":0,"dailyTurn":0,` +
+				`"metadata":null,"siblingProductIds":["00888446671444","889319762751"]}`},
+	}
+
+	for _, testCase := range testCases {
+		product, ok := findProduct(skuData, testCase.productID, testCase.fields)
+		if !ok {
+			t.Fatalf("Expected to find %s", testCase.productID)
+		}
+		bytes, _ := json.Marshal(product)
+		if string(bytes) != testCase.expected {
+			t.Errorf("Product %s with fields %v expected: %s, received: %s", testCase.productID, testCase.fields, testCase.expected, bytes)
+		}
+	}
+
+	// The SKU, which can be shared with the cache, is left as is
+	if len(skuData.ProductList[0].Metadata) != 2 {
+		t.Errorf("Expected the metadata of the SKU to be left unchanged, but got %v", skuData.ProductList[0].Metadata)
+	}
+
+	// Single product SKUs have no siblings
+	product, ok := findProduct(SKUData{SKU: "MS122-34", ProductList: skuData.ProductList[2:]}, "90388987132758", nil)
+	if !ok || product.SiblingProductIDs == nil || len(product.SiblingProductIDs) != 0 {
+		t.Errorf("Expected no siblings, but got %+v", product)
+	}
+
+	if _, ok := findProduct(skuData, "12345678912345", nil); ok {
+		t.Error("Expected a product missing from the SKU not to be found")
+	}
+}
+
+func TestGetProduct(t *testing.T) {
+
+	db := dbSetup(t)
+	insertSampleData(db, t)
+
+	product, err := GetProduct(context.Background(), db, "test", []string{"color"})
+	if err != nil {
+		t.Fatalf("GetProduct failed with error %+v", err)
+	}
+	if product.SKU != "MS122-32" || product.ProductID != "test" ||
+		!reflect.DeepEqual(product.SiblingProductIDs, []string{"889319388921"}) ||
+		!reflect.DeepEqual(product.Metadata, map[string]interface{}{"color": "blue"}) {
+		t.Errorf("Unexpected product %+v", product)
+	}
+
+	_, err = GetProduct(context.Background(), db, "00000000000000", nil)
+	if !web.IsNotFoundError(err) {
+		t.Errorf("Expected an unknown product to be not found, but got %v", err)
+	}
+}
+
+func TestMergeProductListKeepsAbsentFields(t *testing.T) {
+
+	current := []SKUData{{
+		SKU: "MS122-35",
+		ProductList: []ProductData{{
+			ProductID:        "889319388925",
+			BeingRead:        0.01,
+			BecomingReadable: 0.02,
+			ExitError:        0.03,
+			DailyTurn:        0.04,
+			Metadata:         map[string]interface{}{"color": "blue", "size": "XS"},
+		}},
+	}}
+
+	var incoming []SKUData
+	JSONSample := `[
+		{ "sku":"MS122-35",
+		  "productList": [ {"productId": "889319388925", "dailyTurn": 0.5, "metadata": {"size":"M", "color": null, "style": "slim"} } ]
+		}
+	]`
+	if err := json.Unmarshal([]byte(JSONSample), &incoming); err != nil {
+		t.Fatal("Not able to Unmarshal JSON object: " + err.Error())
+	}
+
+	mergeProductList(&incoming, &current)
+
+	product := incoming[0].ProductList[0]
+	if product.DailyTurn != 0.5 {
+		t.Errorf("Expected dailyTurn to be updated to 0.5, but got %v", product.DailyTurn)
+	}
+	if product.BeingRead != 0.01 || product.BecomingReadable != 0.02 || product.ExitError != 0.03 {
+		t.Errorf("Expected absent probabilities to be preserved, but got %+v", product)
+	}
+
+	expectedMetadata := map[string]interface{}{"size": "M", "style": "slim"}
+	if !reflect.DeepEqual(product.Metadata, expectedMetadata) {
+		t.Errorf("Expected metadata %v, but got %v", expectedMetadata, product.Metadata)
+	}
+}
+
+func TestMergeProductListWithoutMetadata(t *testing.T) {
+
+	current := []SKUData{{
+		SKU: "MS122-35",
+		ProductList: []ProductData{{
+			ProductID: "889319388925",
+			Metadata:  map[string]interface{}{"color": "blue"},
+		}},
+	}}
+
+	var incoming []SKUData
+	JSONSample := `[{ "sku":"MS122-35", "productList": [ {"productId": "889319388925", "exitError": 0.2 } ] }]`
+	if err := json.Unmarshal([]byte(JSONSample), &incoming); err != nil {
+		t.Fatal("Not able to Unmarshal JSON object: " + err.Error())
+	}
+
+	mergeProductList(&incoming, &current)
+
+	product := incoming[0].ProductList[0]
+	if product.ExitError != 0.2 {
+		t.Errorf("Expected exitError to be updated to 0.2, but got %v", product.ExitError)
+	}
+	if product.Metadata["color"] != "blue" {
+		t.Errorf("Expected metadata to be preserved, but got %v", product.Metadata)
+	}
+}
+
+func TestMergeProductListSkipsStaleProducts(t *testing.T) {
+
+	current := []SKUData{{
+		SKU:         "MS122-36",
+		LastUpdated: 2000,
+		ProductList: []ProductData{
+			{ProductID: "889319388926", DailyTurn: 0.1, LastUpdated: 2000},
+			{ProductID: "889319388927", DailyTurn: 0.1, LastUpdated: 1000},
+		},
+	}}
+
+	incoming := []SKUData{{
+		SKU: "MS122-36",
+		ProductList: []ProductData{
+			{ProductID: "889319388926", DailyTurn: 0.5},
+			{ProductID: "889319388927", DailyTurn: 0.5},
+		},
+	}}
+	stampSentOn(incoming, 1500)
+
+	incoming, skipped := discardStale(incoming, current, MergeMode)
+	if skipped != 1 || len(incoming) != 1 {
+		t.Fatalf("Expected 1 stale product out of a single SKU, but got %d and %d SKUs", skipped, len(incoming))
+	}
+
+	mergeProductList(&incoming, &current)
+
+	if incoming[0].LastUpdated != 2000 {
+		t.Errorf("Expected SKU lastUpdated to stay 2000, but got %d", incoming[0].LastUpdated)
+	}
+	newer, older := incoming[0].ProductList[0], incoming[0].ProductList[1]
+	if newer.DailyTurn != 0.1 || newer.LastUpdated != 2000 {
+		t.Errorf("Expected the newer stored product to be kept, but got %+v", newer)
+	}
+	if older.DailyTurn != 0.5 || older.LastUpdated != 1500 {
+		t.Errorf("Expected the older stored product to be updated, but got %+v", older)
+	}
+}
+
+func TestDiscardStaleSkus(t *testing.T) {
+
+	current := []SKUData{{
+		SKU:         "MS122-37",
+		LastUpdated: 2000,
+		ProductList: []ProductData{{ProductID: "889319388928", LastUpdated: 2000}},
+	}}
+
+	for _, mode := range []Mode{MergeMode, ReplaceMode} {
+		incoming := []SKUData{
+			{SKU: "MS122-37", ProductList: []ProductData{{ProductID: "889319388928"}}},
+			{SKU: "MS122-38", ProductList: []ProductData{{ProductID: "889319388929"}}},
+		}
+		stampSentOn(incoming, 1000)
+
+		fresh, skipped := discardStale(incoming, current, mode)
+		if skipped != 1 || len(fresh) != 1 || fresh[0].SKU != "MS122-38" {
+			t.Errorf("Expected only the new SKU to be kept in %s mode, but got %+v", mode, fresh)
+		}
+	}
+}
+
+func TestApplyProductPatchInvalid(t *testing.T) {
+
+	product := ProductData{ProductID: "889319388925", DailyTurn: 0.1}
+
+	invalidPatches := []map[string]interface{}{
+		{"dailyTurn": 2.0},
+		{"dailyTurn": "high"},
+		{"name": "unknown attribute"},
+	}
+
+	for _, patch := range invalidPatches {
+		if _, err := applyProductPatch(product, patch); err == nil {
+			t.Errorf("Expected patch %v to be rejected", patch)
+		}
+	}
+}
+
+func TestPatchProduct(t *testing.T) {
+
+	db := dbSetup(t)
+
+	JSONSample := `[
+		{ "sku":"MS122-36",
+		  "productList": [ {"productId": "889319388926", "beingRead": 0.01, "dailyTurn": 0.0121, "metadata": {"color":"blue", "size":"XS"} } ]
+		}
+	]`
+
+	var mappings []SKUData
+	if err := json.Unmarshal([]byte(JSONSample), &mappings); err != nil {
+		t.Fatal("Not able to Unmarshal JSON object: " + err.Error())
+	}
+	if err := Insert(context.Background(), db, mappings); err != nil {
+		t.Fatal("Not able to insert into database: " + err.Error())
+	}
+
+	patch := map[string]interface{}{
+		"dailyTurn": 0.5,
+		"metadata":  map[string]interface{}{"size": nil, "style": "slim"},
+	}
+
+	current, err := GetSku(context.Background(), db, "MS122-36")
+	if err != nil {
+		t.Fatalf("Unable to get sku: %+v", err)
+	}
+	etag, err := ETag(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	product, newETag, err := PatchProduct(context.Background(), db, "MS122-36", "889319388926", etag, patch)
+	if err != nil {
+		t.Fatalf("Unable to patch product: %+v", err)
+	}
+	if newETag == etag {
+		t.Error("Expected the ETag of the sku to change")
+	}
+
+	if product.DailyTurn != 0.5 || product.BeingRead != 0.01 {
+		t.Errorf("Unexpected probabilities after patch: %+v", product)
+	}
+
+	expectedMetadata := map[string]interface{}{"color": "blue", "style": "slim"}
+	if !reflect.DeepEqual(product.Metadata, expectedMetadata) {
+		t.Errorf("Expected metadata %v, but got %v", expectedMetadata, product.Metadata)
+	}
+
+	// The old ETag no longer matches
+	if _, _, err := PatchProduct(context.Background(), db, "MS122-36", "889319388926", etag, patch); err == nil ||
+		err.(web.CommonError).Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected precondition failed error for a stale ETag, but got %v", err)
+	}
+
+	if _, _, err := PatchProduct(context.Background(), db, "MS122-36", "000000000000", "", patch); !web.IsNotFoundError(err) {
+		t.Errorf("Expected not found error for unknown product, but got %v", err)
+	}
+
+	if _, _, err := PatchProduct(context.Background(), db, "MS122-36", "889319388926", "",
+		map[string]interface{}{"productId": "000000000000"}); err == nil {
+		t.Error("Expected an error when modifying the productId")
+	}
+}
@@ -0,0 +1,253 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package productdata
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-go-odata/parser"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// productListField is the array of products of a SKU, which lambdas and $select can reach into
+const productListField = "productList"
+
+var (
+	// productLambdaPattern matches the lambdas on the products, as in productList/any(p: p/color eq 'red')
+	productLambdaPattern = regexp.MustCompile(`(?s)^` + productListField + `/(any|all)\(\s*([a-zA-Z][a-zA-Z0-9_]*)\s*:(.*)\)$`)
+	// nestedLambdaPattern matches the lambdas on the products out of the conjuncts of a $filter
+	nestedLambdaPattern = regexp.MustCompile(productListField + `/(any|all)\(`)
+
+	// lambdaComparisons are the SQL operators of the comparisons, as go-odata translates them
+	lambdaComparisons = map[string]string{
+		"eq": "=",
+		"ne": "!=",
+		"gt": ">",
+		"ge": ">=",
+		"lt": "<",
+		"le": "<=",
+	}
+	lambdaFunctions = map[string]string{
+		"contains":   "%%%s%%",
+		"endswith":   "%%%s",
+		"startswith": "%s%%",
+	}
+)
+
+// productFilter is a $filter split into the lambdas on the products joined to it with and, and
+// the rest of it, which go-odata translates
+type productFilter struct {
+	// odata is the rest of the filter, empty when it only has lambdas
+	odata   string
+	tree    *parser.ParseNode
+	lambdas []productLambda
+}
+
+// productLambda is a productList/any or productList/all lambda, whose predicate is parsed by
+// go-odata with the paths of the variable like p/metadata/color turned into p.metadata.color
+type productLambda struct {
+	operator  string
+	variable  string
+	predicate *parser.ParseNode
+}
+
+// parseProductFilter splits the lambdas on the products out of a $filter
+func parseProductFilter(filter string) (productFilter, error) {
+
+	conjuncts, disjunction := splitConjuncts(filter)
+	var parsed productFilter
+	var rest []string
+
+	for _, conjunct := range conjuncts {
+		match := productLambdaPattern.FindStringSubmatch(conjunct)
+		if match == nil || !closesAtEnd(conjunct) {
+			if nestedLambdaPattern.MatchString(conjunct) {
+				return productFilter{}, errors.Errorf("%s lambdas must be joined to the rest of $filter with and", productListField)
+			}
+			rest = append(rest, conjunct)
+			continue
+		}
+		predicate, err := parseODataFilter(lambdaPaths(match[3]))
+		if err != nil {
+			return productFilter{}, errors.Wrapf(err, "invalid %s lambda", productListField)
+		}
+		parsed.lambdas = append(parsed.lambdas, productLambda{match[1], match[2], predicate})
+	}
+
+	if len(parsed.lambdas) > 0 && disjunction {
+		return productFilter{}, errors.Errorf("%s lambdas must be joined to the rest of $filter with and", productListField)
+	}
+
+	if len(parsed.lambdas) == 0 {
+		parsed.odata = filter
+	} else {
+		parsed.odata = strings.Join(rest, " and ")
+	}
+	if parsed.odata != "" {
+		tree, err := parseODataFilter(parsed.odata)
+		if err != nil {
+			return productFilter{}, err
+		}
+		parsed.tree = tree
+	}
+	return parsed, nil
+}
+
+// parseODataFilter parses a $filter with go-odata
+func parseODataFilter(filter string) (*parser.ParseNode, error) {
+	parsed, err := parser.ParseURLValues(url.Values{parser.Filter: {filter}})
+	if err != nil {
+		return nil, err
+	}
+	tree, _ := parsed[parser.Filter].(*parser.ParseNode)
+	return tree, nil
+}
+
+// splitConjuncts splits a filter at the and operators out of parentheses and strings, telling
+// whether it also has an or out of them
+func splitConjuncts(filter string) ([]string, bool) {
+
+	var conjuncts []string
+	depth, quoted, disjunction, start := 0, false, false, 0
+	for i := 0; i < len(filter); i++ {
+		switch {
+		case filter[i] == '\'':
+			quoted = !quoted
+		case quoted:
+		case filter[i] == '(':
+			depth++
+		case filter[i] == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(filter[i:], " or "):
+			disjunction = true
+		case depth == 0 && strings.HasPrefix(filter[i:], " and "):
+			conjuncts = append(conjuncts, strings.TrimSpace(filter[start:i]))
+			start = i + len(" and ")
+		}
+	}
+	return append(conjuncts, strings.TrimSpace(filter[start:])), disjunction
+}
+
+// closesAtEnd tells whether the first parenthesis of an expression is closed at its end
+func closesAtEnd(expression string) bool {
+
+	depth, quoted, opened := 0, false, false
+	for i := 0; i < len(expression); i++ {
+		switch {
+		case expression[i] == '\'':
+			quoted = !quoted
+		case quoted:
+		case expression[i] == '(':
+			depth++
+			opened = true
+		case expression[i] == ')':
+			depth--
+			if depth == 0 && i != len(expression)-1 {
+				return false
+			}
+		}
+	}
+	return opened && depth == 0
+}
+
+// lambdaPaths turns the paths of a lambda predicate into the dotted attributes go-odata parses
+func lambdaPaths(predicate string) string {
+
+	converted := []byte(predicate)
+	quoted := false
+	for i, char := range converted {
+		switch {
+		case char == '\'':
+			quoted = !quoted
+		case char == '/' && !quoted:
+			converted[i] = '.'
+		}
+	}
+	return string(converted)
+}
+
+// lambdaSQL translates the predicate of a lambda into a SQL condition on a product, comparing
+// the text of its attributes as go-odata does for the attributes of the SKUs
+func lambdaSQL(node *parser.ParseNode, variable string, product string) (string, error) {
+
+	if node == nil || len(node.Children) != 2 {
+		return "", errors.New("invalid lambda predicate")
+	}
+	operator, _ := node.Token.Value.(string)
+
+	switch operator {
+
+	case "and", "or":
+		left, err := lambdaSQL(node.Children[0], variable, product)
+		if err != nil {
+			return "", err
+		}
+		right, err := lambdaSQL(node.Children[1], variable, product)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s %s %s)", left, operator, right), nil
+
+	case "eq", "ne", "gt", "ge", "lt", "le":
+		attribute, err := lambdaAttribute(node.Children[0], variable, product)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", attribute, lambdaComparisons[operator],
+			pq.QuoteLiteral(lambdaValue(node.Children[1]))), nil
+
+	case "contains", "endswith", "startswith":
+		attribute, err := lambdaAttribute(node.Children[0], variable, product)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := node.Children[1].Token.Value.(string); !ok {
+			return "", errors.Errorf("%s takes a string", operator)
+		}
+		return fmt.Sprintf("%s LIKE %s", attribute,
+			pq.QuoteLiteral(fmt.Sprintf(lambdaFunctions[operator], lambdaValue(node.Children[1])))), nil
+	}
+
+	return "", errors.Errorf("invalid operator %q in lambda predicate", operator)
+}
+
+// lambdaAttribute returns the SQL of the text of the attribute of a product at a path of the
+// lambda variable, like p.metadata.color
+func lambdaAttribute(node *parser.ParseNode, variable string, product string) (string, error) {
+
+	path, _ := node.Token.Value.(string)
+	if !strings.HasPrefix(path, variable+".") {
+		return "", errors.Errorf("%q is not an attribute of %s in lambda predicate", path, variable)
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, variable+"."), ".")
+	attribute := product
+	for i, segment := range segments {
+		operator := "->"
+		if i == len(segments)-1 {
+			operator = "->>"
+		}
+		attribute = fmt.Sprintf("%s %s %s", attribute, operator, pq.QuoteLiteral(segment))
+	}
+	return attribute, nil
+}
+
+// lambdaValue returns the text of a value of a lambda predicate, without the quotes of strings
+func lambdaValue(node *parser.ParseNode) string {
+
+	value, ok := node.Token.Value.(string)
+	if !ok {
+		return fmt.Sprintf("%v", node.Token.Value)
+	}
+	if len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+		value = strings.Replace(value[1:len(value)-1], "''", "'", -1)
+	}
+	return value
+}
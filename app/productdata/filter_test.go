@@ -0,0 +1,133 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package productdata
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+)
+
+func TestParseProductFilter(t *testing.T) {
+
+	tests := []struct {
+		filter  string
+		odata   string
+		lambdas int
+	}{
+		{"sku eq 'MS122-32'", "sku eq 'MS122-32'", 0},
+		{"productList/any(p: p/metadata/color eq 'red')", "", 1},
+		{"sku ne 'O''Brien' and productList/all(p: p/dailyTurn gt 1.5) and contains(sku, 'MS')", "sku ne 'O''Brien' and contains(sku, 'MS')", 1},
+		{"(sku eq 'a' or sku eq 'b') and productList/any(p: p/productId eq 'x') and productList/any(q: q/metadata/color eq 'a/b')", "(sku eq 'a' or sku eq 'b')", 2},
+		{"productList/any(p: (p/metadata/color eq 'red' or p/metadata/color eq 'blue') and p/dailyTurn ge 0.5)", "", 1},
+	}
+	for _, test := range tests {
+		parsed, err := parseProductFilter(test.filter)
+		if err != nil {
+			t.Errorf("Expected %q to be parsed, but got %v", test.filter, err)
+			continue
+		}
+		if parsed.odata != test.odata || len(parsed.lambdas) != test.lambdas {
+			t.Errorf("Expected %q to leave %q to go-odata with %d lambdas, but got %q with %d",
+				test.filter, test.odata, test.lambdas, parsed.odata, len(parsed.lambdas))
+		}
+	}
+
+	invalid := []string{
+		"sku eq",
+		"sku eq 'a' or productList/any(p: p/productId eq 'a')",
+		"sku eq 'a' or sku eq 'b' and productList/any(p: p/productId eq 'a')",
+		"(productList/any(p: p/productId eq 'a'))",
+		"productList/any(p p/productId eq 'a')",
+		"productList/any(p: p/productId eq 'a'",
+		"productList/any(p: p/productId eq )",
+		"productList/any(p: p/metadata/tags/any(t: t eq 'sale'))",
+	}
+	for _, filter := range invalid {
+		if _, err := parseProductFilter(filter); err == nil {
+			t.Errorf("Expected an error for %q", filter)
+		}
+	}
+}
+
+func TestODataSelectSQL(t *testing.T) {
+
+	const products = `jsonb_array_elements(CASE WHEN jsonb_typeof("data" -> 'productList') = 'array' THEN "data" -> 'productList' ELSE '[]'::jsonb END) WITH ORDINALITY AS product(element, ordinality)`
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			"$filter=productList/any(p: p/metadata/color eq 'red')&$select=sku,productList/productId&$top=10",
+			`WITH "skus" AS (SELECT id, jsonb_set("data", '{productList}', (SELECT COALESCE(jsonb_agg(jsonb_build_object('productId', product.element -> 'productId') ORDER BY product.ordinality), '[]'::jsonb) FROM ` +
+				products + ` WHERE product.element -> 'metadata' ->> 'color' = 'red')) AS "data" FROM "skus" WHERE EXISTS (SELECT 1 FROM ` +
+				products + ` WHERE product.element -> 'metadata' ->> 'color' = 'red')) ` +
+				`SELECT id,jsonb_build_object('sku', "data" -> 'sku','productList', "data" -> 'productList' ) AS "data" FROM "skus" LIMIT 10`,
+		},
+		{
+			// Products are not trimmed by all, which every product of the SKUs matches
+			"$filter=sku eq 'MS122-32' and productList/all(p: p/dailyTurn gt 0.5 or p/metadata/color eq 'O''Brien')&$orderby=sku desc",
+			`WITH "skus" AS (SELECT id, "data" AS "data" FROM "skus" WHERE NOT EXISTS (SELECT 1 FROM ` +
+				products + ` WHERE NOT COALESCE((product.element ->> 'dailyTurn' > '0.5' or product.element -> 'metadata' ->> 'color' = 'O''Brien'), false))) ` +
+				`SELECT *  FROM "skus" WHERE "data" ->> 'sku' = 'MS122-32' ORDER BY "data" ->> 'sku' DESC `,
+		},
+		{
+			"$select=productList/productId,sku,productList/dailyTurn",
+			`WITH "skus" AS (SELECT id, jsonb_set("data", '{productList}', (SELECT COALESCE(jsonb_agg(jsonb_build_object('productId', product.element -> 'productId', 'dailyTurn', product.element -> 'dailyTurn') ORDER BY product.ordinality), '[]'::jsonb) FROM ` +
+				products + `)) AS "data" FROM "skus") ` +
+				`SELECT id,jsonb_build_object('productList', "data" -> 'productList','sku', "data" -> 'sku' ) AS "data" FROM "skus"`,
+		},
+		{
+			"$filter=productList/any(p: startswith(p/productId, '100') and p/metadata/size ne 'M')",
+			`WITH "skus" AS (SELECT id, jsonb_set("data", '{productList}', (SELECT COALESCE(jsonb_agg(product.element ORDER BY product.ordinality), '[]'::jsonb) FROM ` +
+				products + ` WHERE (product.element ->> 'productId' LIKE '100%' and product.element -> 'metadata' ->> 'size' != 'M'))) AS "data" FROM "skus" WHERE EXISTS (SELECT 1 FROM ` +
+				products + ` WHERE (product.element ->> 'productId' LIKE '100%' and product.element -> 'metadata' ->> 'size' != 'M'))) ` +
+				`SELECT *  FROM "skus"`,
+		},
+	}
+
+	for _, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		selectQuery, err := odataSelectSQL(query)
+		if err != nil {
+			t.Errorf("Expected %s to be translated, but got %v", test.query, err)
+		} else if selectQuery != test.expected {
+			t.Errorf("Expected %s to be translated into\n%s\nbut got\n%s", test.query, test.expected, selectQuery)
+		}
+	}
+
+	// The lambdas apply to the SKUs counted and positioned as well
+	query := url.Values{"$filter": {"productList/any(p: p/productId eq 'a')"}, "$top": {"10"}}
+	if countQuery, err := odataCountSQL(query); err != nil || !strings.HasPrefix(countQuery, `WITH "skus" AS (`) ||
+		!strings.HasSuffix(countQuery, `) SELECT count(*) FROM "skus"`) {
+		t.Errorf("Expected the SKUs matching the lambda to be counted, but got %s %v", countQuery, err)
+	}
+	if positioned, err := PositionedSQL(query); err != nil || !strings.HasPrefix(positioned, `WITH "skus" AS (`) ||
+		!strings.HasSuffix(positioned, `) SELECT row_number() OVER (ORDER BY "data" ->> 'sku') AS position, *  FROM "skus"`) {
+		t.Errorf("Expected the SKUs matching the lambda to be positioned, but got %s %v", positioned, err)
+	}
+
+	invalid := []url.Values{
+		{"$filter": {"productList/any(p: sku eq 'MS122-32')"}},
+		{"$filter": {"productList/any(p: contains(p/productId, 1))"}},
+		{"$select": {"productList/metadata/color"}},
+		{"$select": {"productList/productId"}, "$top": {"ten"}},
+		{"$select": {"productList/productId"}, "$expand": {"productList"}},
+	}
+	for _, query := range invalid {
+		_, err := odataSelectSQL(query)
+		if common, ok := err.(web.CommonError); !ok || common.Code != http.StatusBadRequest {
+			t.Errorf("Expected a bad request for %v, but got %v", query, err)
+		}
+	}
+}
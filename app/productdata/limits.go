@@ -0,0 +1,141 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package productdata
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-go-odata/parser"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// queryCanceled is the code of the PostgreSQL error of statements cancelled by their timeout
+const queryCanceled = "57014"
+
+var (
+	// queryTimeout bounds the time each query can run, 0 leaving it unbounded
+	queryTimeout time.Duration
+	// maxFilterComplexity bounds the complexity of OData filters, 0 leaving it unbounded
+	maxFilterComplexity int
+)
+
+// SetQueryLimits bounds the time each query can run and the complexity of the OData filters,
+// 0 leaving them unbounded. It must be called before the queries start.
+func SetQueryLimits(timeout time.Duration, maxComplexity int) {
+	queryTimeout = timeout
+	maxFilterComplexity = maxComplexity
+}
+
+// withQueryTimeout returns the context of a query, which is cancelled with the request or when
+// the query runs for longer than the query timeout, the driver then cancelling the statement
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, queryTimeout)
+}
+
+// runQuery runs a query in a read only transaction whose statements are cancelled by PostgreSQL
+// once they run for the query timeout, passing its rows to scan. The query is cancelled with ctx
+// as well.
+func runQuery(ctx context.Context, db *sql.DB, query string, scan func(rows *sql.Rows) error) error {
+
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return queryError(ctx, err, "db.Begin")
+	}
+	// Rolling back a read only transaction ends it just as committing it does
+	defer tx.Rollback()
+
+	if queryTimeout > 0 {
+		timeout := fmt.Sprintf("SET LOCAL statement_timeout = %d", queryTimeout/time.Millisecond)
+		if _, err := tx.ExecContext(ctx, timeout); err != nil {
+			return queryError(ctx, err, "db.Timeout")
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return queryError(ctx, err, "db.Select")
+	}
+	defer rows.Close()
+
+	if err := scan(rows); err != nil {
+		return queryError(ctx, err, "rows.Scan")
+	}
+	if err := rows.Err(); err != nil {
+		return queryError(ctx, err, "rows.Next")
+	}
+	return nil
+}
+
+// queryError returns the error of a query, telling the client when it took too long
+func queryError(ctx context.Context, err error, action string) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		metrics.GetOrRegisterGauge("Product-Data.Query.Timeout", nil).Update(1)
+		return web.QueryTimeoutError()
+	case context.Canceled:
+		metrics.GetOrRegisterGauge("Product-Data.Query.Cancelled", nil).Update(1)
+		return errors.Wrap(ctx.Err(), action)
+	}
+	if pqErr, ok := errors.Cause(err).(*pq.Error); ok && pqErr.Code == queryCanceled {
+		metrics.GetOrRegisterGauge("Product-Data.Query.Timeout", nil).Update(1)
+		return web.QueryTimeoutError()
+	}
+	return errors.Wrap(err, action)
+}
+
+// filterComplexity returns the number of conditions and operators of a filter, those of lambdas
+// counting twice since they are evaluated for each product
+func filterComplexity(filter productFilter) int {
+
+	complexity := treeComplexity(filter.tree)
+	for _, lambda := range filter.lambdas {
+		complexity += 1 + 2*treeComplexity(lambda.predicate)
+	}
+	// The lambdas are joined to the rest of the filter with and
+	if joins := len(filter.lambdas); joins > 0 && filter.tree == nil {
+		complexity += joins - 1
+	} else {
+		complexity += joins
+	}
+	return complexity
+}
+
+// treeComplexity returns the number of conditions and operators of a filter parsed by go-odata
+func treeComplexity(node *parser.ParseNode) int {
+	if node == nil || len(node.Children) == 0 {
+		return 0
+	}
+	complexity := 1
+	for _, child := range node.Children {
+		complexity += treeComplexity(child)
+	}
+	return complexity
+}
+
+// checkFilterComplexity rejects the filters more complex than the limit
+func checkFilterComplexity(filter productFilter) error {
+	if maxFilterComplexity <= 0 {
+		return nil
+	}
+	if complexity := filterComplexity(filter); complexity > maxFilterComplexity {
+		metrics.GetOrRegisterGauge("Product-Data.Query.Too-Complex", nil).Update(1)
+		return web.ValidationError(fmt.Sprintf("$filter is too complex, its complexity is %d and at most %d is allowed",
+			complexity, maxFilterComplexity))
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package productdata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/lib/pq"
+)
+
+func TestFilterComplexity(t *testing.T) {
+
+	tests := map[string]int{
+		"sku eq 'MS122-32'": 1,
+		"sku eq 'MS122-32' or contains(sku, 'MS') and sku ne 'MS122-33'":                    5,
+		"productList/any(p: p/metadata/color eq 'red')":                                     3,
+		"productList/any(p: p/metadata/color eq 'red' and p/dailyTurn gt 0.5)":              7,
+		"sku eq 'MS122-32' and productList/all(p: p/metadata/color ne 'red')":               5,
+		"productList/any(p: p/productId eq 'a') and productList/any(q: q/productId eq 'b')": 7,
+	}
+	for filter, expected := range tests {
+		parsed, err := parseProductFilter(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if complexity := filterComplexity(parsed); complexity != expected {
+			t.Errorf("Expected a complexity of %d for %q, but got %d", expected, filter, complexity)
+		}
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+
+	defer SetQueryLimits(0, 0)
+	SetQueryLimits(time.Millisecond, 6)
+
+	if _, err := odataSelectSQL(url.Values{"$filter": {"productList/any(p: p/metadata/color eq 'red' and p/dailyTurn gt 0.5)"}}); err == nil {
+		t.Error("Expected a filter more complex than the limit to be rejected")
+	} else if common, ok := err.(web.CommonError); !ok || common.Code != http.StatusBadRequest {
+		t.Errorf("Expected a bad request, but got %v", err)
+	}
+	if _, err := odataSelectSQL(url.Values{"$filter": {"productList/any(p: p/metadata/color eq 'red')"}}); err != nil {
+		t.Errorf("Expected a filter within the limit to be accepted, but got %v", err)
+	}
+
+	ctx, cancel := withQueryTimeout(context.Background())
+	defer cancel()
+	<-ctx.Done()
+	if common, ok := queryError(ctx, errors.New("pq: canceling statement due to user request"), "db.Select").(web.CommonError); !ok ||
+		common.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a timeout to be a service unavailable error, but got %v", common)
+	}
+
+	// Statements cancelled by their statement_timeout are timeouts too
+	if common, ok := queryError(context.Background(), &pq.Error{Code: queryCanceled}, "db.Select").(web.CommonError); !ok ||
+		common.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a statement timeout to be a service unavailable error, but got %v", common)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := queryError(cancelled, errors.New("pq: canceling statement due to user request"), "db.Select"); err == nil {
+		t.Error("Expected an error for a cancelled query")
+	} else if _, ok := err.(web.CommonError); ok {
+		t.Errorf("Expected a cancelled query to be a server error, but got %v", err)
+	}
+}
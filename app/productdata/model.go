@@ -5,6 +5,8 @@
  */
 package productdata
 
+import "encoding/json"
+
 // DbSchema postgresql db schema
 const DbSchema = `
 CREATE EXTENSION IF NOT EXISTS pgcrypto;
@@ -18,6 +20,16 @@ CREATE UNIQUE INDEX IF NOT EXISTS idx_sku
 ON skus ((data->>'sku'));
 `
 
+// Mode tells how incoming SKUs are combined with the ones already stored
+type Mode string
+
+const (
+	// MergeMode updates the attributes supplied for the products already stored
+	MergeMode Mode = "merge"
+	// ReplaceMode stores the products exactly as received
+	ReplaceMode Mode = "replace"
+)
+
 // CountType is used to hold the total count
 type CountType struct {
 	Count int `json:"count"`
@@ -98,6 +110,52 @@ const Schema = `
 }
 `
 
+// ProductSchema represents the schema of a single product once a JSON Merge
+// Patch has been applied to it
+const ProductSchema = `
+{
+    "type": "object",
+    "required": [
+        "productId"
+    ],
+    "properties": {
+        "productId": {
+            "type": "string",
+            "minLength": 1,
+            "maxLength": 1024
+        },
+        "dailyTurn": {
+            "type": "number",
+            "minimum": 0,
+            "maximum": 1
+        },
+        "becomingReadable": {
+            "type": "number",
+            "minimum": 0,
+            "maximum": 1
+        },
+        "exitError": {
+            "type": "number",
+            "minimum": 0,
+            "maximum": 1
+        },
+        "beingRead": {
+            "type": "number",
+            "minimum": 0,
+            "maximum": 1
+        },
+        "metadata": {
+            "type": ["object", "null"]
+        },
+        "lastUpdated": {
+            "type": "integer",
+            "minimum": 0
+        }
+    },
+    "additionalProperties": false
+}
+`
+
 // IncomingData represents the struct of the raw data coming from the Broker.
 //
 // Although it may have the same "shape" as the ProductData, the json attributes
@@ -111,6 +169,45 @@ type IncomingData struct {
 	ExitError        float64                `json:"exitError"`
 	DailyTurn        float64                `json:"dailyTurn"`
 	Metadata         map[string]interface{} `json:"metadata"`
+
+	// present records the attributes supplied by the Broker
+	present fieldSet
+}
+
+// UnmarshalJSON decodes the incoming data and records which attributes were supplied
+func (item *IncomingData) UnmarshalJSON(data []byte) error {
+	type incomingAlias IncomingData
+	var alias incomingAlias
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+	present, err := decodeFieldSet(data)
+	if err != nil {
+		return err
+	}
+	*item = IncomingData(alias)
+	item.present = present
+	return nil
+}
+
+// ProductData returns the product attributes of the incoming data, keeping
+// track of the attributes that were supplied so they can be merged
+func (item IncomingData) ProductData() ProductData {
+	product := ProductData{
+		ProductID:        item.ProductID,
+		Metadata:         item.Metadata,
+		BeingRead:        item.BeingRead,
+		BecomingReadable: item.BecomingReadable,
+		DailyTurn:        item.DailyTurn,
+		ExitError:        item.ExitError,
+	}
+	if item.present != nil {
+		product.present = make(fieldSet, len(item.present))
+		for field := range item.present {
+			product.present[field] = true
+		}
+	}
+	return product
 }
 
 // SKUData connects a SKU to its list of products
@@ -119,6 +216,8 @@ type SKUData struct {
 	SKU string `json:"sku" db:"sku"`
 	// ProductList connects one or more products to the same SKU
 	ProductList []ProductData `json:"productList" db:"productList"`
+	// LastUpdated is when the source sent the latest update of the SKU, in milliseconds since epoch
+	LastUpdated int64 `json:"lastUpdated,omitempty" db:"lastUpdated"`
 }
 
 // ProductData models the product's attributes
@@ -131,6 +230,59 @@ type ProductData struct {
 	DailyTurn        float64 `json:"dailyTurn" db:"dailyTurn"`
 	// Metadata stores arbitrary data about a product
 	Metadata map[string]interface{} `json:"metadata"`
+	// LastUpdated is when the source sent the latest update of the product, in milliseconds since epoch
+	LastUpdated int64 `json:"lastUpdated,omitempty" db:"lastUpdated"`
+
+	// present records the attributes supplied when the product was decoded.
+	// A nil set means all of them were, which is the case for products built in code.
+	present fieldSet
+}
+
+// SKUProduct is a product along with the SKU it belongs to and the IDs of the other products of the SKU.
+// It is only meant to be encoded, the UnmarshalJSON of ProductData leaving SKU and SiblingProductIDs out.
+type SKUProduct struct {
+	SKU string `json:"sku"`
+	ProductData
+	SiblingProductIDs []string `json:"siblingProductIds"`
+}
+
+// UnmarshalJSON decodes the product and records which attributes were supplied
+func (product *ProductData) UnmarshalJSON(data []byte) error {
+	type productAlias ProductData
+	var alias productAlias
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+	present, err := decodeFieldSet(data)
+	if err != nil {
+		return err
+	}
+	*product = ProductData(alias)
+	product.present = present
+	return nil
+}
+
+// has reports whether the attribute was supplied for the product
+func (product ProductData) has(field string) bool {
+	return product.present == nil || product.present[field]
+}
+
+// fieldSet holds the names of the JSON attributes present in a document
+type fieldSet map[string]bool
+
+func decodeFieldSet(data []byte) (fieldSet, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	present := make(fieldSet, len(raw))
+	for field := range raw {
+		present[field] = true
+	}
+	return present, nil
 }
 
 // Root - Main struct for input
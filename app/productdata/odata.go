@@ -0,0 +1,195 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package productdata
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ODataNamespace is the namespace of the types of the OData service
+	ODataNamespace = "ProductDataService"
+	// ODataEntitySet is the name of the entity set of the SKUs
+	ODataEntitySet = "skus"
+)
+
+// edmTypes are the OData primitive types of the Go kinds used by the model
+var edmTypes = map[reflect.Kind]string{
+	reflect.String:  "Edm.String",
+	reflect.Bool:    "Edm.Boolean",
+	reflect.Int:     "Edm.Int64",
+	reflect.Int32:   "Edm.Int32",
+	reflect.Int64:   "Edm.Int64",
+	reflect.Float32: "Edm.Single",
+	reflect.Float64: "Edm.Double",
+}
+
+type edmx struct {
+	XMLName      xml.Name `xml:"edmx:Edmx"`
+	Namespace    string   `xml:"xmlns:edmx,attr"`
+	Version      string   `xml:"Version,attr"`
+	DataServices struct {
+		Schema edmSchema `xml:"Schema"`
+	} `xml:"edmx:DataServices"`
+}
+
+type edmSchema struct {
+	XMLNS           string         `xml:"xmlns,attr"`
+	Namespace       string         `xml:"Namespace,attr"`
+	EntityTypes     []edmType      `xml:"EntityType"`
+	ComplexTypes    []edmType      `xml:"ComplexType"`
+	EntityContainer edmEntityGroup `xml:"EntityContainer"`
+}
+
+type edmType struct {
+	Name       string        `xml:"Name,attr"`
+	OpenType   bool          `xml:"OpenType,attr,omitempty"`
+	Key        *edmKey       `xml:"Key,omitempty"`
+	Properties []edmProperty `xml:"Property"`
+}
+
+type edmKey struct {
+	PropertyRef struct {
+		Name string `xml:"Name,attr"`
+	} `xml:"PropertyRef"`
+}
+
+type edmProperty struct {
+	Name     string `xml:"Name,attr"`
+	Type     string `xml:"Type,attr"`
+	Nullable string `xml:"Nullable,attr,omitempty"`
+}
+
+type edmEntityGroup struct {
+	Name       string         `xml:"Name,attr"`
+	EntitySets []edmEntitySet `xml:"EntitySet"`
+}
+
+type edmEntitySet struct {
+	Name       string `xml:"Name,attr"`
+	EntityType string `xml:"EntityType,attr"`
+}
+
+// ODataMetadata returns the CSDL document describing the SKUs and their products, generated from
+// SKUData so that it follows the model. Metadata maps are open types since their keys are free.
+func ODataMetadata() ([]byte, error) {
+
+	schema := edmSchema{
+		XMLNS:     "http://docs.oasis-open.org/odata/ns/edm",
+		Namespace: ODataNamespace,
+	}
+
+	skuType := reflect.TypeOf(SKUData{})
+	entityType, complexTypes, err := edmStructType(skuType)
+	if err != nil {
+		return nil, err
+	}
+	entityType.Key = &edmKey{}
+	entityType.Key.PropertyRef.Name = "sku"
+	for i := range entityType.Properties {
+		if entityType.Properties[i].Name == "sku" {
+			entityType.Properties[i].Nullable = "false"
+		}
+	}
+	schema.EntityTypes = []edmType{entityType}
+	schema.ComplexTypes = complexTypes
+
+	schema.EntityContainer.Name = "Container"
+	schema.EntityContainer.EntitySets = []edmEntitySet{{ODataEntitySet, ODataNamespace + "." + skuType.Name()}}
+
+	document := edmx{Namespace: "http://docs.oasis-open.org/odata/ns/edmx", Version: "4.0"}
+	document.DataServices.Schema = schema
+
+	payload, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), payload...), nil
+}
+
+// edmStructType describes a struct by the JSON attributes of its exported fields, along with
+// the complex types of its nested structs and maps
+func edmStructType(structType reflect.Type) (edmType, []edmType, error) {
+
+	described := edmType{Name: structType.Name()}
+	var complexTypes []edmType
+
+	for i := 0; i < structType.NumField(); i++ {
+		structField := structType.Field(i)
+		name := strings.Split(structField.Tag.Get("json"), ",")[0]
+		if structField.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = structField.Name
+		}
+
+		fieldType := structField.Type
+		collection := fieldType.Kind() == reflect.Slice
+		if collection {
+			fieldType = fieldType.Elem()
+		}
+
+		var typeName string
+		switch fieldType.Kind() {
+		case reflect.Struct:
+			nested, nestedTypes, err := edmStructType(fieldType)
+			if err != nil {
+				return edmType{}, nil, err
+			}
+			complexTypes = append(append(complexTypes, nested), nestedTypes...)
+			typeName = ODataNamespace + "." + nested.Name
+		case reflect.Map:
+			complexTypes = append(complexTypes, edmType{Name: structField.Name, OpenType: true})
+			typeName = ODataNamespace + "." + structField.Name
+		default:
+			edmName, ok := edmTypes[fieldType.Kind()]
+			if !ok {
+				return edmType{}, nil, errors.Errorf("no OData type for %s.%s", structType.Name(), structField.Name)
+			}
+			typeName = edmName
+		}
+
+		if collection {
+			typeName = "Collection(" + typeName + ")"
+		}
+		described.Properties = append(described.Properties, edmProperty{Name: name, Type: typeName})
+	}
+
+	return described, complexTypes, nil
+}
+
+// Count returns the number of SKUs matching the $filter of an OData query, whatever its paging.
+// The query is cancelled with ctx or once it runs for the query timeout.
+func Count(ctx context.Context, db *sql.DB, query url.Values) (int, error) {
+
+	if db == nil {
+		return 0, errors.New("No database connection")
+	}
+
+	countQuery, err := odataCountSQL(query)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = runQuery(ctx, db, countQuery, func(rows *sql.Rows) error {
+		for rows.Next() {
+			if err := rows.Scan(&count); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return count, err
+}
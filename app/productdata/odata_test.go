@@ -0,0 +1,41 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package productdata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestODataMetadata(t *testing.T) {
+
+	metadata, err := ODataMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`<edmx:Edmx xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx" Version="4.0">`,
+		`<EntityType Name="SKUData">`,
+		`<PropertyRef Name="sku"></PropertyRef>`,
+		`<Property Name="sku" Type="Edm.String" Nullable="false"></Property>`,
+		`<Property Name="productList" Type="Collection(ProductDataService.ProductData)"></Property>`,
+		`<Property Name="dailyTurn" Type="Edm.Double"></Property>`,
+		`<Property Name="lastUpdated" Type="Edm.Int64"></Property>`,
+		`<ComplexType Name="Metadata" OpenType="true"></ComplexType>`,
+		`<EntitySet Name="skus" EntityType="ProductDataService.SKUData"></EntitySet>`,
+	}
+	for _, element := range expected {
+		if !strings.Contains(string(metadata), element) {
+			t.Errorf("Expected %s in the metadata document:\n%s", element, metadata)
+		}
+	}
+
+	// Unexported fields are left out
+	if strings.Contains(string(metadata), "present") {
+		t.Errorf("Unexpected unexported field in the metadata document:\n%s", metadata)
+	}
+}
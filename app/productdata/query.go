@@ -0,0 +1,224 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package productdata
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-go-odata/parser"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// productAlias is the SQL alias of the products of a SKU when filtering, trimming or projecting them
+const productAlias = "product"
+
+// odataQuery is an OData query of the SKUs, translated by go-odata. The lambdas on the products
+// like productList/any(p: p/metadata/color eq 'red') and the $select of product attributes like
+// productList/productId, which go-odata cannot translate, are applied to the SKUs beforehand, in
+// a common table expression standing for the table of the SKUs.
+type odataQuery struct {
+	// odata is the query left to go-odata
+	odata   url.Values
+	lambdas []productLambda
+	// productFields are the attributes of the products to return, all of them when empty
+	productFields []string
+}
+
+// odataSelectSQL returns the SQL query of the SKUs matching an OData query
+func odataSelectSQL(query url.Values) (string, error) {
+	parsed, err := parseODataQuery(query)
+	if err != nil {
+		return "", err
+	}
+	selectQuery, err := odataSQL(parsed.odata)
+	if err != nil {
+		return "", err
+	}
+	return parsed.withProducts(selectQuery)
+}
+
+// ValidateQuery checks that an OData query can be run, so that it can be saved and run later
+func ValidateQuery(query url.Values) error {
+	_, err := odataSelectSQL(query)
+	return err
+}
+
+// PositionedSQL returns the SQL query of the SKUs matching an OData query along with their position
+// in its order, in a position column. $top and $skip are left out, so that it can be materialized
+// and paged through.
+func PositionedSQL(query url.Values) (string, error) {
+
+	parsed, err := parseODataQuery(query)
+	if err != nil {
+		return "", err
+	}
+
+	unpaged := url.Values{}
+	for key, values := range parsed.odata {
+		if key != parser.Top && key != parser.Skip {
+			unpaged[key] = values
+		}
+	}
+	selectQuery, err := odataSQL(unpaged)
+	if err != nil {
+		return "", err
+	}
+
+	// SKUs are ordered the way go-odata orders them, by the text of the attributes, and by sku
+	column := pq.QuoteIdentifier(jsonbColumn)
+	var expressions []string
+	if unpaged.Get(parser.OrderBy) != "" {
+		options, err := parser.ParseURLValues(url.Values{parser.OrderBy: {unpaged.Get(parser.OrderBy)}})
+		if err != nil {
+			return "", web.InvalidInputError(err)
+		}
+		orderBy, _ := options[parser.OrderBy].([]parser.OrderItem)
+		for _, item := range orderBy {
+			expression := fmt.Sprintf("%s ->> %s", column, pq.QuoteLiteral(item.Field))
+			if item.Order == "desc" {
+				expression += " DESC"
+			}
+			expressions = append(expressions, expression)
+		}
+	}
+	expressions = append(expressions, fmt.Sprintf("%s ->> 'sku'", column))
+
+	return parsed.withProducts(fmt.Sprintf("SELECT row_number() OVER (ORDER BY %s) AS position, %s",
+		strings.Join(expressions, ", "), strings.TrimPrefix(selectQuery, "SELECT ")))
+}
+
+// odataCountSQL returns the SQL query of the number of SKUs matching the $filter of an OData query
+func odataCountSQL(query url.Values) (string, error) {
+
+	filter := url.Values{}
+	if query.Get(parser.Filter) != "" {
+		filter.Set(parser.Filter, query.Get(parser.Filter))
+	}
+	parsed, err := parseODataQuery(filter)
+	if err != nil {
+		return "", err
+	}
+	if len(parsed.odata) == 0 {
+		return parsed.withProducts(fmt.Sprintf("SELECT count(*) FROM %s", pq.QuoteIdentifier(productDataTable)))
+	}
+
+	// Only the SKUs are selected to keep the rows small
+	parsed.odata.Set(parser.Select, "sku")
+	selectQuery, err := odataSQL(parsed.odata)
+	if err != nil {
+		return "", err
+	}
+	return parsed.withProducts(fmt.Sprintf("SELECT count(*) FROM (%s) AS matches", selectQuery))
+}
+
+// parseODataQuery splits the lambdas on the products out of the $filter of a query and the
+// attributes of the products out of its $select, leaving the rest to go-odata
+func parseODataQuery(query url.Values) (*odataQuery, error) {
+
+	parsed := &odataQuery{odata: url.Values{}}
+	for key, values := range query {
+		if key != parser.Filter && key != parser.Select {
+			parsed.odata[key] = values
+		}
+	}
+
+	if filter := query.Get(parser.Filter); filter != "" {
+		productFilter, err := parseProductFilter(filter)
+		if err != nil {
+			return nil, web.InvalidInputError(err)
+		}
+		if err := checkFilterComplexity(productFilter); err != nil {
+			return nil, err
+		}
+		parsed.lambdas = productFilter.lambdas
+		if productFilter.odata != "" {
+			parsed.odata.Set(parser.Filter, productFilter.odata)
+		}
+	}
+
+	if _, ok := query[parser.Select]; ok {
+		var selected []string
+		for _, item := range strings.Split(query.Get(parser.Select), ",") {
+			segments := strings.Split(strings.TrimSpace(item), "/")
+			switch {
+			case len(segments) == 1:
+				selected = append(selected, item)
+			case len(segments) == 2 && segments[0] == productListField && segments[1] != "":
+				if len(parsed.productFields) == 0 {
+					selected = append(selected, productListField)
+				}
+				parsed.productFields = append(parsed.productFields, segments[1])
+			default:
+				return nil, web.InvalidInputError(errors.Errorf("cannot select %s, only the attributes of the SKUs and of their products can be", item))
+			}
+		}
+		parsed.odata.Set(parser.Select, strings.Join(selected, ","))
+	}
+
+	return parsed, nil
+}
+
+// withProducts adds the common table expression of the SKUs matching the lambdas to a query of
+// the SKUs, with their products trimmed to those matching productList/any lambdas and projected
+// to the selected attributes
+func (parsed *odataQuery) withProducts(query string) (string, error) {
+
+	if len(parsed.lambdas) == 0 && len(parsed.productFields) == 0 {
+		return query, nil
+	}
+
+	column := pq.QuoteIdentifier(jsonbColumn)
+	table := pq.QuoteIdentifier(productDataTable)
+	product := productAlias + ".element"
+
+	var conditions, trimmed []string
+	for _, lambda := range parsed.lambdas {
+		predicate, err := lambdaSQL(lambda.predicate, lambda.variable, product)
+		if err != nil {
+			return "", web.InvalidInputError(err)
+		}
+		if lambda.operator == "all" {
+			conditions = append(conditions, fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s WHERE NOT COALESCE(%s, false))", productsSQL(), predicate))
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s)", productsSQL(), predicate))
+		trimmed = append(trimmed, predicate)
+	}
+
+	data := column
+	if len(trimmed) > 0 || len(parsed.productFields) > 0 {
+		if len(parsed.productFields) > 0 {
+			members := make([]string, len(parsed.productFields))
+			for i, field := range parsed.productFields {
+				members[i] = fmt.Sprintf("%s, %s -> %s", pq.QuoteLiteral(field), product, pq.QuoteLiteral(field))
+			}
+			product = "jsonb_build_object(" + strings.Join(members, ", ") + ")"
+		}
+		where := ""
+		if len(trimmed) > 0 {
+			where = " WHERE " + strings.Join(trimmed, " AND ")
+		}
+		data = fmt.Sprintf("jsonb_set(%s, %s, (SELECT COALESCE(jsonb_agg(%s ORDER BY %s.ordinality), '[]'::jsonb) FROM %s%s))",
+			column, pq.QuoteLiteral("{"+productListField+"}"), product, productAlias, productsSQL(), where)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return fmt.Sprintf("WITH %s AS (SELECT id, %s AS %s FROM %s%s) %s", table, data, column, table, where, query), nil
+}
+
+// productsSQL returns the SQL of the products of a SKU, none when its productList is not an array
+func productsSQL() string {
+	products := fmt.Sprintf("%s -> %s", pq.QuoteIdentifier(jsonbColumn), pq.QuoteLiteral(productListField))
+	return fmt.Sprintf("jsonb_array_elements(CASE WHEN jsonb_typeof(%s) = 'array' THEN %s ELSE '[]'::jsonb END) WITH ORDINALITY AS %s(element, ordinality)",
+		products, products, productAlias)
+}
@@ -0,0 +1,79 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package productdata
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/url"
+
+	odata "github.com/intel/rsp-sw-toolkit-im-suite-go-odata/postgresql"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+// translatorDB is the database go-odata translates the OData queries for. Rather than running
+// them, it returns them as capturedQuery errors, so that they run with a context and a statement
+// timeout as other queries do.
+var translatorDB = sql.OpenDB(translatorConnector{})
+
+// capturedQuery is the SQL query go-odata ran on translatorDB
+type capturedQuery string
+
+func (query capturedQuery) Error() string {
+	return "captured query " + string(query)
+}
+
+type translatorConnector struct{}
+
+func (translatorConnector) Connect(context.Context) (driver.Conn, error) {
+	return translatorConn{}, nil
+}
+
+func (translatorConnector) Driver() driver.Driver {
+	return translatorDriver{}
+}
+
+type translatorDriver struct{}
+
+func (translatorDriver) Open(string) (driver.Conn, error) {
+	return translatorConn{}, nil
+}
+
+type translatorConn struct{}
+
+func (translatorConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	return nil, capturedQuery(query)
+}
+
+func (translatorConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, capturedQuery(query)
+}
+
+func (translatorConn) Close() error {
+	return nil
+}
+
+func (translatorConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("the OData translator does not run transactions")
+}
+
+// odataSQL returns the SQL query go-odata translates an OData query of the SKUs into
+func odataSQL(query url.Values) (string, error) {
+
+	_, err := odata.ODataSQLQuery(query, productDataTable, jsonbColumn, translatorDB)
+	if captured, ok := err.(capturedQuery); ok {
+		return string(captured), nil
+	}
+	if errors.Cause(err) == odata.ErrInvalidInput {
+		return "", web.InvalidInputError(err)
+	}
+	if err == nil {
+		err = errors.New("the OData translator ran no query")
+	}
+	return "", err
+}
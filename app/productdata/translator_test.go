@@ -0,0 +1,79 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package productdata
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+)
+
+// The queries not reaching into the products are translated by go-odata as they always were
+func TestODataSQL(t *testing.T) {
+
+	tests := []struct {
+		query      string
+		selectSQL  string
+		countSQL   string
+		positioned string
+	}{
+		{
+			"$filter=sku eq 'MS122-32'&$top=10",
+			`SELECT *  FROM "skus" WHERE "data" ->> 'sku' = 'MS122-32' LIMIT 10`,
+			`SELECT count(*) FROM (SELECT id,jsonb_build_object('sku', "data" -> 'sku' ) AS "data" FROM "skus" WHERE "data" ->> 'sku' = 'MS122-32') AS matches`,
+			`SELECT row_number() OVER (ORDER BY "data" ->> 'sku') AS position, *  FROM "skus" WHERE "data" ->> 'sku' = 'MS122-32'`,
+		},
+		{
+			"$filter=sku ne 'MS122-32' and dailyTurn gt 0.5",
+			`SELECT *  FROM "skus" WHERE "data" ->> 'sku' != 'MS122-32' and "data" ->> 'dailyTurn' > '0.5'`,
+			`SELECT count(*) FROM (SELECT id,jsonb_build_object('sku', "data" -> 'sku' ) AS "data" FROM "skus" WHERE "data" ->> 'sku' != 'MS122-32' and "data" ->> 'dailyTurn' > '0.5') AS matches`,
+			`SELECT row_number() OVER (ORDER BY "data" ->> 'sku') AS position, *  FROM "skus" WHERE "data" ->> 'sku' != 'MS122-32' and "data" ->> 'dailyTurn' > '0.5'`,
+		},
+		{
+			"$filter=contains(sku, 'MS') or startswith(sku, 'MS') and endswith(sku, '32')",
+			`SELECT *  FROM "skus" WHERE "data" ->> 'sku' LIKE '%MS%' or "data" ->> 'sku' LIKE 'MS%' and "data" ->> 'sku' LIKE '%32'`,
+			`SELECT count(*) FROM (SELECT id,jsonb_build_object('sku', "data" -> 'sku' ) AS "data" FROM "skus" WHERE "data" ->> 'sku' LIKE '%MS%' or "data" ->> 'sku' LIKE 'MS%' and "data" ->> 'sku' LIKE '%32') AS matches`,
+			`SELECT row_number() OVER (ORDER BY "data" ->> 'sku') AS position, *  FROM "skus" WHERE "data" ->> 'sku' LIKE '%MS%' or "data" ->> 'sku' LIKE 'MS%' and "data" ->> 'sku' LIKE '%32'`,
+		},
+		{
+			"$select=sku,productList&$orderby=sku desc,dailyTurn&$skip=5&$top=10",
+			`SELECT id,jsonb_build_object('sku', "data" -> 'sku','productList', "data" -> 'productList' ) AS "data" FROM "skus" ORDER BY "data" ->> 'sku' DESC ,"data" ->> 'dailyTurn' LIMIT 10 OFFSET 5`,
+			`SELECT count(*) FROM "skus"`,
+			`SELECT row_number() OVER (ORDER BY "data" ->> 'sku' DESC, "data" ->> 'dailyTurn', "data" ->> 'sku') AS position, id,jsonb_build_object('sku', "data" -> 'sku','productList', "data" -> 'productList' ) AS "data" FROM "skus" ORDER BY "data" ->> 'sku' DESC ,"data" ->> 'dailyTurn'`,
+		},
+		{
+			"$filter=lastUpdated ge 1560000000&$inlinecount=allpages",
+			`SELECT *  FROM "skus" WHERE "data" ->> 'lastUpdated' >= '1560000000'`,
+			`SELECT count(*) FROM (SELECT id,jsonb_build_object('sku', "data" -> 'sku' ) AS "data" FROM "skus" WHERE "data" ->> 'lastUpdated' >= '1560000000') AS matches`,
+			`SELECT row_number() OVER (ORDER BY "data" ->> 'sku') AS position, *  FROM "skus" WHERE "data" ->> 'lastUpdated' >= '1560000000'`,
+		},
+	}
+
+	for _, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if selectSQL, err := odataSelectSQL(query); err != nil || selectSQL != test.selectSQL {
+			t.Errorf("Expected %s to be translated into\n%s\nbut got\n%s %v", test.query, test.selectSQL, selectSQL, err)
+		}
+		if countSQL, err := odataCountSQL(query); err != nil || countSQL != test.countSQL {
+			t.Errorf("Expected %s to be counted with\n%s\nbut got\n%s %v", test.query, test.countSQL, countSQL, err)
+		}
+		if positioned, err := PositionedSQL(query); err != nil || positioned != test.positioned {
+			t.Errorf("Expected %s to be positioned with\n%s\nbut got\n%s %v", test.query, test.positioned, positioned, err)
+		}
+	}
+
+	for _, filter := range []string{"sku eq", "sku eq 'MS122-32')", "sku like 'MS'", "lastUpdated gt 2019-06-01"} {
+		_, err := odataSelectSQL(url.Values{"$filter": {filter}})
+		if common, ok := err.(web.CommonError); !ok || common.Code != http.StatusBadRequest {
+			t.Errorf("Expected a bad request for %q, but got %v", filter, err)
+		}
+	}
+}
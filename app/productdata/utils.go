@@ -44,3 +44,29 @@ func MapBySku(prodDataMap map[string][]SKUData) []SKUData {
 
 	return results
 }
+
+// mergePatch applies a JSON Merge Patch (RFC 7396) to a decoded JSON document.
+// Members set to null in the patch are removed from the target, objects are merged
+// recursively and any other value replaces the target.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{}, len(patchObject))
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+
+	return targetObject
+}
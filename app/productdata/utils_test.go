@@ -6,6 +6,7 @@
 package productdata
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 )
@@ -106,3 +107,47 @@ func containsProductID(sku string, productID string, prodData []SKUData) bool {
 	}
 	return false
 }
+
+func TestMergePatch(t *testing.T) {
+
+	// Test cases from RFC 7396 Appendix A
+	testCases := []struct {
+		target   string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, testCase := range testCases {
+		var target, patch, expected interface{}
+		if err := json.Unmarshal([]byte(testCase.target), &target); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(testCase.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(testCase.expected), &expected); err != nil {
+			t.Fatal(err)
+		}
+
+		if result := mergePatch(target, patch); !reflect.DeepEqual(result, expected) {
+			t.Errorf("Merge patch %s on %s expected %s, but got %v",
+				testCase.patch, testCase.target, testCase.expected, result)
+		}
+	}
+}
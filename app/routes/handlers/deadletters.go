@@ -0,0 +1,115 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/deadletter"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/pborman/uuid"
+)
+
+// defaultDeadLetterLimit is the number of dead letters listed when no limit is given
+const defaultDeadLetterLimit = 100
+
+// DeadLetters represents the dead-letter admin API method handler set.
+type DeadLetters struct {
+	Store *deadletter.Store
+	Size  int
+}
+
+// ListDeadLetters lists the events that failed ingestion, without their payload
+// 200 OK, 400 Bad Request, 500 Internal Error
+func (deadLetters *DeadLetters) ListDeadLetters(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	status := request.URL.Query().Get("status")
+	if status != "" && status != deadletter.StatusPending && status != deadletter.StatusFailed {
+		return web.ValidationError("status must be pending or failed")
+	}
+
+	limit := defaultDeadLetterLimit
+	if value := request.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			return web.ValidationError("limit must be a positive integer")
+		}
+	}
+	if limit > deadLetters.Size {
+		limit = deadLetters.Size
+	}
+
+	letters, err := deadLetters.Store.List(status, limit)
+	if err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, Response{Results: letters}, http.StatusOK)
+	return nil
+}
+
+// GetDeadLetter returns an event that failed ingestion along with its raw payload
+// 200 OK, 400 Bad Request, 404 Not Found, 500 Internal Error
+func (deadLetters *DeadLetters) GetDeadLetter(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	id, err := deadLetterID(request)
+	if err != nil {
+		return err
+	}
+
+	letter, err := deadLetters.Store.Get(id)
+	if err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, letter, http.StatusOK)
+	return nil
+}
+
+// ReplayDeadLetter ingests an event again, removing it from the dead-letter store when it succeeds
+// 204 No Content, 400 Bad Request, 404 Not Found, 500 Internal Error
+func (deadLetters *DeadLetters) ReplayDeadLetter(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	id, err := deadLetterID(request)
+	if err != nil {
+		return err
+	}
+
+	if err := deadLetters.Store.Replay(id); err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, nil, http.StatusNoContent)
+	return nil
+}
+
+// DiscardDeadLetter removes an event from the dead-letter store without ingesting it
+// 204 No Content, 400 Bad Request, 404 Not Found, 500 Internal Error
+func (deadLetters *DeadLetters) DiscardDeadLetter(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	id, err := deadLetterID(request)
+	if err != nil {
+		return err
+	}
+
+	if err := deadLetters.Store.Discard(id); err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, nil, http.StatusNoContent)
+	return nil
+}
+
+func deadLetterID(request *http.Request) (string, error) {
+	id := mux.Vars(request)["id"]
+	if uuid.Parse(id) == nil {
+		return "", web.InvalidIDError()
+	}
+	return id, nil
+}
@@ -0,0 +1,76 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/deadletter"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+)
+
+func TestDeadLetterInvalidID(t *testing.T) {
+
+	deadLetters := DeadLetters{Store: deadletter.NewStore(nil, nil, deadletter.RetryPolicy{}), Size: 1000}
+
+	testRouter := mux.NewRouter().StrictSlash(true)
+	testRouter.Path("/admin/deadletters/{id}").Methods("GET").Handler(web.Handler(deadLetters.GetDeadLetter))
+	testRouter.Path("/admin/deadletters/{id}").Methods("DELETE").Handler(web.Handler(deadLetters.DiscardDeadLetter))
+	testRouter.Path("/admin/deadletters/{id}/replay").Methods("POST").Handler(web.Handler(deadLetters.ReplayDeadLetter))
+
+	requests := []struct {
+		method string
+		url    string
+	}{
+		{"GET", "/admin/deadletters/not-a-uuid"},
+		{"DELETE", "/admin/deadletters/1234"},
+		{"POST", "/admin/deadletters/1234/replay"},
+	}
+
+	for _, item := range requests {
+		request, err := http.NewRequest(item.method, item.url, nil)
+		if err != nil {
+			t.Fatalf("Unable to create new HTTP request %+v", err)
+		}
+
+		testRecorder := httptest.NewRecorder()
+		testRouter.ServeHTTP(testRecorder, request)
+
+		if testRecorder.Code != http.StatusBadRequest {
+			t.Errorf("%s %s expected: %d Actual: %d", item.method, item.url, http.StatusBadRequest, testRecorder.Code)
+		}
+	}
+}
+
+func TestListDeadLettersBadRequest(t *testing.T) {
+
+	deadLetters := DeadLetters{Store: deadletter.NewStore(nil, nil, deadletter.RetryPolicy{}), Size: 1000}
+	handler := web.Handler(deadLetters.ListDeadLetters)
+
+	urls := []string{
+		"/admin/deadletters?status=unknown",
+		"/admin/deadletters?limit=0",
+		"/admin/deadletters?limit=ten",
+	}
+
+	for _, url := range urls {
+		request, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatalf("Unable to create new HTTP request %+v", err)
+		}
+
+		testRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(testRecorder, request)
+
+		if testRecorder.Code != http.StatusBadRequest {
+			t.Errorf("%s expected: %d Actual: %d", url, http.StatusBadRequest, testRecorder.Code)
+		}
+	}
+}
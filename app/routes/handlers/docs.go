@@ -0,0 +1,185 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/openapi"
+)
+
+// Docs serves the OpenAPI document of the service and a page to browse it
+type Docs struct {
+	Document *openapi.Document
+}
+
+// GetOpenAPI returns the OpenAPI 3 document describing the routes
+// 200 OK
+func (docs *Docs) GetOpenAPI(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	return json.NewEncoder(writer).Encode(docs.Document)
+}
+
+// GetDocs returns a page rendering the OpenAPI document, without depending on external scripts
+// 200 OK
+func (docs *Docs) GetDocs(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	_, err := writer.Write([]byte(docsPage))
+	return err
+}
+
+// docsPage lists the operations of /openapi.json by tag, along with the schemas of the models
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Product Data API</title>
+<style>
+body { font-family: sans-serif; margin: 0 auto; max-width: 960px; padding: 1em; color: #222; }
+h2 { border-bottom: 1px solid #ccc; text-transform: capitalize; }
+details { border: 1px solid #ddd; border-radius: 4px; margin: .5em 0; padding: .5em; }
+summary { cursor: pointer; }
+.method { display: inline-block; width: 4.5em; font-weight: bold; text-transform: uppercase; }
+.get { color: #0a6; } .post { color: #07c; } .put { color: #c70; } .patch { color: #a5c; } .delete { color: #c33; }
+code, pre { background: #f5f5f5; border-radius: 3px; }
+pre { padding: .5em; overflow-x: auto; }
+table { border-collapse: collapse; } td, th { border: 1px solid #ddd; padding: .25em .5em; text-align: left; }
+</style>
+</head>
+<body>
+<h1 id="title">Product Data API</h1>
+<p id="description"></p>
+<p><a href="openapi.json">openapi.json</a></p>
+<div id="operations"></div>
+<h2>Models</h2>
+<div id="models"></div>
+<script>
+function element(tag, className, text) {
+  var node = document.createElement(tag);
+  if (className) node.className = className;
+  if (text !== undefined) node.textContent = text;
+  return node;
+}
+
+// Renders the code blocks and code spans of the descriptions, the rest being kept as text
+function markdown(text) {
+  var container = element("div");
+  (text || "").split(/` + "```" + `[a-z]*\n?/).forEach(function (part, index) {
+    if (index % 2 === 1) {
+      container.appendChild(element("pre", "", part));
+      return;
+    }
+    part.split(/\n\n+/).forEach(function (paragraph) {
+      if (!paragraph.trim()) return;
+      var p = element("p");
+      paragraph.split("` + "`" + `").forEach(function (span, spanIndex) {
+        p.appendChild(spanIndex % 2 === 1 ? element("code", "", span) : document.createTextNode(span));
+      });
+      container.appendChild(p);
+    });
+  });
+  return container;
+}
+
+function schemaText(schema) {
+  if (!schema) return "";
+  if (schema.$ref) return schema.$ref.split("/").pop();
+  if (schema.type === "array") return "[" + schemaText(schema.items) + "]";
+  if (schema.type === "object" && schema.properties) {
+    return "{" + Object.keys(schema.properties).map(function (name) {
+      return name + ": " + schemaText(schema.properties[name]);
+    }).join(", ") + "}";
+  }
+  if (schema.type === "object") return "{string: " + (schemaText(schema.additionalProperties) || "any") + "}";
+  return (schema.type || "any") + (schema.format ? " (" + schema.format + ")" : "") + (schema.nullable ? "?" : "");
+}
+
+function table(headers, rows) {
+  var node = element("table"), head = element("tr");
+  headers.forEach(function (header) { head.appendChild(element("th", "", header)); });
+  node.appendChild(head);
+  rows.forEach(function (row) {
+    var tr = element("tr");
+    row.forEach(function (cell) { tr.appendChild(element("td", "", cell)); });
+    node.appendChild(tr);
+  });
+  return node;
+}
+
+function contentText(content) {
+  return Object.keys(content || {}).map(function (type) {
+    return type + " " + schemaText(content[type].schema);
+  }).join("\n");
+}
+
+function render(spec) {
+  document.getElementById("title").textContent = spec.info.title + " " + spec.info.version;
+  document.getElementById("description").textContent = spec.info.description || "";
+
+  var byTag = {};
+  Object.keys(spec.paths).sort().forEach(function (path) {
+    Object.keys(spec.paths[path]).forEach(function (method) {
+      var operation = spec.paths[path][method];
+      var tag = (operation.tags || ["default"])[0];
+      (byTag[tag] = byTag[tag] || []).push({ path: path, method: method, operation: operation });
+    });
+  });
+
+  var operations = document.getElementById("operations");
+  (spec.tags || []).forEach(function (tag) {
+    operations.appendChild(element("h2", "", tag.name));
+    (byTag[tag.name] || []).forEach(function (entry) {
+      var operation = entry.operation, details = element("details"), summary = element("summary");
+      summary.appendChild(element("span", "method " + entry.method, entry.method));
+      summary.appendChild(element("code", "", entry.path));
+      summary.appendChild(document.createTextNode(" " + (operation.summary || "")));
+      details.appendChild(summary);
+      if (operation["x-required-scope"]) {
+        details.appendChild(element("p", "", "Required scope: " + operation["x-required-scope"]));
+      }
+      details.appendChild(markdown(operation.description));
+      if (operation.parameters) {
+        details.appendChild(table(["Parameter", "In", "Type", "Description"], operation.parameters.map(function (param) {
+          return [param.name + (param.required ? " *" : ""), param.in, schemaText(param.schema), param.description || ""];
+        })));
+      }
+      if (operation.requestBody) {
+        details.appendChild(element("h4", "", "Request body"));
+        details.appendChild(element("pre", "", contentText(operation.requestBody.content)));
+      }
+      details.appendChild(table(["Status", "Description", "Body"], Object.keys(operation.responses).sort().map(function (code) {
+        var response = operation.responses[code];
+        return [code, response.description, contentText(response.content)];
+      })));
+      operations.appendChild(details);
+    });
+  });
+
+  var models = document.getElementById("models");
+  Object.keys(spec.components.schemas || {}).sort().forEach(function (name) {
+    var schema = spec.components.schemas[name];
+    var details = element("details");
+    details.appendChild(element("summary", "", name));
+    details.appendChild(table(["Property", "Type"], Object.keys(schema.properties || {}).map(function (property) {
+      return [property, schemaText(schema.properties[property])];
+    })));
+    models.appendChild(details);
+  });
+}
+
+fetch("openapi.json").then(function (response) { return response.json(); }).then(render).catch(function (err) {
+  document.getElementById("description").textContent = "Unable to load openapi.json: " + err;
+});
+</script>
+</body>
+</html>
+`
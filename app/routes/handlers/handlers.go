@@ -10,17 +10,23 @@ import (
 	"database/sql"
 	"encoding/json"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
-	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/intel/rsp-sw-toolkit-im-suite-gojsonschema"
 	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/productdata"
 	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/pkg/errors"
 )
 
+// mergePatchMediaType is the media type of JSON Merge Patch (RFC 7396) documents
+const mergePatchMediaType = "application/merge-patch+json"
+
 // Mapping represents the User API method handler set.
 type Mapping struct {
 	MasterDB *sql.DB
@@ -35,6 +41,12 @@ type Response struct {
 	Count   *int        `json:"count,omitempty"`
 }
 
+// FlushResponse tells how many cached entries were removed
+// swagger:model flushResponse
+type FlushResponse struct {
+	Flushed int `json:"flushed"`
+}
+
 // ErrorList provides a collection of errors for processing
 // swagger:response schemaValidation
 type ErrorList struct {
@@ -61,11 +73,15 @@ func (mapp *Mapping) Index(ctx context.Context, writer http.ResponseWriter, requ
 }
 
 // GetSkuMapping retrieves sku mapping list
-// 200 OK, 400 Bad Request, 500 Internal Error
+// 200 OK, 400 Bad Request, 500 Internal Error, 503 Service Unavailable
 func (mapp *Mapping) GetSkuMapping(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
 
-	results, count, err := productdata.Retrieve(mapp.MasterDB, request.URL.Query(), mapp.Size)
+	results, count, err := productdata.Retrieve(ctx, mapp.MasterDB, request.URL.Query(), mapp.Size)
 	if err != nil {
+		// Timeouts and invalid queries already have their status
+		if _, isCommon := err.(web.CommonError); isCommon {
+			return err
+		}
 		return web.InvalidInputError(err)
 	}
 
@@ -89,11 +105,14 @@ func (mapp *Mapping) PostSkuMapping(ctx context.Context, writer http.ResponseWri
 
 	mappings := productdata.Root{}
 
-	// Reading request with a limit of 32mb
-	body := make([]byte, request.ContentLength)
-	_, err := io.ReadFull(request.Body, body)
-	if err != nil {
-		return err
+	// The body size is limited while it is decoded, see middlewares.BodyLimiter
+	var body json.RawMessage
+	decoder := json.NewDecoder(request.Body)
+	if err := decoder.Decode(&body); err != nil {
+		return bodyError(err)
+	}
+	if decoder.More() {
+		return web.InvalidInputError(errors.New("unexpected data after the JSON document"))
 	}
 
 	// Validate JSON schema for mapping SKU service
@@ -137,7 +156,7 @@ func (mapp *Mapping) PostSkuMapping(ctx context.Context, writer http.ResponseWri
 		return web.InvalidInputError(err)
 	}
 
-	if err := productdata.Insert(mapp.MasterDB, mappings.Data); err != nil {
+	if err := productdata.Insert(ctx, mapp.MasterDB, mappings.Data); err != nil {
 		return err
 	}
 
@@ -145,13 +164,46 @@ func (mapp *Mapping) PostSkuMapping(ctx context.Context, writer http.ResponseWri
 	return nil
 }
 
-// GetProductID returns upc with metadata
-// 200 OK, 400 Bad Request,  404 Not Found, 500 Internal Error
+// GetProductID returns the product of a product ID along with its SKU and the IDs of the other
+// products of the SKU, ?fields= selecting the metadata keys returned
+// 200 OK, 400 Bad Request,  404 Not Found, 500 Internal Error, 503 Service Unavailable
 func (mapp *Mapping) GetProductID(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
 
+	product, err := mapp.getProduct(ctx, request)
+	if err != nil {
+		// Unknown products are answered without a body in v1
+		if web.IsNotFoundError(err) {
+			web.Respond(ctx, writer, nil, http.StatusNotFound)
+			return nil
+		}
+		return err
+	}
+
+	web.Respond(ctx, writer, product, http.StatusOK)
+	return nil
+}
+
+// GetProductIDV2 returns the same product as GetProductID, unknown products getting an error body
+// 200 OK, 400 Bad Request,  404 Not Found, 500 Internal Error, 503 Service Unavailable
+func (mapp *Mapping) GetProductIDV2(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	product, err := mapp.getProduct(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, product, http.StatusOK)
+	return nil
+}
+
+// getProduct looks up the product of the product ID of the request
+func (mapp *Mapping) getProduct(ctx context.Context, request *http.Request) (productdata.SKUProduct, error) {
+
 	metrics.GetOrRegisterGauge("Product-Data.GetProductID.Attempt", nil).Update(1)
 	startTime := time.Now()
-	defer metrics.GetOrRegisterTimer("Product-Data.GetProductID.Latency", nil).Update(time.Since(startTime))
+	defer func() {
+		metrics.GetOrRegisterTimer("Product-Data.GetProductID.Latency", nil).Update(time.Since(startTime))
+	}()
 	mSuccess := metrics.GetOrRegisterGauge("Product-Data.GetProductID.Success", nil)
 	mGetProductMetadataErr := metrics.GetOrRegisterGauge("Product-Data.GetProductID.GetProductMetadataError", nil)
 
@@ -159,25 +211,100 @@ func (mapp *Mapping) GetProductID(ctx context.Context, writer http.ResponseWrite
 	productId := vars["productId"]
 
 	if err := isValidProductID(productId); err != nil {
-		web.Respond(ctx, writer, nil, http.StatusBadRequest)
-		return err
+		return productdata.SKUProduct{}, err
 	}
 
-	prodData, err := productdata.GetProductMetadata(mapp.MasterDB, productId)
+	product, err := productdata.GetProduct(ctx, mapp.MasterDB, productId, metadataFields(request.URL.Query()))
 	if err != nil {
 		if web.IsNotFoundError(err) {
 			mGetProductMetadataErr.Update(1)
-			web.Respond(ctx, writer, nil, http.StatusNotFound)
-			return nil
 		}
-		return err
+		return productdata.SKUProduct{}, err
 	}
 
 	mSuccess.Update(1)
-	web.Respond(ctx, writer, prodData.ProductList[0], http.StatusOK)
+	return product, nil
+}
+
+// metadataFields returns the metadata keys listed in ?fields=, separated by commas
+func metadataFields(query url.Values) []string {
+
+	var fields []string
+	for _, value := range query["fields"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// GetSku returns the document of a SKU, whose ETag can be sent back in the If-Match header of a patch
+// 200 OK, 304 Not Modified, 404 Not Found, 500 Internal Error, 503 Service Unavailable
+func (mapp *Mapping) GetSku(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	skuData, err := productdata.GetSku(ctx, mapp.MasterDB, mux.Vars(request)["sku"])
+	if err != nil {
+		return err
+	}
+
+	// The ETag of the representation is derived from the one of the SKU, which PatchProduct checks
+	etag, err := productdata.ETag(skuData)
+	if err != nil {
+		return err
+	}
+
+	writer.Header().Set("ETag", etag)
+	web.Respond(ctx, writer, skuData, http.StatusOK)
+	return nil
+}
+
+// PatchProduct updates the supplied attributes of a product using JSON Merge Patch
+// 200 OK, 400 Bad Request, 404 Not Found, 412 Precondition Failed, 415 Unsupported Media Type, 500 Internal Error
+func (mapp *Mapping) PatchProduct(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || (mediaType != mergePatchMediaType && mediaType != "application/json") {
+		return web.UnsupportedMediaTypeError(mergePatchMediaType)
+	}
+
+	var patch map[string]interface{}
+	if err := json.NewDecoder(request.Body).Decode(&patch); err != nil {
+		return bodyError(err)
+	}
+	if patch == nil {
+		return web.InvalidInputError(errors.New("merge patch must be a JSON object"))
+	}
+
+	vars := mux.Vars(request)
+
+	product, etag, err := productdata.PatchProduct(ctx, mapp.MasterDB, vars["sku"], vars["productId"], request.Header.Get("If-Match"), patch)
+	if err != nil {
+		return err
+	}
+
+	writer.Header().Set("ETag", etag)
+	web.Respond(ctx, writer, product, http.StatusOK)
 	return nil
 }
 
+// FlushCache empties the cache of product ID lookups, for instance after the database was modified directly
+// 200 OK
+// nolint: unparam
+func (mapp *Mapping) FlushCache(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	web.Respond(ctx, writer, FlushResponse{Flushed: productdata.FlushCache()}, http.StatusOK)
+	return nil
+}
+
+// bodyError returns the errors of the body limiter as they are, and the other decoding errors as invalid input
+func bodyError(err error) error {
+	if _, ok := err.(web.CommonError); ok {
+		return err
+	}
+	return web.InvalidInputError(err)
+}
+
 func isValidProductID(productID string) error {
 	if _, err := strconv.Atoi(productID); err != nil {
 		return web.ValidationError("productID contains non integer characters")
@@ -8,12 +8,15 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -396,6 +399,97 @@ func TestGetProductID(t *testing.T) {
 	}
 }
 
+func TestGetProductIDMultipleProducts(t *testing.T) {
+	db := dbSetup(t)
+
+	var skus []productdata.SKUData
+	err := json.Unmarshal([]byte(`[
+		{ "sku":"MS122-35", "name":"mens formal shirt",
+		  "productList": [
+			{"productId": "12345678912351", "metadata": {"color":"blue", "size":"small"} },
+			{"productId": "12345678912352", "metadata": {"color":"red", "size":"medium"} },
+			{"productId": "12345678912353", "metadata": {"color":"green", "size":"large"} }
+		  ]
+		}
+	]`), &skus)
+	if err != nil {
+		t.Fatalf("Not able to Unmarshal JSON object: %+v", err)
+	}
+	if err := productdata.Insert(context.Background(), db, skus); err != nil {
+		t.Fatalf("Not able to insert into database: %+v", err)
+	}
+
+	mapp := Mapping{db, config.AppConfig.ResponseLimit}
+	testRouter := mux.NewRouter().StrictSlash(true)
+	testRouter.Path("/v1/productid/{productId}").Handler(web.Handler(mapp.GetProductID))
+	testRouter.Path("/v2/productid/{productId}").Handler(web.Handler(mapp.GetProductIDV2))
+
+	type skuProduct struct {
+		SKU               string                 `json:"sku"`
+		ProductID         string                 `json:"productId"`
+		Metadata          map[string]interface{} `json:"metadata"`
+		SiblingProductIDs []string               `json:"siblingProductIds"`
+	}
+	get := func(url string) skuProduct {
+		testRecorder := httptest.NewRecorder()
+		testRouter.ServeHTTP(testRecorder, httptest.NewRequest("GET", url, nil))
+		if testRecorder.Code != http.StatusOK {
+			t.Fatalf("Expected: %d; Actual: %d, %s", http.StatusOK, testRecorder.Code, testRecorder.Body)
+		}
+		var product skuProduct
+		if err := json.Unmarshal(testRecorder.Body.Bytes(), &product); err != nil {
+			t.Fatal(err)
+		}
+		return product
+	}
+
+	// v1 returns the requested product rather than the first one of its SKU, along with its SKU
+	product := get("/v1/productid/12345678912352")
+	if product.SKU != "MS122-35" || product.ProductID != "12345678912352" || product.Metadata["color"] != "red" ||
+		len(product.SiblingProductIDs) != 2 {
+		t.Errorf("Expected product 12345678912352 of MS122-35, but got %+v", product)
+	}
+
+	// Only the metadata asked for is returned, along with the other products of the SKU
+	product = get("/v2/productid/12345678912353?fields=size,weight")
+	if product.SKU != "MS122-35" || product.ProductID != "12345678912353" {
+		t.Errorf("Expected product 12345678912353 of MS122-35, but got %+v", product)
+	}
+	if len(product.Metadata) != 1 || product.Metadata["size"] != "large" {
+		t.Errorf("Expected only the size in the metadata, but got %v", product.Metadata)
+	}
+	if len(product.SiblingProductIDs) != 2 || product.SiblingProductIDs[0] != "12345678912351" ||
+		product.SiblingProductIDs[1] != "12345678912352" {
+		t.Errorf("Expected siblings 12345678912351 and 12345678912352, but got %v", product.SiblingProductIDs)
+	}
+
+	// Unknown products get an error body in v2
+	testRecorder := httptest.NewRecorder()
+	testRouter.ServeHTTP(testRecorder, httptest.NewRequest("GET", "/v2/productid/12345678912359", nil))
+	if testRecorder.Code != http.StatusNotFound || testRecorder.Body.Len() == 0 {
+		t.Errorf("Expected: %d with an error; Actual: %d, %s", http.StatusNotFound, testRecorder.Code, testRecorder.Body)
+	}
+}
+
+func TestMetadataFields(t *testing.T) {
+
+	tests := map[string][]string{
+		"":                      nil,
+		"fields=color":          {"color"},
+		"fields=color, size,":   {"color", "size"},
+		"fields=color&fields=a": {"color", "a"},
+	}
+	for query, expected := range tests {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fields := metadataFields(values); !reflect.DeepEqual(fields, expected) {
+			t.Errorf("%q: expected %v, but got %v", query, expected, fields)
+		}
+	}
+}
+
 func TestGetProductIDBadRequestString(t *testing.T) {
 	url := "/productid/00000000000000"
 
@@ -424,6 +518,195 @@ func TestGetProductIDBadRequestString(t *testing.T) {
 	}
 }
 
+func TestPatchProduct(t *testing.T) {
+	db := dbSetup(t)
+	insertSampleProductMetadata(db, t)
+
+	testRouter := mux.NewRouter().StrictSlash(true)
+	mapp := Mapping{db, config.AppConfig.ResponseLimit}
+	testRouter.Path("/skus/{sku}/products/{productId}").
+		Name("testPatchProduct").
+		Handler(web.Handler(mapp.PatchProduct))
+
+	testCases := []struct {
+		url   string
+		patch string
+		code  int
+	}{
+		{"/skus/MS122-33/products/12345678912345", `{"dailyTurn": 0.2, "metadata": {"size": "M"}}`, http.StatusOK},
+		{"/skus/MS122-33/products/12345678912345", `{"dailyTurn": 1.2}`, http.StatusBadRequest},
+		{"/skus/MS122-33/products/12345678912345", `["dailyTurn"]`, http.StatusBadRequest},
+		{"/skus/MS122-33/products/00000000000000", `{"dailyTurn": 0.2}`, http.StatusNotFound},
+		{"/skus/UNKNOWN-SKU/products/12345678912345", `{"dailyTurn": 0.2}`, http.StatusNotFound},
+	}
+
+	for _, testCase := range testCases {
+		request, err := http.NewRequest("PATCH", testCase.url, strings.NewReader(testCase.patch))
+		if err != nil {
+			t.Fatalf("Unable to create new HTTP request %+v", err)
+		}
+		request.Header.Set("Content-Type", "application/merge-patch+json")
+
+		testRecorder := httptest.NewRecorder()
+		testRouter.ServeHTTP(testRecorder, request)
+
+		if testRecorder.Code != testCase.code {
+			t.Errorf("Patch %s on %s expected: %d Actual: %d, %s",
+				testCase.patch, testCase.url, testCase.code, testRecorder.Code, testRecorder.Body)
+		}
+	}
+}
+
+func TestPatchProductIfMatch(t *testing.T) {
+	db := dbSetup(t)
+	insertSampleProductMetadata(db, t)
+
+	testRouter := mux.NewRouter().StrictSlash(true)
+	mapp := Mapping{db, config.AppConfig.ResponseLimit}
+	testRouter.Path("/skus/{sku}").Methods("GET").
+		Name("testGetSku").
+		Handler(web.Handler(mapp.GetSku))
+	testRouter.Path("/skus/{sku}/products/{productId}").Methods("PATCH").
+		Name("testPatchProductIfMatch").
+		Handler(web.Handler(mapp.PatchProduct))
+
+	send := func(method string, url string, body string, header string, etag string) *httptest.ResponseRecorder {
+		request, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Unable to create new HTTP request %+v", err)
+		}
+		request.Header.Set("Content-Type", "application/merge-patch+json")
+		if etag != "" {
+			request.Header.Set(header, etag)
+		}
+		testRecorder := httptest.NewRecorder()
+		testRouter.ServeHTTP(testRecorder, request)
+		return testRecorder
+	}
+
+	testRecorder := send("GET", "/skus/MS122-33", "", "", "")
+	etag := testRecorder.Header().Get("ETag")
+	if testRecorder.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected the sku with an ETag, but got %d %v", testRecorder.Code, testRecorder.Header())
+	}
+
+	if testRecorder := send("GET", "/skus/MS122-33", "", "If-None-Match", etag); testRecorder.Code != http.StatusNotModified {
+		t.Errorf("Expected: %d Actual: %d", http.StatusNotModified, testRecorder.Code)
+	}
+
+	testRecorder = send("PATCH", "/skus/MS122-33/products/12345678912345", `{"dailyTurn": 0.3}`, "If-Match", etag)
+	if testRecorder.Code != http.StatusOK {
+		t.Fatalf("Expected: %d Actual: %d, %s", http.StatusOK, testRecorder.Code, testRecorder.Body)
+	}
+	newETag := testRecorder.Header().Get("ETag")
+
+	// Another client still holding the first ETag
+	if testRecorder := send("PATCH", "/skus/MS122-33/products/12345678912345", `{"dailyTurn": 0.4}`, "If-Match", etag); testRecorder.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected: %d Actual: %d", http.StatusPreconditionFailed, testRecorder.Code)
+	}
+
+	if testRecorder := send("GET", "/skus/MS122-33", "", "", ""); testRecorder.Header().Get("ETag") != newETag {
+		t.Errorf("Expected the ETag of the patch response %s, but got %s", newETag, testRecorder.Header().Get("ETag"))
+	}
+}
+
+func TestPatchProductIfMatchNegotiated(t *testing.T) {
+	db := dbSetup(t)
+	insertSampleProductMetadata(db, t)
+
+	testRouter := mux.NewRouter().StrictSlash(true)
+	mapp := Mapping{db, config.AppConfig.ResponseLimit}
+	testRouter.Path("/skus/{sku}").Methods("GET").
+		Name("testGetSku").
+		Handler(web.Handler(mapp.GetSku))
+	testRouter.Path("/skus/{sku}/products/{productId}").Methods("PATCH").
+		Name("testPatchProductIfMatchNegotiated").
+		Handler(web.Handler(mapp.PatchProduct))
+
+	// The ETags of the SKU read as XML or CSV differ, but are both checked against the SKU by the patch
+	etags := map[string]bool{}
+	for i, accept := range []string{"application/xml", "text/csv"} {
+		request := httptest.NewRequest("GET", "/skus/MS122-34", nil)
+		request.Header.Set("Accept", accept)
+		testRecorder := httptest.NewRecorder()
+		testRouter.ServeHTTP(testRecorder, request)
+		etag := testRecorder.Header().Get("ETag")
+		if testRecorder.Code != http.StatusOK || etag == "" {
+			t.Fatalf("%s: expected the sku with an ETag, but got %d %v", accept, testRecorder.Code, testRecorder.Header())
+		}
+		if etags[etag] {
+			t.Errorf("%s: expected an ETag of its own, but got %s", accept, etag)
+		}
+		etags[etag] = true
+
+		request = httptest.NewRequest("PATCH", "/skus/MS122-34/products/12345678912346", strings.NewReader(fmt.Sprintf(`{"dailyTurn": 0.%d}`, i+1)))
+		request.Header.Set("Content-Type", "application/merge-patch+json")
+		request.Header.Set("If-Match", etag)
+		testRecorder = httptest.NewRecorder()
+		testRouter.ServeHTTP(testRecorder, request)
+		if testRecorder.Code != http.StatusOK {
+			t.Errorf("%s: expected: %d Actual: %d, %s", accept, http.StatusOK, testRecorder.Code, testRecorder.Body)
+		}
+	}
+}
+
+func TestGetODataSkus(t *testing.T) {
+	db := dbSetup(t)
+	insertSampleProductMetadata(db, t)
+
+	testRouter := mux.NewRouter().StrictSlash(true)
+	mapp := Mapping{db, 1}
+	testRouter.Path("/odata/skus").
+		Name("testGetODataSkus").
+		Handler(OData(mapp.GetODataSkus))
+
+	request, err := http.NewRequest("GET", "/odata/skus?$count=true&$filter=sku eq 'MS122-33' or sku eq 'MS122-34'", nil)
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %+v", err)
+	}
+	request.Host = "localhost:8080"
+	testRecorder := httptest.NewRecorder()
+	testRouter.ServeHTTP(testRecorder, request)
+
+	if testRecorder.Code != http.StatusOK {
+		t.Fatalf("Expected: %d Actual: %d, %s", http.StatusOK, testRecorder.Code, testRecorder.Body)
+	}
+
+	var collection ODataCollection
+	if err := json.Unmarshal(testRecorder.Body.Bytes(), &collection); err != nil {
+		t.Fatal(err)
+	}
+	if collection.Context != "http://localhost:8080/odata/$metadata#skus" || collection.Count == nil || *collection.Count != 2 {
+		t.Errorf("Unexpected envelope %+v", collection)
+	}
+	if skus, ok := collection.Value.([]interface{}); !ok || len(skus) != 1 || !strings.Contains(collection.NextLink, "%24skip=1") {
+		t.Errorf("Expected a page of 1 SKU with a next link, but got %+v", collection)
+	}
+}
+
+func TestPatchProductUnsupportedMediaType(t *testing.T) {
+
+	testRouter := mux.NewRouter().StrictSlash(true)
+	mapp := Mapping{nil, config.AppConfig.ResponseLimit}
+	testRouter.Path("/skus/{sku}/products/{productId}").
+		Name("testPatchProductUnsupportedMediaType").
+		Handler(web.Handler(mapp.PatchProduct))
+
+	request, err := http.NewRequest("PATCH", "/skus/MS122-33/products/12345678912345",
+		strings.NewReader(`{"dailyTurn": 0.2}`))
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %+v", err)
+	}
+	request.Header.Set("Content-Type", "text/plain")
+
+	testRecorder := httptest.NewRecorder()
+	testRouter.ServeHTTP(testRecorder, request)
+
+	if testRecorder.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected: %d Actual: %d", http.StatusUnsupportedMediaType, testRecorder.Code)
+	}
+}
+
 func insertSampleProductMetadata(db *sql.DB, t *testing.T) []productdata.SKUData {
 
 	JSONSample := `[
@@ -441,7 +724,7 @@ func insertSampleProductMetadata(db *sql.DB, t *testing.T) []productdata.SKUData
 		t.Fatalf("Not able to Unmarshal JSON object: %+v", err)
 	}
 
-	if err := productdata.Insert(db, expectedMappings); err != nil {
+	if err := productdata.Insert(context.Background(), db, expectedMappings); err != nil {
 		t.Fatalf("Not able to insert into database: %+v", err)
 	}
 
@@ -0,0 +1,232 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/productdata"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ODataRoot is the path of the OData v4 service
+	ODataRoot = "/odata"
+
+	odataVersion = "4.0"
+)
+
+// ODataCollection is the OData v4 JSON envelope of a collection
+// swagger:model odataCollection
+type ODataCollection struct {
+	Context  string      `json:"@odata.context"`
+	Count    *int        `json:"@odata.count,omitempty"`
+	Value    interface{} `json:"value"`
+	NextLink string      `json:"@odata.nextLink,omitempty"`
+}
+
+// ODataServiceDocument lists the entity sets of the OData v4 service
+type ODataServiceDocument struct {
+	Context string                 `json:"@odata.context"`
+	Value   []ODataServiceResource `json:"value"`
+}
+
+// ODataServiceResource is an entity set of the service document
+type ODataServiceResource struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	URL  string `json:"url"`
+}
+
+// ODataErrorResponse is the OData v4 JSON error format
+type ODataErrorResponse struct {
+	Error ODataError `json:"error"`
+}
+
+// ODataError describes an error of the OData v4 service
+type ODataError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// OData middleware sets the OData-Version header of the responses of the OData service and sends
+// its errors in the OData format. It wraps the other middlewares so that their errors are sent
+// in that format as well.
+func OData(next web.Handler) web.Handler {
+	return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+		writer.Header().Set("OData-Version", odataVersion)
+
+		err := next(ctx, writer, request)
+		if err == nil {
+			return nil
+		}
+
+		code := http.StatusInternalServerError
+		if common, isCommon := err.(web.CommonError); isCommon {
+			code = common.Code
+		} else {
+			err = errors.Wrap(err, "an error has occurred. Try again")
+		}
+
+		contextValues := ctx.Value(web.KeyValues).(*web.ContextValues)
+		log.WithFields(log.Fields{
+			"Method":     contextValues.Method,
+			"RequestURI": contextValues.RequestURI,
+			"TraceID":    contextValues.TraceID,
+			"Code":       code,
+			"Error":      fmt.Sprintf("%+v", err),
+		}).Error("Server error")
+
+		web.Respond(ctx, writer, ODataErrorResponse{
+			Error: ODataError{Code: strconv.Itoa(code), Message: err.Error()},
+		}, code)
+		return nil
+	})
+}
+
+// GetODataService returns the service document listing the entity sets
+// 200 OK
+// nolint: unparam
+func (mapp *Mapping) GetODataService(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	web.Respond(ctx, writer, ODataServiceDocument{
+		Context: odataServiceRoot(request) + "$metadata",
+		Value: []ODataServiceResource{
+			{Name: productdata.ODataEntitySet, Kind: "EntitySet", URL: productdata.ODataEntitySet},
+		},
+	}, http.StatusOK)
+	return nil
+}
+
+// GetODataMetadata returns the CSDL document describing the SKUs
+// 200 OK, 500 Internal Error
+func (mapp *Mapping) GetODataMetadata(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	metadata, err := productdata.ODataMetadata()
+	if err != nil {
+		return err
+	}
+
+	writer.Header().Set("Content-Type", "application/xml")
+	writer.WriteHeader(http.StatusOK)
+	_, err = writer.Write(metadata)
+	return err
+}
+
+// GetODataSkus retrieves SKUs in the OData v4 format, $count=true adding the number of SKUs
+// matching the filter, and a next link being given while there are more SKUs than the page size
+// 200 OK, 400 Bad Request, 500 Internal Error, 503 Service Unavailable
+func (mapp *Mapping) GetODataSkus(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	query := request.URL.Query()
+
+	if _, ok := query["$inlinecount"]; ok {
+		return web.ValidationError("$inlinecount is replaced by $count=true in OData v4")
+	}
+	withCount, err := odataBool(query, "$count")
+	if err != nil {
+		return err
+	}
+	delete(query, "$count")
+
+	top, skip := -1, 0
+	if value := query.Get("$top"); value != "" {
+		if top, err = strconv.Atoi(value); err != nil || top < 0 {
+			return web.ValidationError("invalid $top value")
+		}
+	}
+	if value := query.Get("$skip"); value != "" {
+		if skip, err = strconv.Atoi(value); err != nil || skip < 0 {
+			return web.ValidationError("invalid $skip value")
+		}
+	}
+
+	// Retrieve sets the page size in the query it is given
+	results, _, err := productdata.Retrieve(ctx, mapp.MasterDB, cloneQuery(query), mapp.Size)
+	if err != nil {
+		return err
+	}
+
+	contextURL := odataServiceRoot(request) + "$metadata#" + productdata.ODataEntitySet
+	if selected := query.Get("$select"); selected != "" {
+		contextURL += "(" + strings.Replace(selected, " ", "", -1) + ")"
+	}
+	collection := ODataCollection{Context: contextURL, Value: results}
+
+	if withCount {
+		count, err := productdata.Count(ctx, mapp.MasterDB, query)
+		if err != nil {
+			return err
+		}
+		collection.Count = &count
+	}
+
+	// Pages are limited to the size of the service, the client following the next link for the rest
+	if len(results) == mapp.Size && (top < 0 || top > mapp.Size) {
+		next := cloneQuery(query)
+		next.Set("$skip", strconv.Itoa(skip+mapp.Size))
+		if top > 0 {
+			next.Set("$top", strconv.Itoa(top-mapp.Size))
+		}
+		if withCount {
+			next.Set("$count", "true")
+		}
+		collection.NextLink = odataServiceRoot(request) + productdata.ODataEntitySet + "?" + next.Encode()
+	}
+
+	web.Respond(ctx, writer, collection, http.StatusOK)
+	return nil
+}
+
+// GetODataSkuCount returns the number of SKUs matching the filter as plain text
+// 200 OK, 400 Bad Request, 500 Internal Error, 503 Service Unavailable
+func (mapp *Mapping) GetODataSkuCount(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	count, err := productdata.Count(ctx, mapp.MasterDB, request.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	writer.Header().Set("Content-Type", "text/plain")
+	writer.WriteHeader(http.StatusOK)
+	_, err = writer.Write([]byte(strconv.Itoa(count)))
+	return err
+}
+
+// odataServiceRoot returns the URL of the OData service as seen by the client, ending with a slash
+func odataServiceRoot(request *http.Request) string {
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + request.Host + ODataRoot + "/"
+}
+
+// odataBool parses a boolean query option, which is false when absent
+func odataBool(query url.Values, option string) (bool, error) {
+	switch query.Get(option) {
+	case "", "false":
+		return false, nil
+	case "true":
+		return true, nil
+	}
+	return false, web.ValidationError(option + " must be true or false")
+}
+
+func cloneQuery(query url.Values) url.Values {
+	clone := make(url.Values, len(query))
+	for key, values := range query {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
@@ -0,0 +1,108 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/views"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+)
+
+// Views represents the saved views API method handler set.
+type Views struct {
+	Store *views.Store
+	Size  int
+}
+
+// ListViews lists the saved views
+// 200 OK, 500 Internal Error
+func (handler *Views) ListViews(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	saved, err := handler.Store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, Response{Results: saved}, http.StatusOK)
+	return nil
+}
+
+// GetView returns a saved view
+// 200 OK, 404 Not Found, 500 Internal Error
+func (handler *Views) GetView(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	view, err := handler.Store.Get(ctx, mux.Vars(request)["name"])
+	if err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, view, http.StatusOK)
+	return nil
+}
+
+// SaveView creates or replaces a view, named after the path
+// 200 OK, 400 Bad Request, 500 Internal Error
+func (handler *Views) SaveView(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	var view views.View
+	if err := json.NewDecoder(request.Body).Decode(&view); err != nil {
+		return bodyError(err)
+	}
+	view.Name = mux.Vars(request)["name"]
+
+	saved, err := handler.Store.Save(ctx, view)
+	if err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, saved, http.StatusOK)
+	return nil
+}
+
+// DeleteView removes a saved view
+// 204 No Content, 404 Not Found, 500 Internal Error
+func (handler *Views) DeleteView(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	if err := handler.Store.Delete(ctx, mux.Vars(request)["name"]); err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, nil, http.StatusNoContent)
+	return nil
+}
+
+// GetViewResults runs a saved view, returning a page of its SKUs selected by $top and $skip
+// 200 OK, 400 Bad Request, 404 Not Found, 500 Internal Error, 503 Service Unavailable
+func (handler *Views) GetViewResults(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	query := request.URL.Query()
+
+	top, skip := -1, 0
+	var err error
+	if value := query.Get("$top"); value != "" {
+		if top, err = strconv.Atoi(value); err != nil || top < 0 {
+			return web.ValidationError("invalid $top value")
+		}
+	}
+	if value := query.Get("$skip"); value != "" {
+		if skip, err = strconv.Atoi(value); err != nil || skip < 0 {
+			return web.ValidationError("invalid $skip value")
+		}
+	}
+
+	results, err := handler.Store.Results(ctx, mux.Vars(request)["name"], top, skip, handler.Size)
+	if err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, Response{Results: results}, http.StatusOK)
+	return nil
+}
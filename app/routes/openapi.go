@@ -0,0 +1,249 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/routes/handlers"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/middlewares"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/openapi"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+)
+
+// Doc documents a route in the OpenAPI document served at /openapi.json
+type Doc struct {
+	Summary string
+	// Description is in CommonMark
+	Description string
+	// Params describes the path parameters, taken from the pattern, and lists the query and header parameters
+	Params []Param
+	// Body is the model of the request body, if any
+	Body interface{}
+	// Consumes lists the content types of the request body, application/json when not set
+	Consumes []string
+	// Produces lists the content types of the successful responses, those negotiated by web.Respond when not set
+	Produces []string
+	// Responses maps the status codes of the route to the model of their body, nil when there is none.
+	// The authentication, rate limit, body size and internal errors are added to the routes they apply to.
+	Responses map[int]interface{}
+}
+
+// Param describes a parameter of a route
+type Param struct {
+	Name string
+	// In is path, query or header
+	In          string
+	Description string
+	// Type is the JSON type of the parameter, string when not set
+	Type string
+}
+
+// ResultsOf documents a handlers.Response holding a list of Model
+type ResultsOf struct {
+	Model interface{}
+}
+
+// Text documents a plain text or XML response body
+type Text struct{}
+
+// queryParams are the OData query options of GET /skus
+var queryParams = []Param{
+	{"$filter", "query", "OData filter, such as `productList/any(p: p/metadata/color eq 'red')`", ""},
+	{"$select", "query", "Fields to return, such as `sku,productList/productId`", ""},
+	{"$orderby", "query", "Fields to order by, such as `sku desc`", ""},
+	{"$top", "query", "Number of SKUs to return, up to the response limit", "integer"},
+	{"$skip", "query", "Number of SKUs to skip", "integer"},
+}
+
+// productIDParams are the parameters of GET /productid/{productId}
+var productIDParams = []Param{
+	{"productId", "path", "The product ID, often a GTIN", ""},
+	{"fields", "query", "Metadata keys to return, such as `color,size`, all of them when not set", ""},
+}
+
+// pathParam matches the variables of the route patterns
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// openAPIDocument describes the routes and the models they use
+func openAPIDocument(registered []registration) *openapi.Document {
+
+	document := openapi.NewDocument(openapi.Info{
+		Title: "Product Data API",
+		Description: "Retailers typically refer to inventory based on SKU. This product data service provides the enterprise " +
+			"data to identify products, such as their size, color and model, from the UPCs read from RFID tags.",
+		Version: "1.0.0",
+	})
+	document.Components.SecuritySchemes["api_key"] = openapi.SecurityScheme{
+		Type: "apiKey",
+		In:   "header",
+		Name: middlewares.APIKeyHeader,
+	}
+	document.Components.SecuritySchemes["bearer"] = openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+	}
+
+	tags := make(map[string]bool)
+	for _, registration := range registered {
+		operation := routeOperation(document, registration.Route)
+		// Operation IDs are unique among the versions, the aliases keeping the IDs of the unversioned routes
+		if name := registration.name(); name != registration.Name {
+			operation.OperationID = strings.Replace(name, ".", "", 1)
+		}
+		operation.Deprecated = registration.version != nil && registration.version.Deprecated
+		document.AddOperation(registration.Method, pathParam.ReplaceAllString(registration.path, "{$1}"), operation)
+		tags[operation.Tags[0]] = true
+	}
+
+	for tag := range tags {
+		document.Tags = append(document.Tags, openapi.Tag{Name: tag})
+	}
+	sort.Slice(document.Tags, func(i, j int) bool { return document.Tags[i].Name < document.Tags[j].Name })
+
+	return document
+}
+
+func routeOperation(document *openapi.Document, route Route) *openapi.Operation {
+
+	doc := route.Doc
+	operation := &openapi.Operation{
+		OperationID: strings.ToLower(route.Name[:1]) + route.Name[1:],
+		Summary:     doc.Summary,
+		Description: doc.Description,
+		Tags:        []string{routeTag(route)},
+		Responses:   make(map[string]openapi.Response),
+	}
+
+	// Path parameters are required, and described by the route when it has a parameter of the same name
+	for _, match := range pathParam.FindAllStringSubmatch(route.Pattern, -1) {
+		param := Param{Name: match[1], In: "path"}
+		for _, described := range doc.Params {
+			if described.Name == param.Name && described.In == "path" {
+				param = described
+			}
+		}
+		operation.Parameters = append(operation.Parameters, parameter(param))
+	}
+	for _, param := range doc.Params {
+		if param.In != "path" {
+			operation.Parameters = append(operation.Parameters, parameter(param))
+		}
+	}
+	if route.Method != "GET" {
+		operation.Parameters = append(operation.Parameters, parameter(Param{
+			"Idempotency-Key", "header", "Applies the request only once, a retry getting the original response back", "",
+		}))
+	}
+
+	if doc.Body != nil {
+		operation.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  content(document, doc.Body, doc.Consumes),
+		}
+	}
+
+	// Errors are negotiated like the other responses, except on the OData service where they are in its JSON format
+	var errorModel interface{} = web.JSONError{}
+	errorTypes := web.MediaTypes()
+	if strings.HasPrefix(route.Pattern, handlers.ODataRoot) {
+		errorModel = handlers.ODataErrorResponse{}
+		errorTypes = []string{"application/json"}
+	}
+
+	for code, model := range doc.Responses {
+		contentTypes := errorTypes
+		if code < http.StatusBadRequest {
+			contentTypes = doc.Produces
+			if len(contentTypes) == 0 {
+				contentTypes = web.MediaTypes()
+			}
+		}
+		operation.Responses[strconv.Itoa(code)] = response(document, code, model, contentTypes)
+	}
+
+	// Errors added by the middlewares
+	var added []int
+	if !route.Public {
+		added = append(added, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError)
+		operation.Security = []map[string][]string{{"api_key": {}}, {"bearer": {}}}
+		operation.RequiredScope = route.Scope
+	}
+	if route.Group != "" {
+		added = append(added, http.StatusTooManyRequests)
+	}
+	if doc.Body != nil {
+		added = append(added, http.StatusRequestEntityTooLarge)
+	}
+	for _, code := range added {
+		if _, ok := operation.Responses[strconv.Itoa(code)]; !ok {
+			operation.Responses[strconv.Itoa(code)] = response(document, code, errorModel, errorTypes)
+		}
+	}
+
+	return operation
+}
+
+// routeTag groups the routes by the first segment of their pattern, the public routes being on their own
+func routeTag(route Route) string {
+	if route.Public {
+		return "default"
+	}
+	return strings.SplitN(strings.TrimPrefix(route.Pattern, "/"), "/", 2)[0]
+}
+
+func parameter(param Param) openapi.Parameter {
+	schemaType := param.Type
+	if schemaType == "" {
+		schemaType = "string"
+	}
+	return openapi.Parameter{
+		Name:        param.Name,
+		In:          param.In,
+		Description: param.Description,
+		Required:    param.In == "path",
+		Schema:      &openapi.Schema{Type: schemaType},
+	}
+}
+
+func response(document *openapi.Document, code int, model interface{}, contentTypes []string) openapi.Response {
+	resp := openapi.Response{Description: http.StatusText(code)}
+	if model != nil {
+		resp.Content = content(document, model, contentTypes)
+	}
+	return resp
+}
+
+// content gives the schema of a body in each of its content types
+func content(document *openapi.Document, model interface{}, contentTypes []string) map[string]openapi.MediaType {
+
+	var schema *openapi.Schema
+	switch model := model.(type) {
+	case ResultsOf:
+		schema = &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+			"results": {Type: "array", Items: document.Schema(model.Model)},
+			"count":   {Type: "integer", Format: "int32"},
+		}}
+	case Text:
+		schema = &openapi.Schema{Type: "string"}
+	default:
+		schema = document.Schema(model)
+	}
+
+	if len(contentTypes) == 0 {
+		contentTypes = []string{"application/json"}
+	}
+	mediaTypes := make(map[string]openapi.MediaType, len(contentTypes))
+	for _, contentType := range contentTypes {
+		mediaTypes[contentType] = openapi.MediaType{Schema: schema}
+	}
+	return mediaTypes
+}
@@ -7,10 +7,16 @@ package routes
 
 import (
 	"database/sql"
+	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/deadletter"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/idempotency"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/productdata"
 	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/routes/handlers"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/views"
 	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/middlewares"
 	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
 )
@@ -21,226 +27,731 @@ type Route struct {
 	Method      string
 	Pattern     string
 	HandlerFunc web.Handler
+	// Public routes are served without authentication
+	Public bool
+	// Scope is granted to the callers allowed to use the route
+	Scope string
+	// Group is the rate limit applied to the route, shared with the other routes of the group
+	Group string
+	// Doc describes the route in the OpenAPI document
+	Doc Doc
 }
 
-// NewRouter creates the routes for GET and POST
-func NewRouter(db *sql.DB, size int) *mux.Router {
-
-	mapp := handlers.Mapping{MasterDB: db, Size: size}
-
-	var routes = []Route{
-		// swagger:operation GET / default Healthcheck
-		//
-		// Healthcheck Endpoint
-		//
-		// Endpoint that is used to determine if the application is ready to take web requests
-		//
-		// ---
-		// consumes:
-		// - application/json
-		//
-		// produces:
-		// - application/json
-		//
-		//
-		// schemes:
-		// - http
-		//
-		// responses:
-		//   '200':
-		//     description: OK
-		//
+// Scopes granted to API keys and bearer tokens
+const (
+	// ReadScope allows to look up product data, as needed by store associates
+	ReadScope = "products:read"
+	// WriteScope allows to load and update product data, as needed by enterprise integrations
+	WriteScope = "products:write"
+	// AdminScope allows to manage failed events
+	AdminScope = "admin"
+)
+
+// Route groups sharing a rate limit, so that a client flooding one does not use up the others
+const (
+	// LookupGroup holds the product lookups of store associates' handhelds
+	LookupGroup = "lookup"
+	// QueryGroup holds the queries on SKUs
+	QueryGroup = "query"
+	// WriteGroup holds the loads and updates of product data
+	WriteGroup = "write"
+	// AdminGroup holds the management of failed events
+	AdminGroup = "admin"
+)
+
+// APIVersion is a version of the REST API, its routes being served under /<Name>
+type APIVersion struct {
+	Name   string
+	Routes []Route
+	// Alias serves the routes at their unversioned path as well
+	Alias bool
+	// Middlewares wrap the routes of the version, the first one being the outermost
+	Middlewares []web.Middleware
+	// Deprecated versions are flagged in the OpenAPI document, their responses carrying a Deprecation header
+	Deprecated bool
+}
+
+// registration is a route as served by the router
+type registration struct {
+	Route
+	// path is the pattern of the route, prefixed by its version unless it is an alias
+	path string
+	// version is nil for the unversioned routes
+	version *APIVersion
+}
+
+// name identifies the route among the routes of all the versions
+func (registration registration) name() string {
+	if registration.version != nil && registration.path != registration.Pattern {
+		return registration.version.Name + "." + registration.Name
+	}
+	return registration.Name
+}
+
+// register lists the routes to serve: the unversioned routes, then the routes of each version
+// under its prefix, followed by their aliases
+func register(unversioned []Route, versions []APIVersion) []registration {
+
+	var registered []registration
+	for _, route := range unversioned {
+		registered = append(registered, registration{Route: route, path: route.Pattern})
+	}
+	for i := range versions {
+		version := &versions[i]
+		for _, route := range version.Routes {
+			registered = append(registered, registration{Route: route, path: "/" + version.Name + route.Pattern, version: version})
+		}
+		if version.Alias {
+			for _, route := range version.Routes {
+				registered = append(registered, registration{Route: route, path: route.Pattern, version: version})
+			}
+		}
+	}
+	return registered
+}
+
+// defaultBodyLimit is the name of the body limit of the routes without their own
+const defaultBodyLimit = "default"
+
+// impliedScopes lists the other scopes allowed to use the routes of a scope
+var impliedScopes = map[string][]string{
+	ReadScope: {WriteScope},
+}
+
+// Options are the stores and settings the routes are served with
+type Options struct {
+	DB          *sql.DB
+	DeadLetters *deadletter.Store
+	// Idempotency stores the responses of the requests with an Idempotency-Key, none being replayed when nil
+	Idempotency *idempotency.Store
+	Views       *views.Store
+	// Authenticator authenticates the callers of the routes that are not public, all routes being open when nil
+	Authenticator *middlewares.Authenticator
+	// RateLimits are the limits of each route group
+	RateLimits map[string]middlewares.RateLimit
+	// BodyLimits are the size limits of the request bodies of the routes, by route name or defaultBodyLimit
+	BodyLimits map[string]int64
+	// Deprecations are the deprecations of the API versions, by version name
+	Deprecations map[string]middlewares.Deprecation
+	// Size is the maximum number of items in a response
+	Size int
+}
+
+// NewRouter creates the routes, those of the REST API being served under each API version
+func NewRouter(options Options) *mux.Router {
+
+	mapp := handlers.Mapping{MasterDB: options.DB, Size: options.Size}
+	deadLetters := handlers.DeadLetters{Store: options.DeadLetters, Size: options.Size}
+	savedViews := handlers.Views{Store: options.Views, Size: options.Size}
+
+	docs := &handlers.Docs{}
+
+	// Routes served outside of the API versions, the OData service having its own versioning
+	unversioned := []Route{
 		{
 			"Index",
 			"GET",
 			"/",
 			mapp.Index,
+			true,
+			"",
+			"",
+			Doc{
+				Summary:     "Healthcheck",
+				Description: "Endpoint that is used to determine if the application is ready to take web requests.",
+				Responses:   map[int]interface{}{http.StatusOK: ""},
+			},
 		},
-		// swagger:route POST /skus skus postSkus
-		//
-		// Loads SKU Data
-		//
-		// This API call is used to upload a list of SKU items into Responsive Retail.<br>
-		// The SKU data includes:
-		//
-		// <blockquote>• <b>SKU</b>: The SKU number, a unique identifier for the SKU.</blockquote>
-		//
-		// <blockquote>• <b>Product List</b>: A list (array) of UPCs that are included in the SKU.</blockquote>
-		//
-		// Expected formatting of JSON input (as an example):<br><br>
-		//
-		//```json
-		// {
-		//"data":[{
-		//   "sku" : "MS122-32",
-		//   "productList" : [
-		//     { "productId": "00888446671444", "metadata": {"color":"blue"} },
-		//     { "productId": "889319762751", "metadata": {"size":"small"} }
-		//    ]
-		// 	 },
-		// 	{
-		//    "sku" : "MS122-34",
-		//    "productList" : [
-		//      {"productId": "90388987132758", "metadata": {"name":"pants"} }
-		//    ]
-		//  }]
-		// }
-		//```
-		// <br>
-		// Each SKU item is treated individually; it succeeds or fails independent of the other SKUs.
-		// Check the returned results to determine the success or failure of each SKU.
-		//
-		//     Consumes:
-		//     - application/json
-		//
-		//     Produces:
-		//     - application/json
-		//
-		//     Schemes: http
-		//
-		//
-		//     Responses:
-		//       201: Created
-		//       400: schemaValidation
-		//       500: internalError
-		//
+		{
+			"GetOpenAPI",
+			"GET",
+			"/openapi.json",
+			docs.GetOpenAPI,
+			true,
+			"",
+			"",
+			Doc{
+				Summary:     "OpenAPI Document",
+				Description: "This API call returns the OpenAPI 3 document describing the routes of the service, generated from the route table.",
+				Produces:    []string{"application/json"},
+				Responses:   map[int]interface{}{http.StatusOK: map[string]interface{}{}},
+			},
+		},
+		{
+			"GetDocs",
+			"GET",
+			"/docs",
+			docs.GetDocs,
+			true,
+			"",
+			"",
+			Doc{
+				Summary:     "API Documentation",
+				Description: "This API call returns a page to browse the OpenAPI document of the service.",
+				Produces:    []string{"text/html"},
+				Responses:   map[int]interface{}{http.StatusOK: Text{}},
+			},
+		},
+		{
+			"GetODataService",
+			"GET",
+			handlers.ODataRoot,
+			mapp.GetODataService,
+			false,
+			ReadScope,
+			QueryGroup,
+			Doc{
+				Summary:     "OData Service Document",
+				Description: "This API call is the root of the OData v4 service, listing its entity sets for OData clients and BI tools.",
+				Produces:    []string{"application/json"},
+				Responses:   map[int]interface{}{http.StatusOK: handlers.ODataServiceDocument{}},
+			},
+		},
+		{
+			"GetODataMetadata",
+			"GET",
+			handlers.ODataRoot + "/$metadata",
+			mapp.GetODataMetadata,
+			false,
+			ReadScope,
+			QueryGroup,
+			Doc{
+				Summary:     "OData Metadata Document",
+				Description: "This API call returns the CSDL document describing the SKUs and their products, metadata being an open type.",
+				Produces:    []string{"application/xml"},
+				Responses:   map[int]interface{}{http.StatusOK: Text{}},
+			},
+		},
+		{
+			"GetODataSkus",
+			"GET",
+			handlers.ODataRoot + "/skus",
+			mapp.GetODataSkus,
+			false,
+			ReadScope,
+			QueryGroup,
+			Doc{
+				Summary: "Retrieves SKU Data in the OData v4 Format",
+				Description: "This API call takes the same query options as `GET /skus`, except that `$count=true` adds the number of SKUs " +
+					"matching `$filter` in `@odata.count` instead of `$inlinecount=allpages`.\n\n" +
+					"The SKUs are in `value`, and `@odata.nextLink` gives the URL of the next page when there are more SKUs " +
+					"than the page size. Errors are in the OData format, like `{\"error\": {\"code\": \"400\", \"message\": \"...\"}}`.",
+				Params: append([]Param{
+					{"$count", "query", "Adds the number of SKUs matching $filter in `@odata.count` with `true`", "boolean"},
+				}, queryParams...),
+				Produces: []string{"application/json"},
+				Responses: map[int]interface{}{
+					http.StatusOK:                 handlers.ODataCollection{},
+					http.StatusBadRequest:         handlers.ODataErrorResponse{},
+					http.StatusServiceUnavailable: handlers.ODataErrorResponse{},
+				},
+			},
+		},
+		{
+			"GetODataSkuCount",
+			"GET",
+			handlers.ODataRoot + "/skus/$count",
+			mapp.GetODataSkuCount,
+			false,
+			ReadScope,
+			QueryGroup,
+			Doc{
+				Summary:     "Counts SKUs",
+				Description: "This API call returns the number of SKUs matching `$filter` as plain text.",
+				Params:      queryParams[:1],
+				Produces:    []string{"text/plain"},
+				Responses: map[int]interface{}{
+					http.StatusOK:                 Text{},
+					http.StatusBadRequest:         handlers.ODataErrorResponse{},
+					http.StatusServiceUnavailable: handlers.ODataErrorResponse{},
+				},
+			},
+		},
+	}
+
+	// v1 holds the routes served before the API was versioned
+	v1 := []Route{
 		{
 			"PostSkuMapping",
 			"POST",
 			"/skus",
 			mapp.PostSkuMapping,
+			false,
+			WriteScope,
+			WriteGroup,
+			Doc{
+				Summary: "Loads SKU Data",
+				Description: "This API call is used to upload a list of SKU items, each made of its `sku`, a unique identifier, " +
+					"and its `productList`, the UPCs included in the SKU along with their metadata.\n\n" +
+					"Example request:\n\n" +
+					"```json\n" +
+					"{\n" +
+					"  \"data\": [\n" +
+					"    {\n" +
+					"      \"sku\": \"MS122-32\",\n" +
+					"      \"productList\": [\n" +
+					"        { \"productId\": \"00888446671444\", \"metadata\": { \"color\": \"blue\" } },\n" +
+					"        { \"productId\": \"889319762751\", \"metadata\": { \"size\": \"small\" } }\n" +
+					"      ]\n" +
+					"    },\n" +
+					"    {\n" +
+					"      \"sku\": \"MS122-34\",\n" +
+					"      \"productList\": [ { \"productId\": \"90388987132758\", \"metadata\": { \"name\": \"pants\" } } ]\n" +
+					"    }\n" +
+					"  ]\n" +
+					"}\n" +
+					"```\n\n" +
+					"Each SKU item is treated individually; it succeeds or fails independent of the other SKUs. " +
+					"Check the returned results to determine the success or failure of each SKU.\n\n" +
+					"Requests retried with the same `Idempotency-Key` header are not applied again, the original response is " +
+					"returned with an `Idempotent-Replayed: true` header instead.",
+				Body: productdata.Root{},
+				Responses: map[int]interface{}{
+					http.StatusCreated:    nil,
+					http.StatusBadRequest: handlers.ErrorList{},
+				},
+			},
 		},
-		// swagger:route GET /skus skus getSkus
-		//
-		// Retrieves SKU Data
-		//
-		// This API call is used to retrieve a list of SKU items.
-		//
-		// <blockquote>• <b>Search by sku</b>: To search by sku, you would use the filter query parameter like so: /sku?$filter=(sku eq 'MS122-32')</blockquote>
-		//
-		// <blockquote>• <b>Search by name</b>: To search by name, you would use the filter query parameter like so: /location?$filter=(name eq 'mens khaki slacks')</blockquote>
-		//
-		//
-		// `/skus?$top=10&$select=sku` - Useful for paging data. Grab the top 10 records and only pull back the sku field
-		//
-		// `/skus?$count` - Tell me how many records are in the database
-		//
-		// `/skus?$filter=(sku eq '12345678') and (productList.metadata.color eq 'red')` - This filters on particular sku and UPCs that are classified as "Red"
-		//
-		// `/skus?$orderby=sku desc` - Give me back all skus in descending order by sku
-		//
-		// `/skus?$filter=startswith(sku,'m')` - Give me all skus that begin with the letter 'm'
-		//
-		// `/skus?$count&$filter=(sku eq '12345678')` - Give me the count of items with the SKU `12345678``
-		//
-		// `/skus?$inlinecount=allpages&$filter=(sku eq '12345678')` - Give me all items with the SKU `12345678` and include how many there are
-		//
-		//
-		//
-		// Example Result:<br><br>
-		//```json
-		// {
-		//     "results": [
-		//         {
-		//             "sku": "12345679",
-		//             "productList": [
-		//                 {
-		//                     "metadata": {
-		//                         "color": "blue",
-		//                         "size": "XS"
-		//                     },
-		//                     "productId": "123456789783"
-		//                 },
-		//                 {
-		//                     "metadata": {
-		//                         "color": "red",
-		//                         "size": "M"
-		//                     },
-		//                     "productId": "123456789784"
-		//                 }
-		//             ]
-		//         }
-		//     ]
-		// }
-		//```
-		//
-		//     Consumes:
-		//     - application/json
-		//
-		//     Produces:
-		//     - application/json
-		//
-		//     Schemes: http
-		//
-		//     Responses:
-		//       200: body:resultsResponse
-		//       400: schemaValidation
-		//       500: internalError
-		//
 		{
 			"GetSkuMapping",
 			"GET",
 			"/skus",
 			mapp.GetSkuMapping,
+			false,
+			ReadScope,
+			QueryGroup,
+			Doc{
+				Summary: "Retrieves SKU Data",
+				Description: "This API call is used to retrieve a list of SKU items, selected with the OData query options.\n\n" +
+					"`/skus?$filter=sku eq 'MS122-32'` - Give me the SKU `MS122-32`\n\n" +
+					"`/skus?$filter=productList/any(p: p/metadata/name eq 'mens khaki slacks')` - Give me the skus with a UPC named `mens khaki slacks`\n\n" +
+					"`/skus?$top=10&$select=sku` - Useful for paging data. Grab the top 10 records and only pull back the sku field\n\n" +
+					"`/skus?$count` - Tell me how many records are in the database\n\n" +
+					"`/skus?$filter=(sku eq '12345678') and productList/any(p: p/metadata/color eq 'red')` - This filters on particular sku and UPCs that are classified as \"Red\", leaving out its other UPCs\n\n" +
+					"`/skus?$filter=productList/any(p: p/metadata/color eq 'red')&$select=sku,productList/productId` - Give me the skus with red UPCs, with only these UPCs and only their productId\n\n" +
+					"`/skus?$filter=productList/all(p: p/dailyTurn gt 0.5)` - Give me the skus whose UPCs all turn more than half a time a day\n\n" +
+					"`/skus?$orderby=sku desc` - Give me back all skus in descending order by sku\n\n" +
+					"`/skus?$filter=startswith(sku,'m')` - Give me all skus that begin with the letter 'm'\n\n" +
+					"`/skus?$count&$filter=(sku eq '12345678')` - Give me the count of items with the SKU `12345678`\n\n" +
+					"`/skus?$inlinecount=allpages&$filter=(sku eq '12345678')` - Give me all items with the SKU `12345678` and include how many there are",
+				Params: append([]Param{
+					{"$count", "query", "Returns the number of SKUs matching $filter instead of the SKUs", "boolean"},
+					{"$inlinecount", "query", "Adds the number of SKUs matching $filter to the results with `allpages`", ""},
+				}, queryParams...),
+				Responses: map[int]interface{}{
+					http.StatusOK:                 ResultsOf{productdata.SKUData{}},
+					http.StatusBadRequest:         web.JSONError{},
+					http.StatusServiceUnavailable: web.JSONError{},
+				},
+			},
+		},
+		{
+			"GetSku",
+			"GET",
+			"/skus/{sku}",
+			mapp.GetSku,
+			false,
+			ReadScope,
+			QueryGroup,
+			Doc{
+				Summary: "Retrieves a SKU",
+				Description: "This API call is used to get the document of a SKU along with its `ETag` header.\n\n" +
+					"Send the `ETag` back in the `If-None-Match` header to get 304 Not Modified while the SKU is unchanged, " +
+					"or in the `If-Match` header of a patch to update the SKU only if nobody else did.",
+				Params: []Param{
+					{"If-None-Match", "header", "ETag of the SKU already held by the client", ""},
+				},
+				Responses: map[int]interface{}{
+					http.StatusOK:                 productdata.SKUData{},
+					http.StatusNotModified:        nil,
+					http.StatusNotFound:           web.JSONError{},
+					http.StatusServiceUnavailable: web.JSONError{},
+				},
+			},
 		},
-		// swagger:route GET /productid/{productid} productid productids
-		//
-		// Retrieves SKU Data
-		//
-		// This API call is used to get the metadata for a upc.<br><br>
-		//
-		// Example query:
-		//
-		// <blockquote>/productid/12345678978345</blockquote> <br><br>
-		//
-		//
-		// Example Result: <br><br>
-		//```json
-		// {
-		//   "metadata": {
-		// 				"color": "blue",
-		// 				 "size": "XS"
-		// 			  },
-		//   "productid": "12345678978345"
-		// }
-		//```
-		//
-		//     Consumes:
-		//     - application/json
-		//
-		//     Produces:
-		//     - application/json
-		//
-		//     Schemes: http
-		//
-		//     Responses:
-		//       200: body:resultsResponse
-		//       404: NotFound
-		//       400: schemaValidation
-		//       500: internalError
-		//
 		{
 			"GetProductID",
 			"GET",
 			"/productid/{productId}",
 			mapp.GetProductID,
+			false,
+			ReadScope,
+			LookupGroup,
+			Doc{
+				Summary: "Retrieves Product Data",
+				Description: "This API call is used to get the attributes and metadata of a UPC, along with the SKU it belongs to " +
+					"and the IDs of the other products of the SKU.\n\n" +
+					"`/productid/12345678978345` - Give me the product `12345678978345` and its SKU\n\n" +
+					"`/productid/12345678978345?fields=color,size` - Give me the product `12345678978345` with only " +
+					"the `color` and `size` metadata",
+				Params: productIDParams,
+				Responses: map[int]interface{}{
+					http.StatusOK:                 productdata.SKUProduct{},
+					http.StatusBadRequest:         web.JSONError{},
+					http.StatusNotFound:           nil,
+					http.StatusServiceUnavailable: web.JSONError{},
+				},
+			},
 		},
+		{
+			"PatchProduct",
+			"PATCH",
+			"/skus/{sku}/products/{productId}",
+			mapp.PatchProduct,
+			false,
+			WriteScope,
+			WriteGroup,
+			Doc{
+				Summary: "Updates Product Data",
+				Description: "This API call is used to update some of the attributes of a product using JSON Merge Patch (RFC 7396). " +
+					"Only the attributes present in the request are changed, metadata keys are merged individually " +
+					"and any attribute or metadata key set to null is removed.\n\n" +
+					"Send the `ETag` returned by `GET /skus/{sku}` or by a previous patch in the `If-Match` header to only " +
+					"apply the patch if the SKU was not modified in the meantime, otherwise 412 Precondition Failed is returned. " +
+					"The response carries the new `ETag` of the SKU.\n\n" +
+					"Example request to /skus/MS122-32/products/00888446671444:\n\n" +
+					"```json\n" +
+					"{\n" +
+					"  \"dailyTurn\": 0.05,\n" +
+					"  \"metadata\": { \"color\": \"navy\", \"size\": null }\n" +
+					"}\n" +
+					"```",
+				Params: []Param{
+					{"If-Match", "header", "ETag the SKU must still have for the patch to be applied", ""},
+				},
+				Body:     map[string]interface{}{},
+				Consumes: []string{"application/merge-patch+json", "application/json"},
+				Responses: map[int]interface{}{
+					http.StatusOK:                   productdata.ProductData{},
+					http.StatusBadRequest:           web.JSONError{},
+					http.StatusNotFound:             web.JSONError{},
+					http.StatusPreconditionFailed:   web.JSONError{},
+					http.StatusUnsupportedMediaType: web.JSONError{},
+				},
+			},
+		},
+		{
+			"ListViews",
+			"GET",
+			"/views",
+			savedViews.ListViews,
+			false,
+			ReadScope,
+			QueryGroup,
+			Doc{
+				Summary: "Lists Saved Views",
+				Description: "This API call is used to list the saved views ordered by name. " +
+					"A view is an OData query of the SKUs ($filter, $orderby and $select) saved under a name.",
+				Responses: map[int]interface{}{http.StatusOK: ResultsOf{views.View{}}},
+			},
+		},
+		{
+			"GetView",
+			"GET",
+			"/views/{name}",
+			savedViews.GetView,
+			false,
+			ReadScope,
+			QueryGroup,
+			Doc{
+				Summary: "Retrieves a Saved View",
+				Description: "This API call is used to retrieve the query of a saved view and, for materialized views, " +
+					"when its results were last refreshed.",
+				Responses: map[int]interface{}{
+					http.StatusOK:       views.View{},
+					http.StatusNotFound: web.JSONError{},
+				},
+			},
+		},
+		{
+			"SaveView",
+			"PUT",
+			"/views/{name}",
+			savedViews.SaveView,
+			false,
+			WriteScope,
+			WriteGroup,
+			Doc{
+				Summary: "Saves a View",
+				Description: "This API call is used to create or replace a view. Names are made of up to 48 letters, digits, - and _. " +
+					"The query is checked when the view is saved, with the same rules as `GET /skus`.\n\n" +
+					"Materialized views keep their results in a PostgreSQL materialized view, which is refreshed when the SKUs " +
+					"change instead of running the query for each page. Their results can lag behind the SKUs by up to " +
+					"`viewRefreshIntervalSeconds`.\n\n" +
+					"Example request to /views/fast-movers:\n\n" +
+					"```json\n" +
+					"{\n" +
+					"  \"filter\": \"productList/any(p: p/dailyTurn gt 0.5)\",\n" +
+					"  \"orderby\": \"sku\",\n" +
+					"  \"select\": \"sku,productList/productId\",\n" +
+					"  \"materialized\": true\n" +
+					"}\n" +
+					"```",
+				Body: views.View{},
+				Responses: map[int]interface{}{
+					http.StatusOK:         views.View{},
+					http.StatusBadRequest: web.JSONError{},
+				},
+			},
+		},
+		{
+			"DeleteView",
+			"DELETE",
+			"/views/{name}",
+			savedViews.DeleteView,
+			false,
+			WriteScope,
+			WriteGroup,
+			Doc{
+				Summary:     "Deletes a Saved View",
+				Description: "This API call is used to remove a view along with its materialized view.",
+				Responses: map[int]interface{}{
+					http.StatusNoContent: nil,
+					http.StatusNotFound:  web.JSONError{},
+				},
+			},
+		},
+		{
+			"GetViewResults",
+			"GET",
+			"/views/{name}/results",
+			savedViews.GetViewResults,
+			false,
+			ReadScope,
+			QueryGroup,
+			Doc{
+				Summary: "Runs a Saved View",
+				Description: "This API call is used to retrieve a page of the SKUs of a view, in the order of its $orderby. " +
+					"Pages are selected with $top and $skip, $top is capped to the configured response size.\n\n" +
+					"`/views/fast-movers/results?$top=10&$skip=20` - Give me the third page of 10 SKUs of fast-movers",
+				Params: queryParams[3:],
+				Responses: map[int]interface{}{
+					http.StatusOK:                 ResultsOf{productdata.SKUData{}},
+					http.StatusBadRequest:         web.JSONError{},
+					http.StatusNotFound:           web.JSONError{},
+					http.StatusServiceUnavailable: web.JSONError{},
+				},
+			},
+		},
+		{
+			"ListDeadLetters",
+			"GET",
+			"/admin/deadletters",
+			deadLetters.ListDeadLetters,
+			false,
+			AdminScope,
+			AdminGroup,
+			Doc{
+				Summary: "Lists Failed Events",
+				Description: "This API call is used to list the EdgeX events that failed ingestion, oldest first and without their payload. " +
+					"Failed events are retried automatically with an exponential backoff until they succeed or " +
+					"run out of attempts, in which case their status changes from pending to failed.\n\n" +
+					"`/admin/deadletters?status=failed&limit=10` - Give me the first 10 events that are no longer retried",
+				Params: []Param{
+					{"status", "query", "Only lists the events with this status, `pending` or `failed`", ""},
+					{"limit", "query", "Maximum number of events to list", "integer"},
+				},
+				Responses: map[int]interface{}{
+					http.StatusOK:         ResultsOf{deadletter.Letter{}},
+					http.StatusBadRequest: web.JSONError{},
+				},
+			},
+		},
+		{
+			"GetDeadLetter",
+			"GET",
+			"/admin/deadletters/{id}",
+			deadLetters.GetDeadLetter,
+			false,
+			AdminScope,
+			AdminGroup,
+			Doc{
+				Summary: "Retrieves a Failed Event",
+				Description: "This API call is used to inspect an event that failed ingestion, including its raw payload " +
+					"(base64 encoded), the last error and the number of attempts.",
+				Responses: map[int]interface{}{
+					http.StatusOK:         deadletter.Letter{},
+					http.StatusBadRequest: web.JSONError{},
+					http.StatusNotFound:   web.JSONError{},
+				},
+			},
+		},
+		{
+			"ReplayDeadLetter",
+			"POST",
+			"/admin/deadletters/{id}/replay",
+			deadLetters.ReplayDeadLetter,
+			false,
+			AdminScope,
+			AdminGroup,
+			Doc{
+				Summary: "Replays a Failed Event",
+				Description: "This API call is used to ingest a failed event again right away, whatever its status. " +
+					"The event is removed when it succeeds, otherwise the attempt is recorded and the error returned.",
+				Responses: map[int]interface{}{
+					http.StatusNoContent:  nil,
+					http.StatusBadRequest: web.JSONError{},
+					http.StatusNotFound:   web.JSONError{},
+				},
+			},
+		},
+		{
+			"DiscardDeadLetter",
+			"DELETE",
+			"/admin/deadletters/{id}",
+			deadLetters.DiscardDeadLetter,
+			false,
+			AdminScope,
+			AdminGroup,
+			Doc{
+				Summary:     "Discards a Failed Event",
+				Description: "This API call is used to remove a failed event without ingesting it.",
+				Responses: map[int]interface{}{
+					http.StatusNoContent:  nil,
+					http.StatusBadRequest: web.JSONError{},
+					http.StatusNotFound:   web.JSONError{},
+				},
+			},
+		},
+		{
+			"FlushCache",
+			"DELETE",
+			"/admin/cache",
+			mapp.FlushCache,
+			false,
+			AdminScope,
+			AdminGroup,
+			Doc{
+				Summary: "Flushes the Product Cache",
+				Description: "This API call is used to empty the in-memory cache of product ID lookups of the instance receiving it. " +
+					"Writes made through this service invalidate the cache on their own, flushing it is only needed after the " +
+					"database was modified directly.",
+				Responses: map[int]interface{}{http.StatusOK: handlers.FlushResponse{}},
+			},
+		},
+	}
+
+	// v2 serves the routes of v1 until their responses change, the routes changing getting handlers of their own
+	v2 := replaceRoutes(v1,
+		Route{
+			"GetProductID",
+			"GET",
+			"/productid/{productId}",
+			mapp.GetProductIDV2,
+			false,
+			ReadScope,
+			LookupGroup,
+			Doc{
+				Summary: "Retrieves Product Data",
+				Description: "This API call is used to get the attributes and metadata of a UPC, along with the SKU it belongs to " +
+					"and the IDs of the other products of the SKU. Unlike `/v1`, unknown products get an error body.\n\n" +
+					"`/v2/productid/12345678978345` - Give me the product `12345678978345` and its SKU\n\n" +
+					"`/v2/productid/12345678978345?fields=color,size` - Give me the product `12345678978345` with only " +
+					"the `color` and `size` metadata",
+				Params: productIDParams,
+				Responses: map[int]interface{}{
+					http.StatusOK:                 productdata.SKUProduct{},
+					http.StatusBadRequest:         web.JSONError{},
+					http.StatusNotFound:           web.JSONError{},
+					http.StatusServiceUnavailable: web.JSONError{},
+				},
+			},
+		},
+	)
+
+	versions := []APIVersion{
+		// The clients predating versions keep using the unversioned paths
+		{Name: "v1", Routes: v1, Alias: true},
+		{Name: "v2", Routes: v2},
+	}
+	for i, version := range versions {
+		if deprecation, ok := options.Deprecations[version.Name]; ok {
+			versions[i].Deprecated = true
+			versions[i].Middlewares = append([]web.Middleware{middlewares.Deprecate(deprecation)}, version.Middlewares...)
+		}
+	}
+
+	registered := register(unversioned, versions)
+	docs.Document = openAPIDocument(registered)
+
+	// Authentication failures are limited by address on their own, so that they do not use up the bucket of the caller
+	limiters := make(map[string]*middlewares.RateLimiter, len(options.RateLimits))
+	failureLimiters := make(map[string]*middlewares.RateLimiter, len(options.RateLimits))
+	for group, limit := range options.RateLimits {
+		limiters[group] = middlewares.NewRateLimiter(group, limit)
+		failureLimiters[group] = middlewares.NewRateLimiter(group, limit)
 	}
 
 	router := mux.NewRouter().StrictSlash(true)
-	for _, route := range routes {
+	for _, registration := range registered {
 
+		route := registration.Route
 		handler := route.HandlerFunc
+		// Write requests sent with an Idempotency-Key header are only applied once
+		if route.Method != "GET" && options.Idempotency != nil {
+			handler = idempotency.Middleware(options.Idempotency)(handler)
+		}
 		handler = middlewares.Recover(handler)
 		handler = middlewares.Logger(handler)
-		handler = middlewares.BodyLimiter(handler)
+		handler = middlewares.BodyLimiter(bodyLimit(options.BodyLimits, route.Name))(handler)
+		// Compressed bodies are limited once decompressed
+		handler = middlewares.Compression(handler)
+		// Clients over their limit are rejected before their body is read
+		if limiter, ok := limiters[route.Group]; ok {
+			handler = limiter.Limit(handler)
+		}
+		// Unauthenticated requests are rejected before their body is read
+		if !route.Public && options.Authenticator != nil {
+			scopes := append([]string{route.Scope}, impliedScopes[route.Scope]...)
+			handler = middlewares.RequireScope(scopes...)(handler)
+			handler = options.Authenticator.Authenticate(handler)
+			// Clients sending invalid credentials are limited by address
+			if limiter, ok := failureLimiters[route.Group]; ok {
+				handler = limiter.LimitFailures(handler)
+			}
+		}
+		// Errors of the OData service, the ones of the middlewares included, are in the OData format
+		if strings.HasPrefix(route.Pattern, handlers.ODataRoot) {
+			handler = handlers.OData(handler)
+		}
+		// The middlewares of the version apply to all its responses, the rejected requests included
+		if registration.version != nil {
+			for i := len(registration.version.Middlewares) - 1; i >= 0; i-- {
+				handler = registration.version.Middlewares[i](handler)
+			}
+		}
 
 		router.
 			Methods(route.Method).
-			Path(route.Pattern).
-			Name(route.Name).
+			Path(registration.path).
+			Name(registration.name()).
 			Handler(handler)
 	}
 
 	return router
 }
+
+// replaceRoutes copies routes, replacing the ones with the same name as a replacement
+func replaceRoutes(routes []Route, replacements ...Route) []Route {
+
+	replaced := append([]Route(nil), routes...)
+	for _, replacement := range replacements {
+		for i := range replaced {
+			if replaced[i].Name == replacement.Name {
+				replaced[i] = replacement
+			}
+		}
+	}
+	return replaced
+}
+
+// bodyLimit returns the size limit of the request bodies of a route
+func bodyLimit(bodyLimits map[string]int64, name string) int64 {
+	if limit, ok := bodyLimits[name]; ok {
+		return limit
+	}
+	if limit, ok := bodyLimits[defaultBodyLimit]; ok {
+		return limit
+	}
+	return middlewares.DefaultBodyLimit
+}
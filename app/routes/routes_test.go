@@ -0,0 +1,308 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/middlewares"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/openapi"
+)
+
+func TestRouteScopes(t *testing.T) {
+
+	auth, err := middlewares.NewAuthenticator(middlewares.AuthConfig{
+		APIKeys: []string{"handheld-key " + ReadScope, "integration-key " + WriteScope},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter(Options{Authenticator: auth, Size: 1000})
+
+	tests := []struct {
+		method string
+		target string
+		key    string
+		code   int
+	}{
+		// The requests allowed fail further on without a database, as long as they are not rejected
+		{"GET", "/", "", http.StatusOK},
+		{"GET", "/productid/00888446671444", "", http.StatusUnauthorized},
+		{"POST", "/skus", "handheld-key", http.StatusForbidden},
+		{"PATCH", "/skus/MS122-32/products/00888446671444", "handheld-key", http.StatusForbidden},
+		{"GET", "/admin/deadletters", "integration-key", http.StatusForbidden},
+		{"DELETE", "/admin/deadletters/1", "handheld-key", http.StatusForbidden},
+		{"DELETE", "/admin/cache", "integration-key", http.StatusForbidden},
+		{"PUT", "/views/fast-movers", "handheld-key", http.StatusForbidden},
+		{"DELETE", "/views/fast-movers", "handheld-key", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.target, nil)
+		if test.key != "" {
+			request.Header.Set(middlewares.APIKeyHeader, test.key)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s %s: expected %d, but got %d", test.method, test.target, test.code, recorder.Code)
+		}
+	}
+}
+
+func TestAuthenticationFailuresLimited(t *testing.T) {
+
+	auth, err := middlewares.NewAuthenticator(middlewares.AuthConfig{APIKeys: []string{"handheld-key " + ReadScope}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateLimits := map[string]middlewares.RateLimit{LookupGroup: {RequestsPerSecond: 0.1, Burst: 1}}
+	router := NewRouter(Options{Authenticator: auth, RateLimits: rateLimits, Size: 1000})
+
+	// Invalid credentials are limited even though they never reach the limit of a caller
+	for _, code := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+		request := httptest.NewRequest("GET", "/productid/00888446671444", nil)
+		request.Header.Set(middlewares.APIKeyHeader, "guessed-key")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != code {
+			t.Errorf("Expected %d, but got %d", code, recorder.Code)
+		}
+	}
+}
+
+func TestODataRoutes(t *testing.T) {
+
+	auth, err := middlewares.NewAuthenticator(middlewares.AuthConfig{
+		APIKeys: []string{"handheld-key " + ReadScope},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter(Options{Authenticator: auth, Size: 1000})
+
+	send := func(target string, key string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", target, nil)
+		if key != "" {
+			request.Header.Set(middlewares.APIKeyHeader, key)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := send("/odata/$metadata", "handheld-key")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("OData-Version") != "4.0" ||
+		!strings.Contains(recorder.Body.String(), `<EntitySet Name="skus" EntityType="ProductDataService.SKUData">`) {
+		t.Errorf("Unexpected metadata document %d %v %s", recorder.Code, recorder.Header(), recorder.Body)
+	}
+
+	recorder = send("/odata", "handheld-key")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"@odata.context":"http://example.com/odata/$metadata"`) {
+		t.Errorf("Unexpected service document %d %s", recorder.Code, recorder.Body)
+	}
+
+	// Errors of the middlewares are in the OData format as well
+	recorder = send("/odata/skus", "")
+	if recorder.Code != http.StatusUnauthorized || recorder.Body.String() != `{"error":{"code":"401","message":"Not authorized"}}` {
+		t.Errorf("Expected an OData error, but got %d %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = send("/odata/skus?$inlinecount=allpages", "handheld-key")
+	if recorder.Code != http.StatusBadRequest || !strings.HasPrefix(recorder.Body.String(), `{"error":{"code":"400"`) {
+		t.Errorf("Expected an OData error, but got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestOpenAPICoverage(t *testing.T) {
+
+	auth, err := middlewares.NewAuthenticator(middlewares.AuthConfig{
+		APIKeys: []string{"handheld-key " + ReadScope},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter(Options{Authenticator: auth, Size: 1000})
+
+	// The document is public
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/openapi.json", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected the OpenAPI document, but got %d %s", recorder.Code, recorder.Body)
+	}
+
+	var document openapi.Document
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if document.OpenAPI != openapi.Version {
+		t.Errorf("Expected OpenAPI %s, but got %s", openapi.Version, document.OpenAPI)
+	}
+
+	registered := 0
+	err = router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			registered++
+			operation := document.Operation(method, path)
+			if operation == nil {
+				t.Errorf("%s %s is missing from the OpenAPI document", method, path)
+				continue
+			}
+			if operation.Summary == "" || operation.Description == "" || len(operation.Responses) == 0 {
+				t.Errorf("%s %s is not documented: %+v", method, path, operation)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := 0
+	for _, operations := range document.Paths {
+		documented += len(operations)
+	}
+	if documented != registered {
+		t.Errorf("Expected %d operations, one per route, but got %d", registered, documented)
+	}
+
+	// The models are described, and referred to by the operations using them
+	for _, model := range []string{"SKUData", "ProductData", "ErrorList", "JSONError"} {
+		if _, ok := document.Components.Schemas[model]; !ok {
+			t.Errorf("Expected the schema of %s", model)
+		}
+	}
+	getSku := document.Operation("GET", "/skus/{sku}")
+	if schema := getSku.Responses["200"].Content["application/json"].Schema; schema == nil || schema.Ref != "#/components/schemas/SKUData" {
+		t.Errorf("Expected GET /skus/{sku} to return a SKUData, but got %+v", schema)
+	}
+	if getSku.RequiredScope != ReadScope || len(getSku.Security) == 0 || getSku.Responses["429"].Description == "" {
+		t.Errorf("Expected GET /skus/{sku} to require %s and be rate limited, but got %+v", ReadScope, getSku)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/docs", nil))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `fetch("openapi.json")`) {
+		t.Errorf("Expected the documentation page, but got %d", recorder.Code)
+	}
+}
+
+func TestAPIVersions(t *testing.T) {
+
+	auth, err := middlewares.NewAuthenticator(middlewares.AuthConfig{
+		APIKeys: []string{"handheld-key " + ReadScope},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deprecations := map[string]middlewares.Deprecation{
+		"v1": {Date: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), Sunset: time.Date(2027, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	router := NewRouter(Options{Authenticator: auth, Deprecations: deprecations, Size: 1000})
+
+	tests := []struct {
+		method     string
+		target     string
+		key        string
+		code       int
+		deprecated bool
+	}{
+		// v1 is served at the unversioned paths too, and its rejected requests are announced as deprecated as well
+		{"GET", "/v1/productid/00888446671444", "", http.StatusUnauthorized, true},
+		{"GET", "/productid/00888446671444", "", http.StatusUnauthorized, true},
+		{"GET", "/v2/productid/00888446671444", "", http.StatusUnauthorized, false},
+		{"POST", "/v2/skus", "handheld-key", http.StatusForbidden, false},
+		{"DELETE", "/v1/admin/cache", "handheld-key", http.StatusForbidden, true},
+		// The health check, the documentation and the OData service are not versioned
+		{"GET", "/", "", http.StatusOK, false},
+		{"GET", "/v2/openapi.json", "", http.StatusNotFound, false},
+		{"GET", "/v1/odata/skus", "handheld-key", http.StatusNotFound, false},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.target, nil)
+		if test.key != "" {
+			request.Header.Set(middlewares.APIKeyHeader, test.key)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s %s: expected %d, but got %d", test.method, test.target, test.code, recorder.Code)
+		}
+		deprecated := recorder.Header().Get("Deprecation") == "@1798761600" && recorder.Header().Get("Sunset") == "Thu, 01 Jul 2027 00:00:00 GMT"
+		if deprecated != test.deprecated || (!test.deprecated && recorder.Header().Get("Deprecation") != "") {
+			t.Errorf("%s %s: expected deprecated %v, but got headers %v", test.method, test.target, test.deprecated, recorder.Header())
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/openapi.json", nil))
+	var document openapi.Document
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	operations := map[string]struct {
+		id         string
+		deprecated bool
+	}{
+		"/skus/{sku}":    {"getSku", true},
+		"/v1/skus/{sku}": {"v1GetSku", true},
+		"/v2/skus/{sku}": {"v2GetSku", false},
+	}
+	for path, expected := range operations {
+		operation := document.Operation("GET", path)
+		if operation == nil || operation.OperationID != expected.id || operation.Deprecated != expected.deprecated {
+			t.Errorf("GET %s: expected %s deprecated %v, but got %+v", path, expected.id, expected.deprecated, operation)
+		}
+	}
+}
+
+func TestProductIDVersions(t *testing.T) {
+
+	router := NewRouter(Options{Size: 1000})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/openapi.json", nil))
+	var document openapi.Document
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every version returns the SKU of the product along with the product
+	for _, path := range []string{"/productid/{productId}", "/v1/productid/{productId}", "/v2/productid/{productId}"} {
+		operation := document.Operation("GET", path)
+		if operation == nil {
+			t.Errorf("GET %s is not documented", path)
+			continue
+		}
+		if ref := operation.Responses["200"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/SKUProduct" {
+			t.Errorf("GET %s: expected SKUProduct, but got %s", path, ref)
+		}
+	}
+
+	if properties := document.Components.Schemas["SKUProduct"].Properties; properties["sku"] == nil ||
+		properties["siblingProductIds"] == nil || properties["productId"] == nil {
+		t.Errorf("Unexpected SKUProduct schema %+v", properties)
+	}
+}
@@ -0,0 +1,310 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package views
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/productdata"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+const viewTable = "saved_views"
+
+// columns in the order they are scanned into a View
+const viewColumns = "name, filter, orderby, selected, materialized, created, updated, refreshed"
+
+// materializedPrefix starts the names of the materialized views of the saved views
+const materializedPrefix = "saved_view_"
+
+// validName keeps the names of the views short enough for the names of their materialized views
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,48}$`)
+
+// Store persists named OData queries and runs them
+type Store struct {
+	db *sql.DB
+	// seen is the productdata.Changes the materialized views were last refreshed for
+	seen uint64
+}
+
+// NewStore creates a store of views
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db, seen: productdata.Changes()}
+}
+
+// materializedName returns the name of the materialized view of a view
+func materializedName(name string) string {
+	return materializedPrefix + name
+}
+
+// Save creates or replaces a view, after checking its query. The materialized view of a
+// materialized view is created, and filled, right away.
+func (store *Store) Save(ctx context.Context, view View) (View, error) {
+
+	// Metrics
+	mSaved := metrics.GetOrRegisterGauge(`Product-Data.Views.Saved`, nil)
+	mSaveErr := metrics.GetOrRegisterGauge(`Product-Data.Views.Save-Error`, nil)
+
+	if !validName.MatchString(view.Name) {
+		return View{}, web.ValidationError("view names are made of up to 48 letters, digits, - and _")
+	}
+	if err := productdata.ValidateQuery(view.Query()); err != nil {
+		return View{}, err
+	}
+
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		mSaveErr.Update(1)
+		return View{}, err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback() // nolint: errcheck
+
+	dropQuery := fmt.Sprintf("DROP MATERIALIZED VIEW IF EXISTS %s", pq.QuoteIdentifier(materializedName(view.Name)))
+	if _, err := tx.ExecContext(ctx, dropQuery); err != nil {
+		mSaveErr.Update(1)
+		return View{}, err
+	}
+
+	if view.Materialized {
+		positionedQuery, err := productdata.PositionedSQL(view.Query())
+		if err != nil {
+			return View{}, err
+		}
+		createQuery := fmt.Sprintf("CREATE MATERIALIZED VIEW %s AS %s",
+			pq.QuoteIdentifier(materializedName(view.Name)),
+			positionedQuery,
+		)
+		// The unique index allows to refresh the view while it is being read
+		indexQuery := fmt.Sprintf("CREATE UNIQUE INDEX ON %s (id)", pq.QuoteIdentifier(materializedName(view.Name)))
+		for _, query := range []string{createQuery, indexQuery} {
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				mSaveErr.Update(1)
+				return View{}, err
+			}
+		}
+	}
+
+	upsertQuery := fmt.Sprintf(`INSERT INTO %s (name, filter, orderby, selected, materialized, refreshed)
+								VALUES ($1, $2, $3, $4, $5, CASE WHEN $5 THEN now() END)
+								ON CONFLICT (name) DO UPDATE SET filter = EXCLUDED.filter, orderby = EXCLUDED.orderby,
+								selected = EXCLUDED.selected, materialized = EXCLUDED.materialized,
+								refreshed = EXCLUDED.refreshed, updated = now()
+								RETURNING %s`,
+		pq.QuoteIdentifier(viewTable),
+		viewColumns,
+	)
+
+	saved, err := scanView(tx.QueryRowContext(ctx, upsertQuery, view.Name, view.Filter, view.OrderBy, view.Select, view.Materialized))
+	if err != nil {
+		mSaveErr.Update(1)
+		return View{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		mSaveErr.Update(1)
+		return View{}, err
+	}
+
+	mSaved.Update(1)
+	return saved, nil
+}
+
+// Get returns a view
+func (store *Store) Get(ctx context.Context, name string) (View, error) {
+
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE name = $1`,
+		viewColumns,
+		pq.QuoteIdentifier(viewTable),
+	)
+
+	view, err := scanView(store.db.QueryRowContext(ctx, selectQuery, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return View{}, web.NotFoundError()
+		}
+		return View{}, err
+	}
+	return view, nil
+}
+
+// List returns the views ordered by name
+func (store *Store) List(ctx context.Context) ([]View, error) {
+	return store.list(ctx, false)
+}
+
+func (store *Store) list(ctx context.Context, materializedOnly bool) ([]View, error) {
+
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE materialized OR NOT $1 ORDER BY name`,
+		viewColumns,
+		pq.QuoteIdentifier(viewTable),
+	)
+
+	rows, err := store.db.QueryContext(ctx, selectQuery, materializedOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := make([]View, 0)
+	for rows.Next() {
+		view, err := scanView(rows)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+	return views, rows.Err()
+}
+
+// Delete removes a view along with its materialized view
+func (store *Store) Delete(ctx context.Context, name string) error {
+
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback() // nolint: errcheck
+
+	deleteQuery := fmt.Sprintf(`DELETE FROM %s WHERE name = $1`, pq.QuoteIdentifier(viewTable))
+	result, err := tx.ExecContext(ctx, deleteQuery, name)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return web.NotFoundError()
+	}
+
+	dropQuery := fmt.Sprintf("DROP MATERIALIZED VIEW IF EXISTS %s", pq.QuoteIdentifier(materializedName(name)))
+	if _, err := tx.ExecContext(ctx, dropQuery); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Results returns a page of the SKUs of a view, read from its materialized view if it has one.
+// top is capped to maxSize.
+func (store *Store) Results(ctx context.Context, name string, top int, skip int, maxSize int) ([]json.RawMessage, error) {
+
+	view, err := store.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if top < 0 || top > maxSize {
+		top = maxSize
+	}
+
+	if view.Materialized {
+		return productdata.RetrievePositioned(ctx, store.db, materializedName(view.Name), top, skip)
+	}
+
+	query := view.Query()
+	query.Set("$top", strconv.Itoa(top))
+	query.Set("$skip", strconv.Itoa(skip))
+	results, _, err := productdata.Retrieve(ctx, store.db, query, maxSize)
+	return results, err
+}
+
+// Refresh refreshes the materialized views and returns how many were refreshed
+func (store *Store) Refresh(ctx context.Context) (int, error) {
+
+	// Metrics
+	mRefreshed := metrics.GetOrRegisterGaugeCollection(`Product-Data.Views.Refreshed`, nil)
+	mRefreshErr := metrics.GetOrRegisterGauge(`Product-Data.Views.Refresh-Error`, nil)
+	mRefreshLatency := metrics.GetOrRegisterTimer(`Product-Data.Views.Refresh-Latency`, nil)
+
+	startTime := time.Now()
+
+	views, err := store.list(ctx, true)
+	if err != nil {
+		mRefreshErr.Update(1)
+		return 0, err
+	}
+
+	refreshed := 0
+	for _, view := range views {
+		refreshQuery := fmt.Sprintf("REFRESH MATERIALIZED VIEW CONCURRENTLY %s", pq.QuoteIdentifier(materializedName(view.Name)))
+		if _, err := store.db.ExecContext(ctx, refreshQuery); err != nil {
+			mRefreshErr.Update(1)
+			return refreshed, err
+		}
+
+		updateQuery := fmt.Sprintf(`UPDATE %s SET refreshed = now() WHERE name = $1`, pq.QuoteIdentifier(viewTable))
+		if _, err := store.db.ExecContext(ctx, updateQuery, view.Name); err != nil {
+			mRefreshErr.Update(1)
+			return refreshed, err
+		}
+		refreshed++
+	}
+
+	mRefreshed.Add(int64(refreshed))
+	mRefreshLatency.Update(time.Since(startTime))
+	return refreshed, nil
+}
+
+// Run refreshes the materialized views every interval when this instance wrote SKUs since
+// they were last refreshed, until the context is done
+func (store *Store) Run(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changes := productdata.Changes()
+			if changes == store.seen {
+				continue
+			}
+			if _, err := store.Refresh(ctx); err != nil {
+				log.WithFields(log.Fields{
+					"Method": "views.Run",
+					"Action": "Refresh materialized views",
+					"Error":  err.Error(),
+				}).Error("unable to refresh materialized views")
+				continue
+			}
+			store.seen = changes
+		}
+	}
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanView reads a row of viewColumns
+func scanView(row scanner) (View, error) {
+
+	var view View
+	var refreshed pq.NullTime
+	err := row.Scan(&view.Name, &view.Filter, &view.OrderBy, &view.Select, &view.Materialized,
+		&view.Created, &view.Updated, &refreshed)
+	if err != nil {
+		return View{}, err
+	}
+	if refreshed.Valid {
+		view.Refreshed = &refreshed.Time
+	}
+	return view, nil
+}
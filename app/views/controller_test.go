@@ -0,0 +1,186 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package views
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/productdata"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+)
+
+func TestMain(m *testing.M) {
+
+	if err := config.InitConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+
+}
+
+func TestViewQuery(t *testing.T) {
+
+	view := View{Name: "fast-movers", Filter: "productList/any(p: p/dailyTurn gt 0.5)", OrderBy: "sku desc"}
+	query := view.Query()
+
+	if query.Get("$filter") != view.Filter || query.Get("$orderby") != view.OrderBy {
+		t.Errorf("Unexpected query %v", query)
+	}
+	if _, ok := query["$select"]; ok {
+		t.Errorf("Expected no $select when the view selects everything, but got %v", query)
+	}
+}
+
+func TestSaveInvalid(t *testing.T) {
+
+	// The views are checked before reaching the database
+	store := NewStore(nil)
+
+	invalid := []View{
+		{Name: ""},
+		{Name: "fast movers"},
+		{Name: "saved_view_with_a_name_that_is_way_too_long_for_postgres"},
+		{Name: "fast-movers", Filter: "dailyTurn gtx 1"},
+		{Name: "fast-movers", OrderBy: "sku sideways"},
+		{Name: "fast-movers", Select: "productList/unknown/deeper"},
+	}
+
+	for _, view := range invalid {
+		_, err := store.Save(context.Background(), view)
+		if _, isCommon := err.(web.CommonError); !isCommon {
+			t.Errorf("Expected %+v to be rejected, but got %v", view, err)
+		}
+	}
+}
+
+func TestSaveAndRun(t *testing.T) {
+
+	db := dbSetup(t)
+	insertSampleData(db, t)
+
+	store := NewStore(db)
+	for _, materialized := range []bool{false, true} {
+
+		view := View{
+			Name:         "views-test",
+			Filter:       "startswith(sku, 'VIEWS-')",
+			OrderBy:      "sku desc",
+			Select:       "sku",
+			Materialized: materialized,
+		}
+		saved, err := store.Save(context.Background(), view)
+		if err != nil {
+			t.Fatalf("Unable to save view: %+v", err)
+		}
+		if saved.Materialized != materialized || (saved.Refreshed != nil) != materialized {
+			t.Errorf("Unexpected saved view %+v", saved)
+		}
+
+		results, err := store.Results(context.Background(), view.Name, 1, 1, 1000)
+		if err != nil {
+			t.Fatalf("Unable to run view: %+v", err)
+		}
+		bytes, _ := json.Marshal(results)
+		if expected := `[{"sku":"VIEWS-2"}]`; string(bytes) != expected {
+			t.Errorf("Materialized %v: expected %s, but got %s", materialized, expected, bytes)
+		}
+	}
+
+	if err := store.Delete(context.Background(), "views-test"); err != nil {
+		t.Fatalf("Unable to delete view: %+v", err)
+	}
+	if _, err := store.Results(context.Background(), "views-test", 1, 0, 1000); err == nil {
+		t.Error("Expected the deleted view to be gone")
+	}
+	if err := store.Delete(context.Background(), "views-test"); err == nil {
+		t.Error("Expected deleting a missing view to fail")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+
+	db := dbSetup(t)
+	insertSampleData(db, t)
+
+	store := NewStore(db)
+	view := View{Name: "views-refresh-test", Filter: "startswith(sku, 'VIEWS-')", Materialized: true}
+	if _, err := store.Save(context.Background(), view); err != nil {
+		t.Fatalf("Unable to save view: %+v", err)
+	}
+	defer store.Delete(context.Background(), view.Name) // nolint: errcheck
+
+	data := []productdata.SKUData{{SKU: "VIEWS-4", ProductList: []productdata.ProductData{{ProductID: "views-4"}}}}
+	if err := productdata.Insert(context.Background(), db, data); err != nil {
+		t.Fatalf("Unable to insert SKU: %+v", err)
+	}
+
+	results, err := store.Results(context.Background(), view.Name, 10, 0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Errorf("Expected the materialized view to keep 3 SKUs until refreshed, but got %d", len(results))
+	}
+
+	if _, err := store.Refresh(context.Background()); err != nil {
+		t.Fatalf("Unable to refresh views: %+v", err)
+	}
+
+	results, err = store.Results(context.Background(), view.Name, 10, 0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Errorf("Expected 4 SKUs once refreshed, but got %d", len(results))
+	}
+}
+
+func insertSampleData(db *sql.DB, t *testing.T) {
+
+	if _, err := db.Exec(`DELETE FROM skus WHERE data ->> 'sku' LIKE 'VIEWS-%'`); err != nil {
+		t.Fatalf("Unable to clean SKUs: %+v", err)
+	}
+
+	data := []productdata.SKUData{
+		{SKU: "VIEWS-1", ProductList: []productdata.ProductData{{ProductID: "views-1"}}},
+		{SKU: "VIEWS-2", ProductList: []productdata.ProductData{{ProductID: "views-2"}}},
+		{SKU: "VIEWS-3", ProductList: []productdata.ProductData{{ProductID: "views-3"}}},
+	}
+	if err := productdata.Insert(context.Background(), db, data); err != nil {
+		t.Fatalf("Unable to insert SKUs: %+v", err)
+	}
+}
+
+func dbSetup(t *testing.T) *sql.DB {
+
+	// Connect to PostgreSQL
+	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=%s", config.AppConfig.DbHost,
+		config.AppConfig.DbPort,
+		config.AppConfig.DbUser,
+		config.AppConfig.DbName,
+		config.AppConfig.DbSSLMode)
+	if config.AppConfig.DbPass != "" {
+		psqlInfo += " password=" + config.AppConfig.DbPass
+	}
+
+	db, err := sql.Open("postgres", psqlInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Create tables
+	db.Exec(productdata.DbSchema)
+	db.Exec(DbSchema)
+
+	return db
+}
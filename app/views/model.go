@@ -0,0 +1,56 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package views
+
+import (
+	"net/url"
+	"time"
+)
+
+// DbSchema postgresql db schema for the saved OData queries
+const DbSchema = `
+CREATE TABLE IF NOT EXISTS saved_views (
+	name TEXT PRIMARY KEY,
+	filter TEXT NOT NULL DEFAULT '',
+	orderby TEXT NOT NULL DEFAULT '',
+	selected TEXT NOT NULL DEFAULT '',
+	materialized BOOLEAN NOT NULL DEFAULT false,
+	created TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated TIMESTAMPTZ NOT NULL DEFAULT now(),
+	refreshed TIMESTAMPTZ
+);
+`
+
+// View is an OData query of the SKUs saved under a name
+// swagger:model view
+type View struct {
+	Name string `json:"name"`
+	// Filter, OrderBy and Select are the $filter, $orderby and $select of the query
+	Filter  string `json:"filter,omitempty"`
+	OrderBy string `json:"orderby,omitempty"`
+	Select  string `json:"select,omitempty"`
+	// Materialized views keep their results in a PostgreSQL materialized view, refreshed when
+	// the SKUs change, instead of running the query for each page
+	Materialized bool       `json:"materialized"`
+	Created      time.Time  `json:"created"`
+	Updated      time.Time  `json:"updated"`
+	Refreshed    *time.Time `json:"refreshed,omitempty"`
+}
+
+// Query returns the OData query of the view
+func (view View) Query() url.Values {
+	query := url.Values{}
+	if view.Filter != "" {
+		query.Set("$filter", view.Filter)
+	}
+	if view.OrderBy != "" {
+		query.Set("$orderby", view.OrderBy)
+	}
+	if view.Select != "" {
+		query.Set("$select", view.Select)
+	}
+	return query
+}
@@ -3,13 +3,16 @@ module github.com/intel/rsp-sw-toolkit-im-suite-product-data-service
 go 1.12
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.2.0
 	github.com/edgexfoundry/app-functions-sdk-go v0.0.0-20190709232209-37e756b47e0b
 	github.com/edgexfoundry/go-mod-core-contracts v0.1.5
 	github.com/go-stack/stack v1.8.0 // indirect
+	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/gorilla/mux v1.7.2
 	github.com/intel/rsp-sw-toolkit-im-suite-go-odata v0.1.0
 	github.com/intel/rsp-sw-toolkit-im-suite-gojsonschema v1.0.0
 	github.com/intel/rsp-sw-toolkit-im-suite-utilities v0.1.0
+	github.com/klauspost/compress v1.9.8
 	github.com/lib/pq v1.2.0
 	github.com/pborman/uuid v1.2.0
 	github.com/pkg/errors v0.8.1
@@ -10,12 +10,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	golog "log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,18 +24,36 @@ import (
 	"github.com/edgexfoundry/app-functions-sdk-go/appsdk"
 	"github.com/edgexfoundry/go-mod-core-contracts/models"
 	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/deadletter"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/idempotency"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/ingestion"
 	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/productdata"
 	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/routes"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/views"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/middlewares"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	reporter "github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics-influxdb"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 const serviceKey = "product-data-service"
 
+// edgexSource identifies events received through the EdgeX app functions SDK
+const edgexSource = "edgex"
+
+// idempotencyPurgeInterval is how often expired idempotency keys are removed
+const idempotencyPurgeInterval = time.Hour
+
 type myDB struct {
-	masterDB *sql.DB
+	masterDB         *sql.DB
+	queue            *ingestion.Queue
+	deadLetters      *deadletter.Store
+	idempotency      *idempotency.Store
+	rules            ingestion.Rules
+	valueDescriptors []string
 }
 
 func main() {
@@ -88,19 +106,162 @@ func main() {
 	defer db.Close()
 	mDbConnection.Update(1)
 
-	// Receive data from EdgeX core data
-	receiveZmqEvents(db)
+	// How the readings of each EdgeX device and value descriptor are ingested
+	rules, err := ingestion.NewRules(config.AppConfig.EdgexIngestionRules)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method":  "main",
+			"Action":  "Load ingestion rules",
+			"Message": err.Error(),
+		}).Fatal("Invalid ingestion rules.")
+	}
+
+	// Failed events are kept in the dead-letter store and retried with backoff
+	deadLetters := deadletter.NewStore(db, replayDeadLetter(db, rules), deadletter.RetryPolicy{
+		MaxAttempts:    config.AppConfig.DeadLetterMaxAttempts,
+		InitialBackoff: time.Duration(config.AppConfig.DeadLetterBackoffSeconds) * time.Second,
+		MaxBackoff:     time.Duration(config.AppConfig.DeadLetterMaxBackoffSeconds) * time.Second,
+		Interval:       time.Duration(config.AppConfig.DeadLetterRetryIntervalSeconds) * time.Second,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go deadLetters.Run(ctx)
+
+	// Requests and events are only applied once within the idempotency window
+	idempotencyWindow := time.Duration(config.AppConfig.IdempotencyWindowSeconds) * time.Second
+	idempotencyLease := time.Duration(config.AppConfig.IdempotencyLeaseSeconds) * time.Second
+	idempotencyStore := idempotency.NewStore(db, idempotencyWindow, idempotencyLease)
+	go idempotencyStore.Run(ctx, idempotencyPurgeInterval)
+
+	// Product ID lookups are cached, and invalidated by the writes of this instance
+	productdata.EnableCache(config.AppConfig.ProductCacheSize, time.Duration(config.AppConfig.ProductCacheTTLSeconds)*time.Second)
+
+	// Queries are cancelled once they run for too long, and complex filters rejected before running
+	productdata.SetQueryLimits(time.Duration(config.AppConfig.QueryTimeoutSeconds)*time.Second, config.AppConfig.MaxFilterComplexity)
+
+	// Materialized views of the saved views are refreshed once the SKUs changed
+	viewStore := views.NewStore(db)
+	go viewStore.Run(ctx, time.Duration(config.AppConfig.ViewRefreshIntervalSeconds)*time.Second)
+
+	// Receive data from the configured source
+	switch config.AppConfig.IngestionSource {
+	case edgexSource:
+		// Bounds the database connections used by the ingestion, leaving room for the REST API
+		queue := ingestion.NewQueue(ingestion.QueueConfig{
+			Workers:   config.AppConfig.IngestionWorkers,
+			Depth:     config.AppConfig.IngestionQueueDepth,
+			BatchSize: config.AppConfig.IngestionBatchSize,
+			Timeout:   time.Duration(config.AppConfig.IngestionEnqueueTimeoutSeconds) * time.Second,
+		}, storeBatch(db))
+		defer queue.Stop()
+		receiveZmqEvents(db, queue, deadLetters, idempotencyStore, rules)
+	case ingestion.MQTTSource:
+		subscriber := receiveMqttMessages(db, deadLetters, rules)
+		defer subscriber.Close()
+	default:
+		log.WithFields(log.Fields{
+			"Method": "main",
+			"Action": "Start ingestion",
+			"Source": config.AppConfig.IngestionSource,
+		}).Fatal("Unknown ingestion source.")
+	}
+
+	// Import the files dropped by enterprise systems, along with the configured source
+	if config.AppConfig.DropFolder != "" {
+		watcher, err := ingestion.NewFolderWatcher(ingestion.FolderConfig{
+			Dir:      config.AppConfig.DropFolder,
+			Interval: time.Duration(config.AppConfig.DropFolderIntervalSeconds) * time.Second,
+			Settle:   time.Duration(config.AppConfig.DropFolderSettleSeconds) * time.Second,
+		}, rules, storeBatch(db))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Method":  "main",
+				"Action":  "Watch drop folder",
+				"Message": err.Error(),
+			}).Fatal("Unable to watch drop folder.")
+		}
+		go watcher.Run(ctx)
+	}
+
+	// Authenticate the REST API requests with the configured API keys and bearer tokens
+	authenticator, err := middlewares.NewAuthenticator(middlewares.AuthConfig{
+		APIKeys:   config.AppConfig.AuthAPIKeys,
+		JWTSecret: config.AppConfig.AuthJwtSecret,
+		JWKSFile:  config.AppConfig.AuthJwksFile,
+		Issuer:    config.AppConfig.AuthJwtIssuer,
+		Audience:  config.AppConfig.AuthJwtAudience,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method":  "main",
+			"Action":  "Load credentials",
+			"Message": err.Error(),
+		}).Fatal("Unable to authenticate requests.")
+	}
+	if authenticator == nil {
+		log.WithField("Method", "main").Warn("No API key or JWT validation configured, the REST API is not authenticated.")
+	}
+
+	// Keep each client within the request rate of the route groups
+	rateLimits, err := middlewares.NewRateLimits(config.AppConfig.RateLimits)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method":  "main",
+			"Action":  "Load rate limits",
+			"Message": err.Error(),
+		}).Fatal("Invalid rate limits.")
+	}
+
+	// Responses of the deprecated API versions announce when they stop being served
+	deprecations, err := middlewares.NewDeprecations(config.AppConfig.APIDeprecations)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method":  "main",
+			"Action":  "Load API deprecations",
+			"Message": err.Error(),
+		}).Fatal("Invalid API deprecations.")
+	}
+
+	// Serve the REST API over TLS when a certificate is configured, reloading it when renewed
+	var certificates *web.CertReloader
+	if config.AppConfig.TLSCertFile != "" || config.AppConfig.TLSKeyFile != "" {
+		certificates, err = web.NewCertReloader(web.TLSFiles{
+			CertFile:     config.AppConfig.TLSCertFile,
+			KeyFile:      config.AppConfig.TLSKeyFile,
+			ClientCAFile: config.AppConfig.TLSClientCAFile,
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Method":  "main",
+				"Action":  "Load TLS certificate",
+				"Message": err.Error(),
+			}).Fatal("Unable to load TLS certificate.")
+		}
+		go certificates.Run(ctx, time.Duration(config.AppConfig.TLSReloadIntervalSeconds)*time.Second)
+	} else if config.AppConfig.TLSClientCAFile != "" {
+		log.WithField("Method", "main").Fatal("A client CA bundle requires a TLS certificate and key.")
+	}
 
 	// Initiate webserver and routes
-	startWebServer(db, config.AppConfig.Port, config.AppConfig.ResponseLimit, config.AppConfig.ServiceName)
+	startWebServer(routes.Options{
+		DB:            db,
+		DeadLetters:   deadLetters,
+		Idempotency:   idempotencyStore,
+		Views:         viewStore,
+		Authenticator: authenticator,
+		RateLimits:    rateLimits,
+		BodyLimits:    config.AppConfig.RequestBodyLimits,
+		Deprecations:  deprecations,
+		Size:          config.AppConfig.ResponseLimit,
+	}, certificates, config.AppConfig.Port, config.AppConfig.ServiceName)
 
 	log.WithField("Method", "main").Info("Completed.")
 }
 
-func startWebServer(db *sql.DB, port string, responseLimit int, serviceName string) {
+func startWebServer(options routes.Options, certificates *web.CertReloader, port string, serviceName string) {
 
 	// Start Webserver and pass additional data
-	router := routes.NewRouter(db, responseLimit)
+	router := routes.NewRouter(options)
 
 	// Create a new server and set timeout values.
 	server := http.Server{
@@ -118,7 +279,12 @@ func startWebServer(db *sql.DB, port string, responseLimit int, serviceName stri
 	// Start the listener.
 	go func() {
 		log.Infof("%s running!", serviceName)
-		log.Infof("Listener closed : %v", server.ListenAndServe())
+		if certificates != nil {
+			server.TLSConfig = certificates.TLSConfig()
+			log.Infof("Listener closed : %v", server.ListenAndServeTLS("", ""))
+		} else {
+			log.Infof("Listener closed : %v", server.ListenAndServe())
+		}
 		wg.Done()
 	}()
 
@@ -163,7 +329,9 @@ func startWebServer(db *sql.DB, port string, responseLimit int, serviceName stri
 dataProcess takes incoming product data and formats the data into
 a JSON object that we can consume and use.
 
-We are expecting the data to be passed to us in the following format:
+The payload is decoded according to the ingestion rule of the reading, see the
+ingestion package for the supported formats. The default one is a JSON array of
+IncomingData, optionally wrapped in an envelope such as:
 "value": {
 				"data": [
 							{
@@ -225,7 +393,7 @@ We will transform the data into the following format:
 ]
 
 */
-func dataProcess(jsonBytes []byte, masterDB *sql.DB) error {
+func dataProcess(payload []byte, masterDB *sql.DB, rule ingestion.Rule) error {
 	// Metrics
 	metrics.GetOrRegisterGauge(`Product-Data.dataProcess.Attempt`, nil).Update(1)
 	mUnmarshalErr := metrics.GetOrRegisterGauge("Product-Data.dataProcess.Unmarshal-Error", nil)
@@ -240,45 +408,16 @@ func dataProcess(jsonBytes []byte, masterDB *sql.DB) error {
 
 	startTime := time.Now()
 
-	log.Debugf("Received data:\n%s", string(jsonBytes))
+	log.Debugf("Received data:\n%s", string(payload))
 
-	var bv []productdata.IncomingData
-	if err := json.Unmarshal(jsonBytes, &bv); err != nil {
+	batch, err := rule.Decode(payload)
+	if err != nil {
 		mUnmarshalErr.Update(1)
-		return errors.Wrap(err, "unmarshal failed")
-	}
-	var incomingDataSlice = bv
-
-	// Transform mapping.IncomingData to map of sku -> list of mapping.SKUData
-	prodDataMap := make(map[string]productdata.SKUData)
-	for _, item := range incomingDataSlice {
-		productData := productdata.ProductData{
-			ProductID:        item.ProductID,
-			Metadata:         item.Metadata,
-			BeingRead:        item.BeingRead,
-			BecomingReadable: item.BecomingReadable,
-			DailyTurn:        item.DailyTurn,
-			ExitError:        item.ExitError,
-		}
-		skuData, repeatSKU := prodDataMap[item.SKU]
-		if repeatSKU {
-			skuData.ProductList = append(skuData.ProductList, productData)
-		} else {
-			skuData = productdata.SKUData{
-				SKU:         item.SKU,
-				ProductList: []productdata.ProductData{productData},
-			}
-		}
-		prodDataMap[item.SKU] = skuData
-	}
-
-	// extract the values to a list
-	prodDataList := make([]productdata.SKUData, 0, len(prodDataMap))
-	for _, skuData := range prodDataMap {
-		prodDataList = append(prodDataList, skuData)
+		return err
 	}
+	prodDataList := batch.SKUs
 
-	if err := productdata.Insert(masterDB, prodDataList); err != nil {
+	if err := productdata.Upsert(context.Background(), masterDB, prodDataList, rule.Mode, batch.SentOn); err != nil {
 		// Metrics not instrumented as it is handled in the controller.
 		return err
 	}
@@ -286,6 +425,7 @@ func dataProcess(jsonBytes []byte, masterDB *sql.DB) error {
 	log.WithFields(log.Fields{
 		"Length": len(prodDataList),
 		"Action": "Insert",
+		"Mode":   rule.Mode,
 	}).Info("Product data inserted")
 
 	mMappingSkuCount.Add(int64(len(prodDataList)))
@@ -309,9 +449,16 @@ func initMetrics() {
 	}
 }
 
-func receiveZmqEvents(masterDB *sql.DB) {
+func receiveZmqEvents(masterDB *sql.DB, queue *ingestion.Queue, deadLetters *deadletter.Store, idempotencyStore *idempotency.Store, rules ingestion.Rules) {
 
-	db := myDB{masterDB: masterDB}
+	db := myDB{
+		masterDB:         masterDB,
+		queue:            queue,
+		deadLetters:      deadLetters,
+		idempotency:      idempotencyStore,
+		rules:            rules,
+		valueDescriptors: config.AppConfig.EdgexValueDescriptors,
+	}
 
 	go func() {
 
@@ -322,8 +469,8 @@ func receiveZmqEvents(masterDB *sql.DB) {
 			os.Exit(-1)
 		}
 
-		// Filter data by value descriptors
-		deviceFilter := []string{"SKU_Data_Device"}
+		// Filter data by device names, readings are filtered by value descriptors in processEvents
+		deviceFilter := config.AppConfig.EdgexDeviceNames
 
 		edgexSdk.SetFunctionsPipeline(
 			edgexSdk.DeviceNameFilter(deviceFilter),
@@ -347,31 +494,268 @@ func (db myDB) processEvents(edgexcontext *appcontext.Context, params ...interfa
 
 	event := params[0].(models.Event)
 
-	if len(event.Readings) < 1 {
-		return false, nil
+	var pressure error
+
+	// Each reading is ingested on its own, so that one failing reading does not
+	// prevent the others of the same event from being processed
+	for _, reading := range event.Readings {
+
+		if len(db.valueDescriptors) > 0 && !helper.Contains(db.valueDescriptors, reading.Name) {
+			continue
+		}
+
+		// Redelivered readings are skipped
+		key, fingerprint := readingKey(event, reading)
+		if !db.claimReading(key, fingerprint) {
+			continue
+		}
+
+		rule := db.rules.Match(event.Device, reading.Name)
+
+		batch, err := decodeReading(reading.Value, rule)
+		if err != nil {
+			db.failReading(event.Device, reading, key, err)
+			continue
+		}
+
+		// Readings are stored by the queue workers, the pipeline is only blocked while the queue is full
+		reading := reading
+		job := ingestion.Job{Batch: batch, Rule: rule, Done: func(err error) {
+			if err != nil {
+				db.failReading(event.Device, reading, key, err)
+				return
+			}
+			db.completeReading(key, nil)
+		}}
+
+		if err := db.queue.Enqueue(job); err != nil {
+			db.failReading(event.Device, reading, key, err)
+			pressure = err
+		}
 	}
 
+	// Tell the pipeline the event could not be fully queued, its readings are retried from the dead-letter store
+	if pressure != nil {
+		return false, pressure
+	}
+
+	return false, nil
+}
+
+// failReading hands a reading over to the dead-letter store. It is recorded as processed
+// either way, so that redeliveries do not add it again.
+func (db myDB) failReading(device string, reading models.Reading, key string, ingestErr error) {
+	db.completeReading(key, ingestErr)
+	log.WithFields(log.Fields{
+		"Method":          "receiveZmqEvents",
+		"Action":          "product data ingestion",
+		"Device":          device,
+		"ValueDescriptor": reading.Name,
+		"Error":           ingestErr.Error(),
+	}).Error("error processing product data")
+	db.deadLetter(device, reading, ingestErr)
+}
+
+// decodeReading decodes the base64 value of a reading into the product data it holds
+func decodeReading(value string, rule ingestion.Rule) (ingestion.Batch, error) {
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return ingestion.Batch{}, errors.Wrap(err, "error decoding base64 value")
+	}
+
+	batch, err := rule.Decode(data)
+	if err != nil {
+		metrics.GetOrRegisterGauge("Product-Data.dataProcess.Unmarshal-Error", nil).Update(1)
+		return ingestion.Batch{}, err
+	}
+
+	return batch, nil
+}
+
+// ingestReading decodes the value of a reading and processes the product data it holds
+func ingestReading(value string, masterDB *sql.DB, rule ingestion.Rule) error {
+
 	// Value is base64 encoded
-	data, err := base64.StdEncoding.DecodeString(event.Readings[0].Value)
+	data, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
+		return errors.Wrap(err, "error decoding base64 value")
+	}
+
+	return dataProcess(data, masterDB, rule)
+}
+
+// readingKey identifies a reading by the ID of its event when set, or by the checksum of its origin and value
+// otherwise. Readings with neither get no key and are not deduplicated, since a device reporting the same value
+// again could not be told apart from a redelivery.
+func readingKey(event models.Event, reading models.Reading) (string, string) {
+	fingerprint := idempotency.Checksum([]byte(event.Device + "/" + reading.Name + "/" + reading.Value))
+	if event.ID != "" {
+		return event.ID + "/" + reading.Name, fingerprint
+	}
+
+	origin := reading.Origin
+	if origin == 0 {
+		origin = event.Origin
+	}
+	if origin == 0 {
+		return "", fingerprint
+	}
+	return "sha256:" + idempotency.Checksum([]byte(strconv.FormatInt(origin, 10)+"/"+fingerprint)), fingerprint
+}
+
+// claimReading returns false when the reading was already processed or is being processed.
+// Readings are processed if the idempotency store fails, as losing data is worse than applying it twice.
+func (db myDB) claimReading(key string, fingerprint string) bool {
+
+	if db.idempotency == nil || key == "" {
+		return true
+	}
+
+	stored, err := db.idempotency.Claim(edgexSource, key, fingerprint)
+	if err == nil && stored == nil {
+		return true
+	}
+
+	if common, ok := err.(web.CommonError); stored != nil || (ok && common.Code == http.StatusConflict) {
+		metrics.GetOrRegisterGauge(`Product-Data.processEvents.Duplicate`, nil).Update(1)
 		log.WithFields(log.Fields{
 			"Method": "receiveZmqEvents",
-			"Action": "product data ingestion",
-			"Error":  err.Error(),
-		}).Error("error decoding base64 value")
-		return false, nil
+			"Action": "idempotency check",
+			"Key":    key,
+		}).Debug("skipping redelivered reading")
+		return false
+	}
+
+	log.WithFields(log.Fields{
+		"Method": "receiveZmqEvents",
+		"Action": "idempotency check",
+		"Key":    key,
+		"Error":  err.Error(),
+	}).Warn("unable to check reading idempotency, processing it")
+	return true
+}
+
+func (db myDB) completeReading(key string, ingestErr error) {
+
+	if db.idempotency == nil || key == "" {
+		return
+	}
+
+	response := idempotency.Response{Status: http.StatusOK}
+	if ingestErr != nil {
+		response.Status = http.StatusInternalServerError
+		response.Body = []byte(ingestErr.Error())
 	}
 
-	if err := dataProcess(data, db.masterDB); err != nil {
+	if err := db.idempotency.Complete(edgexSource, key, response); err != nil {
 		log.WithFields(log.Fields{
 			"Method": "receiveZmqEvents",
+			"Action": "idempotency record",
+			"Key":    key,
+			"Error":  err.Error(),
+		}).Error("unable to record processed reading")
+	}
+}
+
+// deadLetter keeps a reading that failed ingestion so that it is retried later
+func (db myDB) deadLetter(device string, reading models.Reading, ingestErr error) {
+	db.keepDeadLetter(deadletter.Letter{
+		Source:          edgexSource,
+		Device:          device,
+		ValueDescriptor: reading.Name,
+		Payload:         []byte(reading.Value),
+		Error:           ingestErr.Error(),
+	})
+}
+
+func (db myDB) keepDeadLetter(letter deadletter.Letter) {
+	if err := db.deadLetters.Add(letter); err != nil {
+		log.WithFields(log.Fields{
+			"Method": "keepDeadLetter",
+			"Action": "dead-letter store",
+			"Source": letter.Source,
+			"Error":  err.Error(),
+		}).Error("unable to keep failed product data, the event is lost")
+	}
+}
+
+// receiveMqttMessages subscribes to the configured MQTT topic, an alternative to EdgeX
+// for deployments without core data
+func receiveMqttMessages(masterDB *sql.DB, deadLetters *deadletter.Store, rules ingestion.Rules) *ingestion.MQTTSubscriber {
+
+	db := myDB{masterDB: masterDB, deadLetters: deadLetters, rules: rules}
+
+	subscriber, err := ingestion.NewMQTTSubscriber(ingestion.MQTTConfig{
+		Broker:   config.AppConfig.MqttBroker,
+		Topic:    config.AppConfig.MqttTopic,
+		QoS:      byte(config.AppConfig.MqttQoS),
+		ClientID: config.AppConfig.MqttClientID,
+		Username: config.AppConfig.MqttUsername,
+		Password: config.AppConfig.MqttPassword,
+		CAFile:   config.AppConfig.MqttCAFile,
+		CertFile: config.AppConfig.MqttCertFile,
+		KeyFile:  config.AppConfig.MqttKeyFile,
+	}, db.processMessage)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method":  "receiveMqttMessages",
+			"Action":  "Subscribe",
+			"Message": err.Error(),
+		}).Fatal("Unable to subscribe to MQTT topic.")
+	}
+
+	return subscriber
+}
+
+// processMessage ingests the payload of an MQTT message, which unlike EdgeX readings is not base64 encoded
+func (db myDB) processMessage(topic string, payload []byte) {
+
+	rule := db.rules.Match(ingestion.MQTTSource, topic)
+
+	if err := dataProcess(payload, db.masterDB, rule); err != nil {
+		log.WithFields(log.Fields{
+			"Method": "receiveMqttMessages",
 			"Action": "product data ingestion",
+			"Topic":  topic,
 			"Error":  err.Error(),
 		}).Error("error processing product data")
-		return false, nil
+		db.keepDeadLetter(deadletter.Letter{
+			Source:          ingestion.MQTTSource,
+			ValueDescriptor: topic,
+			Payload:         payload,
+			Error:           err.Error(),
+		})
 	}
+}
 
-	return false, nil
+// storeBatch stores the product data decoded by the ingestion queue and the drop folder
+func storeBatch(masterDB *sql.DB) ingestion.Store {
+	return func(batch ingestion.Batch, rule ingestion.Rule) error {
+		if err := productdata.Upsert(context.Background(), masterDB, batch.SKUs, rule.Mode, batch.SentOn); err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"Length": len(batch.SKUs),
+			"Action": "Insert",
+			"Mode":   rule.Mode,
+		}).Info("Product data inserted")
+
+		metrics.GetOrRegisterGaugeCollection("Product-Data.dataProcess.MappingData-SKU-Count", nil).Add(int64(len(batch.SKUs)))
+		return nil
+	}
+}
+
+// replayDeadLetter returns the processor ingesting dead letters again
+func replayDeadLetter(masterDB *sql.DB, rules ingestion.Rules) deadletter.Processor {
+	return func(letter deadletter.Letter) error {
+		if letter.Source == ingestion.MQTTSource {
+			return dataProcess(letter.Payload, masterDB, rules.Match(ingestion.MQTTSource, letter.ValueDescriptor))
+		}
+		rule := rules.Match(letter.Device, letter.ValueDescriptor)
+		return ingestReading(string(letter.Payload), masterDB, rule)
+	}
 }
 
 func setLoggingLevel(loggingLevel string) {
@@ -417,5 +801,17 @@ func dbSetup(host, port, user, password, dbname, sslmode string) (*sql.DB, error
 		return nil, errExec
 	}
 
+	if _, err := db.Exec(deadletter.DbSchema); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(idempotency.DbSchema); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(views.DbSchema); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
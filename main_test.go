@@ -10,7 +10,9 @@ import (
 	"os"
 	"testing"
 
+	"github.com/edgexfoundry/go-mod-core-contracts/models"
 	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/app/ingestion"
 )
 
 //nolint :dupl
@@ -70,7 +72,35 @@ func TestDataProcess(t *testing.T) {
 							}
 						]`)
 
-	if err := dataProcess(JSONSample, db); err != nil {
+	if err := dataProcess(JSONSample, db, ingestion.DefaultRule); err != nil {
 		t.Fatalf("error processing product data: %+v", err)
 	}
 }
+
+func TestReadingKey(t *testing.T) {
+
+	reading := models.Reading{Name: "SKU_data", Value: "e30="}
+
+	// Readings of events with an ID are identified by it
+	key, fingerprint := readingKey(models.Event{ID: "event-1", Device: "erp"}, reading)
+	if key != "event-1/SKU_data" || fingerprint == "" {
+		t.Errorf("Expected the key of the event, but got %q %q", key, fingerprint)
+	}
+
+	// The same value reported at another time is another reading
+	first, _ := readingKey(models.Event{Device: "erp", Origin: 1}, reading)
+	second, _ := readingKey(models.Event{Device: "erp", Origin: 2}, reading)
+	if first == "" || first == second {
+		t.Errorf("Expected distinct keys for distinct origins, but got %q and %q", first, second)
+	}
+	reading.Origin = 1
+	if key, _ := readingKey(models.Event{Device: "erp", Origin: 2}, reading); key != first {
+		t.Errorf("Expected the origin of the reading to be used, but got %q", key)
+	}
+
+	// Readings without an event ID nor an origin are not deduplicated
+	reading.Origin = 0
+	if key, _ := readingKey(models.Event{Device: "erp"}, reading); key != "" {
+		t.Errorf("Expected no key, but got %q", key)
+	}
+}
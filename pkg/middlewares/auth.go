@@ -0,0 +1,413 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package middlewares
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// APIKeyHeader is the header holding a static API key
+	APIKeyHeader = "X-API-Key"
+	// APIKeyMethod and JWTMethod tell how a principal was authenticated
+	APIKeyMethod = "apiKey"
+	JWTMethod    = "jwt"
+
+	bearerPrefix = "Bearer "
+)
+
+type principalKey struct{}
+
+// AuthConfig lists the credentials accepted by the REST API
+type AuthConfig struct {
+	// APIKeys are static keys sent in the X-API-Key header, each optionally followed by
+	// the scopes it grants separated by spaces. A key without scopes grants them all.
+	APIKeys []string
+	// JWTSecret validates bearer tokens signed with HS256, HS384 or HS512
+	JWTSecret string
+	// JWKSFile is a JSON Web Key Set validating bearer tokens signed with RSA or ECDSA keys
+	JWKSFile string
+	// Issuer and Audience, when set, must match the iss and aud claims of bearer tokens
+	Issuer   string
+	Audience string
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject string
+	Method  string
+	Scopes  []string
+	Claims  jwt.MapClaims
+
+	unrestricted bool
+}
+
+// HasScope tells whether the caller was granted a scope
+func (principal *Principal) HasScope(scope string) bool {
+	if principal.unrestricted {
+		return true
+	}
+	for _, granted := range principal.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type apiKey struct {
+	hash   []byte
+	scopes []string
+}
+
+// Authenticator checks the API key or bearer token of requests
+type Authenticator struct {
+	apiKeys  []apiKey
+	secret   []byte
+	keys     map[string]interface{}
+	issuer   string
+	audience string
+}
+
+// NewAuthenticator creates an authenticator from the configured credentials.
+// It returns nil when none is configured, in which case requests are not authenticated.
+func NewAuthenticator(config AuthConfig) (*Authenticator, error) {
+
+	auth := &Authenticator{
+		secret:   []byte(config.JWTSecret),
+		issuer:   config.Issuer,
+		audience: config.Audience,
+	}
+
+	for _, entry := range config.APIKeys {
+		if fields := strings.Fields(entry); len(fields) > 0 {
+			sum := sha256.Sum256([]byte(fields[0]))
+			auth.apiKeys = append(auth.apiKeys, apiKey{hash: sum[:], scopes: fields[1:]})
+		}
+	}
+
+	if config.JWKSFile != "" {
+		keys, err := loadJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.keys = keys
+	}
+
+	if len(auth.apiKeys) == 0 && len(auth.secret) == 0 && len(auth.keys) == 0 {
+		return nil, nil
+	}
+	return auth, nil
+}
+
+// Authenticate middleware rejects the requests without a valid API key or bearer token
+func (auth *Authenticator) Authenticate(next web.Handler) web.Handler {
+	return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+		principal, err := auth.principal(request)
+		if err != nil {
+			tracerID := ctx.Value(web.KeyValues).(*web.ContextValues).TraceID
+			log.WithFields(log.Fields{
+				"Method":     request.Method,
+				"RequestURI": request.RequestURI,
+				"TraceID":    tracerID,
+				"Code":       http.StatusUnauthorized,
+				"Error":      err.Error(),
+			}).Error("Request not authenticated")
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="product-data"`)
+			return web.NotAuthorizedError()
+		}
+
+		ctx = context.WithValue(ctx, principalKey{}, principal)
+		return next(ctx, writer, request)
+	})
+}
+
+// PrincipalFromContext returns the caller authenticated by the Authenticate middleware, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+func (auth *Authenticator) principal(request *http.Request) (*Principal, error) {
+
+	if key := request.Header.Get(APIKeyHeader); key != "" {
+		return auth.checkAPIKey(key)
+	}
+
+	authorization := request.Header.Get("Authorization")
+	if len(authorization) > len(bearerPrefix) && strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix) {
+		return auth.checkToken(strings.TrimSpace(authorization[len(bearerPrefix):]))
+	}
+
+	return nil, errors.New("missing credentials")
+}
+
+func (auth *Authenticator) checkAPIKey(key string) (*Principal, error) {
+
+	sum := sha256.Sum256([]byte(key))
+
+	// Every key is compared so that the time taken does not tell which one is closest
+	match := -1
+	for i, apiKey := range auth.apiKeys {
+		if subtle.ConstantTimeCompare(sum[:], apiKey.hash) == 1 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return nil, errors.New("invalid API key")
+	}
+
+	// Keys are identified by the start of their hash so that they are not logged
+	scopes := auth.apiKeys[match].scopes
+	return &Principal{
+		Subject:      APIKeyMethod + ":" + hex.EncodeToString(sum[:4]),
+		Method:       APIKeyMethod,
+		Scopes:       scopes,
+		unrestricted: len(scopes) == 0,
+	}, nil
+}
+
+func (auth *Authenticator) checkToken(raw string) (*Principal, error) {
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(raw, claims, auth.verificationKey); err != nil {
+		return nil, err
+	}
+	// The expiration is only checked by the parser when present, tokens without one would never expire
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("token without expiration")
+	}
+
+	if auth.issuer != "" && !claims.VerifyIssuer(auth.issuer, true) {
+		return nil, errors.New("invalid token issuer")
+	}
+	if auth.audience != "" && !hasAudience(claims, auth.audience) {
+		return nil, errors.New("invalid token audience")
+	}
+
+	subject, _ := claims["sub"].(string)
+	return &Principal{Subject: subject, Method: JWTMethod, Scopes: tokenScopes(claims), Claims: claims}, nil
+}
+
+// tokenScopes collects the scopes of the scope and scp claims along with the roles claim,
+// each holding either a space separated string or an array of strings
+func tokenScopes(claims jwt.MapClaims) []string {
+	var scopes []string
+	for _, name := range []string{"scope", "scp", "roles"} {
+		switch value := claims[name].(type) {
+		case string:
+			scopes = append(scopes, strings.Fields(value)...)
+		case []interface{}:
+			for _, item := range value {
+				if scope, ok := item.(string); ok {
+					scopes = append(scopes, scope)
+				}
+			}
+		}
+	}
+	return scopes
+}
+
+// RequireScope middleware rejects the requests of callers granted none of the scopes.
+// It must be wrapped by the Authenticate middleware.
+func RequireScope(scopes ...string) web.Middleware {
+	return func(next web.Handler) web.Handler {
+		return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+			principal, ok := PrincipalFromContext(ctx)
+			if !ok {
+				return web.NotAuthorizedError()
+			}
+
+			for _, scope := range scopes {
+				if principal.HasScope(scope) {
+					return next(ctx, writer, request)
+				}
+			}
+
+			tracerID := ctx.Value(web.KeyValues).(*web.ContextValues).TraceID
+			log.WithFields(log.Fields{
+				"Method":     request.Method,
+				"RequestURI": request.RequestURI,
+				"TraceID":    tracerID,
+				"Code":       http.StatusForbidden,
+				"Subject":    principal.Subject,
+				"Scopes":     strings.Join(scopes, " "),
+			}).Error("Missing scope")
+			return web.ForbiddenError()
+		})
+	}
+}
+
+// verificationKey returns the key validating a token, refusing the algorithms that were not configured
+// so that a public key of the key set can never be used as an HMAC secret
+func (auth *Authenticator) verificationKey(token *jwt.Token) (interface{}, error) {
+
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(auth.secret) == 0 {
+			return nil, errors.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return auth.secret, nil
+
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		kid, _ := token.Header["kid"].(string)
+		key, ok := auth.keys[kid]
+		// Tokens without a key ID are accepted when the key set has a single key
+		if !ok && kid == "" && len(auth.keys) == 1 {
+			for _, only := range auth.keys {
+				key, ok = only, true
+			}
+		}
+		if !ok {
+			return nil, errors.Errorf("unknown key %q", kid)
+		}
+
+		_, isRSA := key.(*rsa.PublicKey)
+		_, isECDSA := token.Method.(*jwt.SigningMethodECDSA)
+		if isRSA == isECDSA {
+			return nil, errors.Errorf("key %q cannot verify %s", kid, token.Method.Alg())
+		}
+		return key, nil
+	}
+
+	return nil, errors.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+// hasAudience checks the aud claim, which is either a string or an array of strings
+func hasAudience(claims jwt.MapClaims, audience string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, value := range aud {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// loadJWKS reads the RSA and EC public keys of a JSON Web Key Set, indexed by key ID
+func loadJWKS(file string) (map[string]interface{}, error) {
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the JWKS file")
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, errors.Wrap(err, "invalid JWKS file")
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		var key interface{}
+		switch jwk.Kty {
+		case "RSA":
+			key, err = rsaKey(jwk)
+		case "EC":
+			key, err = ecdsaKey(jwk)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %q in JWKS file", jwk.Kid)
+		}
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signing key in JWKS file")
+	}
+	return keys, nil
+}
+
+func rsaKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 {
+		return nil, errors.New("invalid RSA modulus or exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func ecdsaKey(jwk jsonWebKey) (*ecdsa.PublicKey, error) {
+
+	var curve elliptic.Curve
+	switch jwk.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, errors.Errorf("unsupported curve %q", jwk.Crv)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("point is not on the curve")
+	}
+	return key, nil
+}
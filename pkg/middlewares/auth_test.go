@@ -0,0 +1,212 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+)
+
+func TestNewAuthenticatorDisabled(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: []string{" "}})
+	if err != nil || auth != nil {
+		t.Errorf("Expected no authenticator without credentials, but got %v, %v", auth, err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksFile := filepath.Join(dir, "jwks.json")
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"key-1","use":"sig","n":"%s","e":"%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()))
+	if err := ioutil.WriteFile(jwksFile, []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := NewAuthenticator(AuthConfig{
+		APIKeys:   []string{"first-key", "second-key"},
+		JWTSecret: "shared-secret",
+		JWKSFile:  jwksFile,
+		Audience:  "product-data",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var principal *Principal
+	handler := auth.Authenticate(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		principal, _ = PrincipalFromContext(ctx)
+		writer.WriteHeader(http.StatusOK)
+		return nil
+	})
+
+	claims := func(exp time.Duration) jwt.MapClaims {
+		return jwt.MapClaims{"sub": "erp", "aud": "product-data", "exp": time.Now().Add(exp).Unix()}
+	}
+	sign := func(method jwt.SigningMethod, claims jwt.MapClaims, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	publicKey := base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes())
+
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		code    int
+		subject string
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized, ""},
+		{"api key", APIKeyHeader, "second-key", http.StatusOK, ""},
+		{"invalid api key", APIKeyHeader, "third-key", http.StatusUnauthorized, ""},
+		{"shared secret", "Authorization", "Bearer " + sign(jwt.SigningMethodHS256, claims(time.Hour), "", []byte("shared-secret")), http.StatusOK, "erp"},
+		{"key set", "Authorization", "bearer " + sign(jwt.SigningMethodRS256, claims(time.Hour), "key-1", privateKey), http.StatusOK, "erp"},
+		{"expired", "Authorization", "Bearer " + sign(jwt.SigningMethodRS256, claims(-time.Hour), "key-1", privateKey), http.StatusUnauthorized, ""},
+		{"unknown key", "Authorization", "Bearer " + sign(jwt.SigningMethodRS256, claims(time.Hour), "key-2", privateKey), http.StatusUnauthorized, ""},
+		{"wrong secret", "Authorization", "Bearer " + sign(jwt.SigningMethodHS256, claims(time.Hour), "", []byte(publicKey)), http.StatusUnauthorized, ""},
+		{"wrong audience", "Authorization", "Bearer " + sign(jwt.SigningMethodHS256, jwt.MapClaims{"aud": []string{"other"}}, "", []byte("shared-secret")), http.StatusUnauthorized, ""},
+		{"audience list", "Authorization", "Bearer " + sign(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "erp", "aud": []string{"other", "product-data"}, "exp": time.Now().Add(time.Hour).Unix()}, "", []byte("shared-secret")), http.StatusOK, "erp"},
+		{"no expiration", "Authorization", "Bearer " + sign(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "erp", "aud": "product-data"}, "", []byte("shared-secret")), http.StatusUnauthorized, ""},
+		{"unsigned", "Authorization", "Bearer " + sign(jwt.SigningMethodNone, claims(time.Hour), "", jwt.UnsafeAllowNoneSignatureType), http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		principal = nil
+		request := httptest.NewRequest("POST", "/skus", nil)
+		if test.header != "" {
+			request.Header.Set(test.header, test.value)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s: expected %d, but got %d", test.name, test.code, recorder.Code)
+			continue
+		}
+		if test.code == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", test.name)
+		}
+		if test.code == http.StatusOK && (principal == nil || (test.subject != "" && principal.Subject != test.subject)) {
+			t.Errorf("%s: unexpected principal %+v", test.name, principal)
+		}
+	}
+}
+
+func TestLoadJWKSInvalid(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"empty.json":   `{"keys":[]}`,
+		"invalid.json": `{"keys":`,
+		"curve.json":   `{"keys":[{"kty":"EC","crv":"P-192","x":"AA","y":"AA"}]}`,
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewAuthenticator(AuthConfig{JWKSFile: file}); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+	if _, err := NewAuthenticator(AuthConfig{JWKSFile: filepath.Join(dir, "missing.json")}); err == nil {
+		t.Error("Expected a missing JWKS file to be rejected")
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+
+	auth, err := NewAuthenticator(AuthConfig{
+		APIKeys:   []string{"handheld-key products:read", "full-key"},
+		JWTSecret: "shared-secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := auth.Authenticate(RequireScope("products:write", "admin")(
+		func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+			writer.WriteHeader(http.StatusOK)
+			return nil
+		}))
+
+	token := func(claims jwt.MapClaims) string {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("shared-secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + signed
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		code   int
+	}{
+		{"scoped api key", APIKeyHeader, "handheld-key", http.StatusForbidden},
+		{"unscoped api key", APIKeyHeader, "full-key", http.StatusOK},
+		{"scope claim", "Authorization", token(jwt.MapClaims{"scope": "products:read products:write"}), http.StatusOK},
+		{"scp claim", "Authorization", token(jwt.MapClaims{"scp": []string{"products:read"}}), http.StatusForbidden},
+		{"roles claim", "Authorization", token(jwt.MapClaims{"roles": []string{"admin"}}), http.StatusOK},
+		{"no scope", "Authorization", token(jwt.MapClaims{"sub": "erp"}), http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("POST", "/skus", nil)
+		request.Header.Set(test.header, test.value)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s: expected %d, but got %d", test.name, test.code, recorder.Code)
+		}
+	}
+
+	// Without authentication there is no caller to check the scopes of
+	recorder := httptest.NewRecorder()
+	RequireScope("admin")(nil).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d, but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+}
@@ -1,64 +1,85 @@
 /* Apache v2 license
-*  Copyright (C) <2019> Intel Corporation
+*  Copyright (C) <2019> Intel Corporation
 *
 *  SPDX-License-Identifier: Apache-2.0
  */
 package middlewares
 
 import (
-	"bytes"
 	"context"
-	"io/ioutil"
+	"io"
 	"net/http"
-	"strconv"
 
 	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
 	log "github.com/sirupsen/logrus"
 )
 
-// max size limit of body 16MB
-const (
-	requestMaxSize = 16 << 20
-)
+// DefaultBodyLimit is the size limit of request bodies, 16MB
+const DefaultBodyLimit = 16 << 20
 
-// BodyLimiter middleware
-func BodyLimiter(next web.Handler) web.Handler {
-	return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
-		if request.Method == http.MethodPost || request.Method == http.MethodPut {
-			tracerID := ctx.Value(web.KeyValues).(*web.ContextValues).TraceID
+// BodyLimiter middleware rejects the requests whose body is larger than limit bytes.
+// Bodies announcing their length are rejected upfront, while chunked bodies are read
+// as usual until the limit is reached, at which point reading them fails with an
+// EntityTooLargeError that handlers return as is.
+func BodyLimiter(limit int64) web.Middleware {
+	return func(next web.Handler) web.Handler {
+		return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
 
-			// check based on content length
-			headerSet := request.Header.Get("Content-Length")
-			if headerSet != "" && request.ContentLength > requestMaxSize {
+			tooLarge := func() error {
+				tracerID := ctx.Value(web.KeyValues).(*web.ContextValues).TraceID
 				log.WithFields(log.Fields{
 					"Method":     request.Method,
 					"RequestURI": request.RequestURI,
 					"TraceID":    tracerID,
 					"Code":       http.StatusRequestEntityTooLarge,
+					"Limit":      limit,
 				}).Error("Request entity too large")
+				// The rest of the body is not read, so the connection cannot be reused
+				writer.Header().Set("Connection", "close")
 				return web.EntityTooLargeError()
 			}
 
-			// If header not set, set content length based on actual size of the body
-			if headerSet == "" {
-				var buf bytes.Buffer
-				reqBody := http.MaxBytesReader(writer, request.Body, requestMaxSize)
-				bodySize, err := buf.ReadFrom(reqBody)
-				if err != nil {
-					log.WithFields(log.Fields{
-						"Method":     request.Method,
-						"RequestURI": request.RequestURI,
-						"TraceID":    tracerID,
-						"Code":       http.StatusRequestEntityTooLarge,
-					}).Error("Request entity too large")
-					return web.EntityTooLargeError()
-				}
-				request.Header.Set("Content-Length", strconv.Itoa(int(bodySize)))
-				request.Body = ioutil.NopCloser(&buf)
+			// check based on content length
+			if request.ContentLength > limit {
+				return tooLarge()
+			}
+
+			if request.Body != nil && request.Body != http.NoBody {
+				request.Body = &limitedBody{ReadCloser: request.Body, remaining: limit, tooLarge: tooLarge}
 			}
 
-		}
-		return next(ctx, writer, request)
-	})
+			return next(ctx, writer, request)
+		})
+	}
+}
+
+// limitedBody fails once more than the limit is read from the body
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	tooLarge  func() error
+	err       error
+}
+
+func (body *limitedBody) Read(data []byte) (int, error) {
+
+	if body.err != nil {
+		return 0, body.err
+	}
+
+	// One more byte than allowed is read to tell a body of exactly the limit from a larger one
+	if int64(len(data)) > body.remaining+1 {
+		data = data[:body.remaining+1]
+	}
+
+	n, err := body.ReadCloser.Read(data)
+	if int64(n) <= body.remaining {
+		body.remaining -= int64(n)
+		return n, err
+	}
 
+	body.err = body.tooLarge()
+	n = int(body.remaining)
+	body.remaining = 0
+	return n, body.err
 }
@@ -0,0 +1,80 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package middlewares
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimiter(t *testing.T) {
+
+	handler := BodyLimiter(10)(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			return err
+		}
+		writer.WriteHeader(http.StatusOK)
+		_, err = writer.Write(body)
+		return err
+	})
+
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		code    int
+	}{
+		{"within limit", "0123456789", false, http.StatusOK},
+		{"over limit", "0123456789a", false, http.StatusRequestEntityTooLarge},
+		{"chunked within limit", "0123456789", true, http.StatusOK},
+		{"chunked over limit", strings.Repeat("0123456789", 100), true, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("POST", "/skus", strings.NewReader(test.body))
+		if test.chunked {
+			// The length of chunked bodies is unknown until they are read
+			request.ContentLength = -1
+			request.Body = ioutil.NopCloser(strings.NewReader(test.body))
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s: expected %d, but got %d", test.name, test.code, recorder.Code)
+		}
+		if test.code == http.StatusOK && recorder.Body.String() != test.body {
+			t.Errorf("%s: expected the body to be read whole, but got %q", test.name, recorder.Body.String())
+		}
+		if test.code == http.StatusRequestEntityTooLarge && recorder.Header().Get("Connection") != "close" {
+			t.Errorf("%s: expected the connection to be closed", test.name)
+		}
+	}
+}
+
+func TestLimitedBodyReadsUpToLimit(t *testing.T) {
+
+	body := &limitedBody{
+		ReadCloser: ioutil.NopCloser(strings.NewReader("0123456789")),
+		remaining:  4,
+		tooLarge:   func() error { return http.ErrBodyNotAllowed },
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if string(data) != "0123" || err != http.ErrBodyNotAllowed {
+		t.Errorf("Expected the first 4 bytes and an error, but got %q, %v", data, err)
+	}
+
+	// The error sticks
+	if n, err := body.Read(make([]byte, 10)); n != 0 || err != http.ErrBodyNotAllowed {
+		t.Errorf("Expected the error again, but got %d, %v", n, err)
+	}
+}
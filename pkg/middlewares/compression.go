@@ -0,0 +1,235 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package middlewares
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	gzipEncoding     = "gzip"
+	zstdEncoding     = "zstd"
+	identityEncoding = "identity"
+
+	// minCompressedSize is the size below which responses are not worth compressing
+	minCompressedSize = 1024
+	// maxZstdWindow bounds the memory a zstd request body can make the decoder allocate,
+	// the maximum memory of a streaming decoder being the maximum size of its window
+	maxZstdWindow = 8 << 20
+)
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+var zstdWriters = sync.Pool{
+	New: func() interface{} {
+		writer, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return writer
+	},
+}
+
+// Compression middleware decompresses gzip and zstd request bodies, and compresses responses
+// with the encoding preferred by the client's Accept-Encoding header. It must wrap the
+// BodyLimiter middleware so that the limit applies to the decompressed body, which keeps a
+// small compressed request from expanding into an unbounded one.
+func Compression(next web.Handler) web.Handler {
+	return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+		if err := decompressBody(request); err != nil {
+			return err
+		}
+
+		writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(request.Header.Get("Accept-Encoding"))
+		if encoding == "" || request.Method == http.MethodHead {
+			return next(ctx, writer, request)
+		}
+
+		compressor := &compressWriter{ResponseWriter: writer, encoding: encoding}
+		defer compressor.Close()
+
+		return next(ctx, compressor, request)
+	})
+}
+
+// decompressBody replaces a compressed request body by its decompressed content
+func decompressBody(request *http.Request) error {
+
+	encoding := strings.ToLower(strings.TrimSpace(request.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == identityEncoding || request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+
+	var decompressed io.ReadCloser
+	switch encoding {
+	case gzipEncoding:
+		reader, err := gzip.NewReader(request.Body)
+		if err != nil {
+			return web.InvalidInputError(err)
+		}
+		decompressed = reader
+	case zstdEncoding:
+		reader, err := zstd.NewReader(request.Body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxZstdWindow))
+		if err != nil {
+			return web.InvalidInputError(err)
+		}
+		decompressed = reader.IOReadCloser()
+	default:
+		return web.UnsupportedMediaTypeError("a gzip, zstd or identity content encoding")
+	}
+
+	request.Body = &decompressedBody{Reader: decompressed, compressed: request.Body}
+	request.Header.Del("Content-Encoding")
+	request.Header.Del("Content-Length")
+	// The decompressed length is only known once read
+	request.ContentLength = -1
+
+	return nil
+}
+
+// decompressedBody closes both the decompressor and the underlying body
+type decompressedBody struct {
+	io.Reader
+	compressed io.Closer
+}
+
+func (body *decompressedBody) Close() error {
+	if closer, ok := body.Reader.(io.Closer); ok {
+		closer.Close()
+	}
+	return body.compressed.Close()
+}
+
+// negotiateEncoding returns the supported encoding with the highest quality in an
+// Accept-Encoding header, zstd being preferred on a tie, or "" to leave responses as is
+func negotiateEncoding(accept string) string {
+
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				value, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					value = 0
+				}
+				quality = value
+			}
+		}
+
+		if coding == "*" {
+			coding = gzipEncoding
+		}
+		if coding != gzipEncoding && coding != zstdEncoding {
+			continue
+		}
+		if quality > bestQuality || (quality == bestQuality && quality > 0 && coding == zstdEncoding) {
+			best, bestQuality = coding, quality
+		}
+	}
+	return best
+}
+
+// compressWriter compresses the response once its first write shows it is large enough,
+// holding the status code back until then since the headers depend on that choice
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	started  bool
+	encoder  io.WriteCloser
+}
+
+func (writer *compressWriter) WriteHeader(status int) {
+	if writer.started || writer.status != 0 {
+		return
+	}
+	writer.status = status
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		writer.start(0)
+	}
+}
+
+func (writer *compressWriter) Write(data []byte) (int, error) {
+	if !writer.started {
+		writer.start(len(data))
+	}
+	if writer.encoder != nil {
+		return writer.encoder.Write(data)
+	}
+	return writer.ResponseWriter.Write(data)
+}
+
+// start chooses whether to compress the response and sends the headers
+func (writer *compressWriter) start(size int) {
+
+	writer.started = true
+	header := writer.Header()
+
+	if size >= minCompressedSize && header.Get("Content-Encoding") == "" && compressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", writer.encoding)
+		header.Del("Content-Length")
+
+		switch writer.encoding {
+		case gzipEncoding:
+			encoder := gzipWriters.Get().(*gzip.Writer)
+			encoder.Reset(writer.ResponseWriter)
+			writer.encoder = encoder
+		case zstdEncoding:
+			encoder := zstdWriters.Get().(*zstd.Encoder)
+			encoder.Reset(writer.ResponseWriter)
+			writer.encoder = encoder
+		}
+	}
+
+	if writer.status != 0 {
+		writer.ResponseWriter.WriteHeader(writer.status)
+	}
+}
+
+// Close flushes the compressed response, or sends the headers of a response without body
+func (writer *compressWriter) Close() {
+
+	if !writer.started {
+		writer.start(0)
+	}
+	if writer.encoder == nil {
+		return
+	}
+
+	writer.encoder.Close()
+	switch encoder := writer.encoder.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(encoder)
+	case *zstd.Encoder:
+		zstdWriters.Put(encoder)
+	}
+	writer.encoder = nil
+}
+
+// compressible tells whether a content type is worth compressing, which is not the case of
+// content already compressed
+func compressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "video/") &&
+		!strings.Contains(contentType, "zip") && !strings.Contains(contentType, "zstd")
+}
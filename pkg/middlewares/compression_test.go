@@ -0,0 +1,165 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+
+	tests := map[string]string{
+		"":                         "",
+		"identity":                 "",
+		"gzip":                     "gzip",
+		"gzip, deflate, br":        "gzip",
+		"gzip, zstd":               "zstd",
+		"zstd;q=0.5, gzip":         "gzip",
+		"gzip;q=0, zstd;q=0":       "",
+		"*":                        "gzip",
+		"deflate;q=1.0, GZIP;q=.8": "gzip",
+	}
+	for accept, expected := range tests {
+		if encoding := negotiateEncoding(accept); encoding != expected {
+			t.Errorf("Expected %q for %q, but got %q", expected, accept, encoding)
+		}
+	}
+}
+
+func TestCompressResponse(t *testing.T) {
+
+	large := map[string]string{"results": strings.Repeat("MS122-32 ", 500)}
+
+	tests := []struct {
+		accept   string
+		data     interface{}
+		encoding string
+	}{
+		{"gzip", large, "gzip"},
+		{"zstd, gzip", large, "zstd"},
+		{"", large, ""},
+		{"gzip", "small", ""},
+	}
+
+	for _, test := range tests {
+		data := test.data
+		handler := Compression(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+			web.Respond(ctx, writer, data, http.StatusOK)
+			return nil
+		})
+
+		request := httptest.NewRequest("GET", "/skus", nil)
+		request.Header.Set("Accept-Encoding", test.accept)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if encoding := recorder.Header().Get("Content-Encoding"); encoding != test.encoding {
+			t.Errorf("Expected encoding %q for %q, but got %q", test.encoding, test.accept, encoding)
+			continue
+		}
+		if recorder.Code != http.StatusOK || recorder.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Unexpected response %d %v", recorder.Code, recorder.Header())
+		}
+
+		body := recorder.Body.Bytes()
+		switch test.encoding {
+		case "gzip":
+			reader, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err = ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+		case "zstd":
+			decoder, err := zstd.NewReader(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err = decoder.DecodeAll(body, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Contains(body, []byte("MS122-32")) && !bytes.Contains(body, []byte("small")) {
+			t.Errorf("Unexpected body for %q: %.50s", test.accept, body)
+		}
+	}
+}
+
+func TestDecompressRequest(t *testing.T) {
+
+	var received []byte
+	handler := Compression(BodyLimiter(1024)(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			return err
+		}
+		received = body
+		writer.WriteHeader(http.StatusNoContent)
+		return nil
+	}))
+
+	gzipped := func(data []byte) []byte {
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		writer.Write(data)
+		writer.Close()
+		return buffer.Bytes()
+	}
+	zstded := func(data []byte) []byte {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoder.EncodeAll(data, nil)
+	}
+
+	payload := []byte(`{"data":[{"sku":"MS122-32","productList":[{"productId":"00888446671444"}]}]}`)
+	bomb := make([]byte, 1<<20)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		code     int
+	}{
+		{"gzip", "gzip", gzipped(payload), http.StatusNoContent},
+		{"zstd", "zstd", zstded(payload), http.StatusNoContent},
+		{"identity", "identity", payload, http.StatusNoContent},
+		{"gzip bomb", "gzip", gzipped(bomb), http.StatusRequestEntityTooLarge},
+		{"zstd bomb", "zstd", zstded(bomb), http.StatusRequestEntityTooLarge},
+		{"corrupt", "gzip", payload, http.StatusBadRequest},
+		{"unsupported", "br", payload, http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		received = nil
+		request := httptest.NewRequest("POST", "/skus", bytes.NewReader(test.body))
+		request.Header.Set("Content-Encoding", test.encoding)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s: expected %d, but got %d", test.name, test.code, recorder.Code)
+			continue
+		}
+		if test.code == http.StatusNoContent && !bytes.Equal(received, payload) {
+			t.Errorf("%s: expected the decompressed payload, but got %q", test.name, received)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+// Deprecation announces that routes are deprecated, and when they stop being served
+type Deprecation struct {
+	// Date is when the routes were, or will be, deprecated
+	Date time.Time
+	// Sunset is when the routes stop being served, zero when not planned yet
+	Sunset time.Time
+	// Link is the URL of the documentation about the deprecation, such as a migration guide
+	Link string
+}
+
+// NewDeprecations parses the deprecation of each API version, configured as
+// "v1": { "deprecation": "2027-01-01T00:00:00Z", "sunset": "2027-07-01T00:00:00Z", "link": "https://..." },
+// sunset and link being optional
+func NewDeprecations(config map[string]map[string]string) (map[string]Deprecation, error) {
+
+	deprecations := make(map[string]Deprecation, len(config))
+	for version, values := range config {
+		var deprecation Deprecation
+
+		date, err := time.Parse(time.RFC3339, values["deprecation"])
+		if err != nil {
+			return nil, errors.Errorf("invalid deprecation %q for API version %s", values["deprecation"], version)
+		}
+		deprecation.Date = date
+
+		if value, ok := values["sunset"]; ok {
+			sunset, err := time.Parse(time.RFC3339, value)
+			if err != nil || sunset.Before(date) {
+				return nil, errors.Errorf("invalid sunset %q for API version %s", value, version)
+			}
+			deprecation.Sunset = sunset
+		}
+
+		deprecation.Link = values["link"]
+		deprecations[version] = deprecation
+	}
+	return deprecations, nil
+}
+
+// Deprecate middleware adds the Deprecation header (RFC 9745) to the responses, along with the
+// Sunset header (RFC 8594) once a sunset is planned and a Link to the documentation if any
+func Deprecate(deprecation Deprecation) web.Middleware {
+
+	// The headers do not change, the deprecation date being announced before it is reached as well
+	value := "@" + strconv.FormatInt(deprecation.Date.Unix(), 10)
+	var sunset, link string
+	if !deprecation.Sunset.IsZero() {
+		sunset = deprecation.Sunset.UTC().Format(http.TimeFormat)
+	}
+	if deprecation.Link != "" {
+		link = "<" + deprecation.Link + `>; rel="deprecation"; type="text/html"`
+	}
+
+	return func(next web.Handler) web.Handler {
+		return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+			writer.Header().Set("Deprecation", value)
+			if sunset != "" {
+				writer.Header().Set("Sunset", sunset)
+			}
+			if link != "" {
+				writer.Header().Add("Link", link)
+			}
+
+			return next(ctx, writer, request)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewDeprecations(t *testing.T) {
+
+	deprecations, err := NewDeprecations(map[string]map[string]string{
+		"v1": {"deprecation": "2027-01-01T00:00:00Z", "sunset": "2027-07-01T00:00:00Z", "link": "https://example.com/migrate"},
+		"v2": {"deprecation": "2028-01-01T00:00:00+01:00"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := deprecations["v1"]
+	if !v1.Date.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) || !v1.Sunset.Equal(time.Date(2027, 7, 1, 0, 0, 0, 0, time.UTC)) ||
+		v1.Link != "https://example.com/migrate" {
+		t.Errorf("Unexpected deprecation of v1 %+v", v1)
+	}
+	if v2 := deprecations["v2"]; !v2.Sunset.IsZero() || v2.Link != "" {
+		t.Errorf("Expected v2 to have no sunset nor link, but got %+v", v2)
+	}
+
+	invalid := []map[string]string{
+		{"sunset": "2027-07-01T00:00:00Z"},
+		{"deprecation": "2027-01-01"},
+		{"deprecation": "2027-01-01T00:00:00Z", "sunset": "soon"},
+		{"deprecation": "2027-01-01T00:00:00Z", "sunset": "2026-07-01T00:00:00Z"},
+	}
+	for _, values := range invalid {
+		if _, err := NewDeprecations(map[string]map[string]string{"v1": values}); err == nil {
+			t.Errorf("Expected %v to be rejected", values)
+		}
+	}
+}
+
+func TestDeprecate(t *testing.T) {
+
+	deprecation := Deprecation{
+		Date:   time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		Sunset: time.Date(2027, 7, 1, 0, 0, 0, 0, time.UTC),
+		Link:   "https://example.com/migrate",
+	}
+	handler := Deprecate(deprecation)(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		writer.WriteHeader(http.StatusOK)
+		return nil
+	})
+
+	recorder := httptest.NewRecorder()
+	if err := handler(context.Background(), recorder, httptest.NewRequest("GET", "/v1/skus", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"Deprecation": "@1798761600",
+		"Sunset":      "Thu, 01 Jul 2027 00:00:00 GMT",
+		"Link":        `<https://example.com/migrate>; rel="deprecation"; type="text/html"`,
+	}
+	for header, value := range expected {
+		if actual := recorder.Header().Get(header); actual != value {
+			t.Errorf("%s expected: %s, received: %s", header, value, actual)
+		}
+	}
+
+	// Without a sunset nor a link, only the deprecation is announced
+	handler = Deprecate(Deprecation{Date: deprecation.Date})(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		return nil
+	})
+	recorder = httptest.NewRecorder()
+	if err := handler(context.Background(), recorder, httptest.NewRequest("GET", "/v1/skus", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Header().Get("Deprecation") == "" || recorder.Header().Get("Sunset") != "" || recorder.Header().Get("Link") != "" {
+		t.Errorf("Unexpected headers %v", recorder.Header())
+	}
+}
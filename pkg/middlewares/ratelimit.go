@@ -0,0 +1,242 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package middlewares
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-product-data-service/pkg/web"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// bucketExpiry is how long the bucket of a client is kept once full again
+const bucketExpiry = 10 * time.Minute
+
+// RateLimit is the number of requests a client can send per second, with bursts up to Burst requests
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// NewRateLimits parses the rate limit of each route group, configured as
+// "group": { "requestsPerSecond": 20, "burst": 40 }
+func NewRateLimits(config map[string]map[string]string) (map[string]RateLimit, error) {
+
+	limits := make(map[string]RateLimit, len(config))
+	for group, values := range config {
+		rate, err := strconv.ParseFloat(values["requestsPerSecond"], 64)
+		if err != nil || rate <= 0 {
+			return nil, errors.Errorf("invalid requestsPerSecond %q for route group %s", values["requestsPerSecond"], group)
+		}
+
+		burst := int(math.Ceil(rate))
+		if value, ok := values["burst"]; ok {
+			burst, err = strconv.Atoi(value)
+			if err != nil || burst < 1 {
+				return nil, errors.Errorf("invalid burst %q for route group %s", value, group)
+			}
+		}
+
+		limits[group] = RateLimit{RequestsPerSecond: rate, Burst: burst}
+	}
+	return limits, nil
+}
+
+// RateLimiter gives each client a token bucket, clients being identified by their API key
+// or bearer token subject when authenticated and by their IP address otherwise
+type RateLimiter struct {
+	group string
+	limit RateLimit
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates the rate limiter of a route group
+func NewRateLimiter(group string, limit RateLimit) *RateLimiter {
+	return &RateLimiter{
+		group:     group,
+		limit:     limit,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Limit middleware rejects the requests of clients that used up their bucket with a
+// 429 response, telling them when to retry. It must be wrapped by the Authenticate
+// middleware, if any, for authenticated clients to be told apart.
+func (limiter *RateLimiter) Limit(next web.Handler) web.Handler {
+	return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+		client := clientKey(ctx, request)
+		allowed, remaining, retryAfter, reset := limiter.take(client, time.Now())
+
+		writer.Header().Set("RateLimit-Limit", strconv.Itoa(limiter.limit.Burst))
+		writer.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		writer.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+
+		if !allowed {
+			tracerID := ctx.Value(web.KeyValues).(*web.ContextValues).TraceID
+			log.WithFields(log.Fields{
+				"Method":     request.Method,
+				"RequestURI": request.RequestURI,
+				"TraceID":    tracerID,
+				"Code":       http.StatusTooManyRequests,
+				"Group":      limiter.group,
+				"Client":     client,
+			}).Debug("Rate limit exceeded")
+			writer.Header().Set("Retry-After", strconv.Itoa(seconds(retryAfter)))
+			return web.TooManyRequestsError()
+		}
+
+		return next(ctx, writer, request)
+	})
+}
+
+// LimitFailures middleware rejects the requests of the IP addresses that used up their bucket
+// with requests rejected as not authenticated, so that clients sending invalid credentials
+// are limited as well. Only the rejected requests take a token, and the middleware must wrap
+// the Authenticate middleware whose rejections it counts.
+func (limiter *RateLimiter) LimitFailures(next web.Handler) web.Handler {
+	return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+		client := remoteHost(request)
+		if allowed, retryAfter := limiter.peek(client, time.Now()); !allowed {
+			tracerID := ctx.Value(web.KeyValues).(*web.ContextValues).TraceID
+			log.WithFields(log.Fields{
+				"Method":     request.Method,
+				"RequestURI": request.RequestURI,
+				"TraceID":    tracerID,
+				"Code":       http.StatusTooManyRequests,
+				"Group":      limiter.group,
+				"Client":     client,
+			}).Debug("Authentication failure limit exceeded")
+			writer.Header().Set("Retry-After", strconv.Itoa(seconds(retryAfter)))
+			return web.TooManyRequestsError()
+		}
+
+		err := next(ctx, writer, request)
+		if common, ok := errors.Cause(err).(web.CommonError); ok && common.Code == http.StatusUnauthorized {
+			limiter.take(client, time.Now())
+		}
+		return err
+	})
+}
+
+// take removes a token from the bucket of a client, returning whether there was one, the number
+// of tokens left, when the next one is available and when the bucket is full again
+func (limiter *RateLimiter) take(client string, now time.Time) (bool, int, time.Duration, time.Duration) {
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	current := limiter.refill(client, now)
+
+	allowed := current.tokens >= 1
+	if allowed {
+		current.tokens--
+	}
+
+	rate := limiter.limit.RequestsPerSecond
+	retryAfter := time.Duration(0)
+	if current.tokens < 1 {
+		retryAfter = time.Duration((1 - current.tokens) / rate * float64(time.Second))
+	}
+	reset := time.Duration((float64(limiter.limit.Burst) - current.tokens) / rate * float64(time.Second))
+
+	return allowed, int(current.tokens), retryAfter, reset
+}
+
+// peek tells whether the bucket of a client holds a token without taking it, and otherwise
+// when the next one is available
+func (limiter *RateLimiter) peek(client string, now time.Time) (bool, time.Duration) {
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	current := limiter.refill(client, now)
+	if current.tokens >= 1 {
+		return true, 0
+	}
+	return false, time.Duration((1 - current.tokens) / limiter.limit.RequestsPerSecond * float64(time.Second))
+}
+
+// refill returns the bucket of a client with the tokens earned since it was last used.
+// The limiter must be locked.
+func (limiter *RateLimiter) refill(client string, now time.Time) *bucket {
+
+	limiter.sweep(now)
+
+	burst := float64(limiter.limit.Burst)
+
+	current, ok := limiter.buckets[client]
+	if !ok {
+		current = &bucket{tokens: burst, last: now}
+		limiter.buckets[client] = current
+	}
+	current.tokens = math.Min(burst, current.tokens+now.Sub(current.last).Seconds()*limiter.limit.RequestsPerSecond)
+	current.last = now
+
+	return current
+}
+
+// sweep forgets the clients whose bucket has been full for a while, so that the buckets of
+// clients seen once do not pile up
+func (limiter *RateLimiter) sweep(now time.Time) {
+
+	if now.Sub(limiter.lastSweep) < bucketExpiry {
+		return
+	}
+	limiter.lastSweep = now
+
+	refill := time.Duration(float64(limiter.limit.Burst) / limiter.limit.RequestsPerSecond * float64(time.Second))
+	for client, current := range limiter.buckets {
+		if now.Sub(current.last) > refill+bucketExpiry {
+			delete(limiter.buckets, client)
+		}
+	}
+}
+
+// clientKey identifies the caller of a request
+func clientKey(ctx context.Context, request *http.Request) string {
+
+	// API key subjects already tell the method apart
+	if principal, ok := PrincipalFromContext(ctx); ok && principal.Subject != "" {
+		if principal.Method == JWTMethod {
+			return JWTMethod + ":" + principal.Subject
+		}
+		return principal.Subject
+	}
+
+	return remoteHost(request)
+}
+
+// remoteHost returns the IP address of the client of a request
+func remoteHost(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// seconds rounds a duration up to whole seconds, as used by the rate limit headers
+func seconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
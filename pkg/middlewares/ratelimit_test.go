@@ -0,0 +1,151 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewRateLimits(t *testing.T) {
+
+	limits, err := NewRateLimits(map[string]map[string]string{
+		"lookup": {"requestsPerSecond": "20", "burst": "40"},
+		"write":  {"requestsPerSecond": "0.5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits["lookup"] != (RateLimit{RequestsPerSecond: 20, Burst: 40}) || limits["write"] != (RateLimit{RequestsPerSecond: 0.5, Burst: 1}) {
+		t.Errorf("Unexpected rate limits %+v", limits)
+	}
+
+	invalid := []map[string]string{
+		{"burst": "10"},
+		{"requestsPerSecond": "-1"},
+		{"requestsPerSecond": "10", "burst": "0"},
+		{"requestsPerSecond": "10", "burst": "many"},
+	}
+	for _, values := range invalid {
+		if _, err := NewRateLimits(map[string]map[string]string{"lookup": values}); err == nil {
+			t.Errorf("Expected %v to be rejected", values)
+		}
+	}
+}
+
+func TestRateLimiterTake(t *testing.T) {
+
+	limiter := NewRateLimiter("lookup", RateLimit{RequestsPerSecond: 2, Burst: 3})
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		if allowed, remaining, _, _ := limiter.take("scanner", now); !allowed || remaining != i {
+			t.Errorf("Expected request to be allowed with %d remaining, but got %v, %d", i, allowed, remaining)
+		}
+	}
+
+	allowed, remaining, retryAfter, reset := limiter.take("scanner", now)
+	if allowed || remaining != 0 || retryAfter != 500*time.Millisecond || reset != 1500*time.Millisecond {
+		t.Errorf("Unexpected rejection %v, %d, %v, %v", allowed, remaining, retryAfter, reset)
+	}
+
+	// Other clients have their own bucket
+	if allowed, _, _, _ := limiter.take("erp", now); !allowed {
+		t.Error("Expected another client to be allowed")
+	}
+
+	// Tokens are added back over time
+	if allowed, _, _, _ := limiter.take("scanner", now.Add(500*time.Millisecond)); !allowed {
+		t.Error("Expected a request to be allowed once a token was added back")
+	}
+
+	// Idle clients are forgotten
+	limiter.take("erp", now.Add(2*bucketExpiry))
+	if _, ok := limiter.buckets["scanner"]; ok {
+		t.Error("Expected the bucket of an idle client to be removed")
+	}
+}
+
+func TestLimit(t *testing.T) {
+
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: []string{"first-key", "second-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewRateLimiter("lookup", RateLimit{RequestsPerSecond: 0.1, Burst: 1})
+	handler := auth.Authenticate(limiter.Limit(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		writer.WriteHeader(http.StatusOK)
+		return nil
+	}))
+
+	send := func(key string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/productid/00888446671444", nil)
+		request.Header.Set(APIKeyHeader, key)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if recorder := send("first-key"); recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Limit") != "1" ||
+		recorder.Header().Get("RateLimit-Remaining") != "0" || recorder.Header().Get("RateLimit-Reset") != "10" {
+		t.Errorf("Unexpected response %d %v", recorder.Code, recorder.Header())
+	}
+
+	recorder := send("first-key")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "10" {
+		t.Errorf("Expected a 429 response with Retry-After, but got %d %v", recorder.Code, recorder.Header())
+	}
+
+	// Clients sharing an address are told apart by their API key
+	if recorder := send("second-key"); recorder.Code != http.StatusOK {
+		t.Errorf("Expected the other API key to be allowed, but got %d", recorder.Code)
+	}
+}
+
+func TestLimitFailures(t *testing.T) {
+
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: []string{"valid-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewRateLimiter("lookup", RateLimit{RequestsPerSecond: 0.1, Burst: 1})
+	handler := limiter.LimitFailures(auth.Authenticate(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		writer.WriteHeader(http.StatusOK)
+		return nil
+	}))
+
+	send := func(key string, remoteAddr string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/productid/00888446671444", nil)
+		request.RemoteAddr = remoteAddr
+		request.Header.Set(APIKeyHeader, key)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// Authenticated requests do not use up the bucket of their address
+	for i := 0; i < 3; i++ {
+		if recorder := send("valid-key", "192.0.2.1:1234"); recorder.Code != http.StatusOK {
+			t.Fatalf("Expected %d, but got %d", http.StatusOK, recorder.Code)
+		}
+	}
+
+	if recorder := send("guessed-key", "192.0.2.1:1234"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d, but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+	recorder := send("other-guessed-key", "192.0.2.1:5678")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "10" {
+		t.Errorf("Expected a 429 response with Retry-After, but got %d %v", recorder.Code, recorder.Header())
+	}
+
+	// Other addresses are not limited
+	if recorder := send("guessed-key", "192.0.2.2:1234"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d, but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+}
@@ -0,0 +1,253 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package openapi builds OpenAPI 3 documents, deriving the schemas of the models from their Go types.
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Version is the version of the OpenAPI specification the documents follow
+const Version = "3.0.3"
+
+// Document is the root of an OpenAPI document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Tags       []Tag                            `json:"tags,omitempty"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Tag groups operations
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation describes a method of a path
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	// RequiredScope is the scope callers need to be granted to use the operation
+	RequiredScope string `json:"x-required-scope,omitempty"`
+}
+
+// Parameter describes a path, query or header parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the body of the requests
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a response of an operation
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType gives the schema of a body in a content type
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components holds the schemas and security schemes referred to by the operations
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes a way to authenticate
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Schema describes a JSON value, an empty schema allowing any value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// NewDocument creates an empty document
+func NewDocument(info Info) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]map[string]*Operation),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]SecurityScheme),
+		},
+	}
+}
+
+// AddOperation adds the operation of a method, such as GET, of a path
+func (document *Document) AddOperation(method string, path string, operation *Operation) {
+	if document.Paths[path] == nil {
+		document.Paths[path] = make(map[string]*Operation)
+	}
+	document.Paths[path][strings.ToLower(method)] = operation
+}
+
+// Operation returns the operation of a method of a path, nil when not documented
+func (document *Document) Operation(method string, path string) *Operation {
+	return document.Paths[path][strings.ToLower(method)]
+}
+
+// Schema returns the schema of the JSON encoding of model, the structs it is made of being added to the
+// component schemas under their type name and referred to. A nil model has no schema.
+func (document *Document) Schema(model interface{}) *Schema {
+	if model == nil {
+		return nil
+	}
+	return document.schemaOf(reflect.TypeOf(model))
+}
+
+func (document *Document) schemaOf(typ reflect.Type) *Schema {
+
+	switch typ {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		schema := document.schemaOf(typ.Elem())
+		// Siblings of $ref are ignored, so that references cannot be made nullable
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		// Bytes are encoded in base64
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: document.schemaOf(typ.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: document.schemaOf(typ.Elem())}
+	case reflect.Struct:
+		return document.structSchema(typ)
+	}
+
+	// Interfaces hold any value
+	return &Schema{}
+}
+
+// structSchema adds the schema of a named struct to the components and refers to it,
+// anonymous structs being described in place
+func (document *Document) structSchema(typ reflect.Type) *Schema {
+
+	name := typ.Name()
+	if name == "" {
+		return document.objectSchema(typ)
+	}
+
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if _, ok := document.Components.Schemas[name]; ok {
+		return ref
+	}
+	// Registered before being described, so that recursive types refer to themselves
+	document.Components.Schemas[name] = &Schema{}
+	document.Components.Schemas[name] = document.objectSchema(typ)
+	return ref
+}
+
+func (document *Document) objectSchema(typ reflect.Type) *Schema {
+
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	document.addProperties(schema, typ)
+	return schema
+}
+
+// addProperties adds the fields encoded by encoding/json, those of embedded structs included
+func (document *Document) addProperties(schema *Schema, typ reflect.Type) {
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				document.addProperties(schema, embedded)
+				continue
+			}
+		}
+		// Unexported fields are not encoded
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = document.schemaOf(field.Type)
+	}
+}
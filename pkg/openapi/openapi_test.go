@@ -0,0 +1,92 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type testAudit struct {
+	Created time.Time  `json:"created"`
+	Removed *time.Time `json:"removed,omitempty"`
+}
+
+type testProduct struct {
+	ProductID string                 `json:"productId"`
+	DailyTurn float64                `json:"dailyTurn"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	Payload   []byte                 `json:"payload,omitempty"`
+	Raw       json.RawMessage        `json:"raw"`
+	Ignored   string                 `json:"-"`
+	present   bool
+	testAudit
+}
+
+type testSku struct {
+	SKU         string        `json:"sku"`
+	ProductList []testProduct `json:"productList"`
+	Parent      *testSku      `json:"parent,omitempty"`
+	Count       int64         `json:"count"`
+	Ready       bool          `json:"ready"`
+	Untagged    string
+}
+
+func TestSchema(t *testing.T) {
+
+	document := NewDocument(Info{Title: "Test", Version: "1.0.0"})
+
+	ref := document.Schema([]testSku{})
+	encode := func(value interface{}) string {
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(bytes)
+	}
+
+	expected := map[string]string{
+		"schema": `{"type":"array","items":{"$ref":"#/components/schemas/testSku"}}`,
+		"testSku": `{"type":"object","properties":{"Untagged":{"type":"string"},"count":{"type":"integer","format":"int64"},` +
+			`"parent":{"$ref":"#/components/schemas/testSku"},"productList":{"type":"array","items":{"$ref":"#/components/schemas/testProduct"}},` +
+			`"ready":{"type":"boolean"},"sku":{"type":"string"}}}`,
+		"testProduct": `{"type":"object","properties":{"created":{"type":"string","format":"date-time"},"dailyTurn":{"type":"number","format":"double"},` +
+			`"metadata":{"type":"object","additionalProperties":{}},"payload":{"type":"string","format":"byte"},"productId":{"type":"string"},` +
+			`"raw":{},"removed":{"type":"string","format":"date-time","nullable":true}}}`,
+	}
+
+	actual := map[string]string{
+		"schema":      encode(ref),
+		"testSku":     encode(document.Components.Schemas["testSku"]),
+		"testProduct": encode(document.Components.Schemas["testProduct"]),
+	}
+	for name, schema := range expected {
+		if actual[name] != schema {
+			t.Errorf("Schema of %s expected: %s, received: %s", name, schema, actual[name])
+		}
+	}
+
+	if len(document.Components.Schemas) != 2 {
+		t.Errorf("Expected the embedded struct to be inlined, but got schemas %v", document.Components.Schemas)
+	}
+	if document.Schema(nil) != nil {
+		t.Error("Expected nil models to have no schema")
+	}
+}
+
+func TestOperation(t *testing.T) {
+
+	document := NewDocument(Info{Title: "Test", Version: "1.0.0"})
+	document.AddOperation("GET", "/skus/{sku}", &Operation{OperationID: "getSku"})
+
+	if operation := document.Operation("get", "/skus/{sku}"); operation == nil || operation.OperationID != "getSku" {
+		t.Errorf("Expected to find getSku, but got %+v", operation)
+	}
+	if document.Operation("DELETE", "/skus/{sku}") != nil || document.Operation("GET", "/skus") != nil {
+		t.Error("Expected no operation for undocumented methods and paths")
+	}
+}
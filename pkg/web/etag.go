@@ -0,0 +1,77 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"mime"
+	"strings"
+)
+
+// ETag returns a strong entity tag for a representation, derived from its content
+func ETag(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// RepresentationETag derives the entity tag of a representation of an entity from the entity tag
+// of the entity, so that its representations in different media types have different tags.
+// JSON representations keep the tag of the entity.
+func RepresentationETag(etag string, contentType string) string {
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == jsonMediaType || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	subtype := mediaType[strings.Index(mediaType, "/")+1:]
+	return strings.TrimSuffix(etag, `"`) + "-" + subtype + `"`
+}
+
+// EntityETagMatches tells whether an If-Match header matches the entity tag of an entity, the
+// tags of its representations in any media type matching as well
+func EntityETagMatches(header string, etag string) bool {
+
+	var tags []string
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// Entity tags are hex encoded, so that the media type starts at the first dash
+		if index := strings.Index(candidate, "-"); index > 0 && strings.HasSuffix(candidate, `"`) {
+			candidate = candidate[:index] + `"`
+		}
+		tags = append(tags, candidate)
+	}
+	return ETagMatches(strings.Join(tags, ", "), etag, false)
+}
+
+// ETagMatches tells whether an If-Match or If-None-Match header matches an entity tag.
+// If-None-Match uses the weak comparison, ignoring W/ prefixes, while If-Match requires
+// a strong match. An asterisk matches any current entity.
+func ETagMatches(header string, etag string, weak bool) bool {
+
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		} else if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
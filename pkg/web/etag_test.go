@@ -0,0 +1,117 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestETagMatches(t *testing.T) {
+
+	etag := ETag([]byte(`{"sku":"MS122-32"}`))
+	if etag != ETag([]byte(`{"sku":"MS122-32"}`)) || etag == ETag([]byte(`{"sku":"MS122-33"}`)) {
+		t.Fatalf("Expected the ETag to depend on the content only, but got %s", etag)
+	}
+
+	tests := []struct {
+		header   string
+		weak     bool
+		expected bool
+	}{
+		{etag, false, true},
+		{`"other", ` + etag, false, true},
+		{"*", false, true},
+		{`"other"`, false, false},
+		{"W/" + etag, false, false},
+		{"W/" + etag, true, true},
+		{`"other"`, true, false},
+	}
+	for _, test := range tests {
+		if matches := ETagMatches(test.header, etag, test.weak); matches != test.expected {
+			t.Errorf("Expected %v for %s (weak %v), but got %v", test.expected, test.header, test.weak, matches)
+		}
+	}
+}
+
+func TestRespondNotModified(t *testing.T) {
+
+	handler := Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		Respond(ctx, writer, map[string]string{"sku": "MS122-32"}, http.StatusOK)
+		return nil
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/skus", nil))
+	etag := recorder.Header().Get("ETag")
+	if recorder.Code != http.StatusOK || etag == "" || recorder.Body.Len() == 0 {
+		t.Fatalf("Expected a response with an ETag, but got %d %v", recorder.Code, recorder.Header())
+	}
+
+	request := httptest.NewRequest("GET", "/skus", nil)
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNotModified || recorder.Body.Len() != 0 || recorder.Header().Get("ETag") != etag {
+		t.Errorf("Expected a 304 response without body, but got %d %q", recorder.Code, recorder.Body)
+	}
+
+	// Only safe requests are answered with 304
+	request = httptest.NewRequest("POST", "/skus", nil)
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("ETag") != "" {
+		t.Errorf("Expected a 200 response without ETag, but got %d %v", recorder.Code, recorder.Header())
+	}
+}
+
+func TestRepresentationETag(t *testing.T) {
+
+	etag := ETag([]byte(`{"sku":"MS122-32"}`))
+	handler := Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		writer.Header().Set("ETag", etag)
+		Respond(ctx, writer, map[string]string{"sku": "MS122-32"}, http.StatusOK)
+		return nil
+	})
+
+	etags := map[string]string{}
+	for _, accept := range []string{jsonMediaType, xmlMediaType, csvMediaType} {
+		request := httptest.NewRequest("GET", "/skus", nil)
+		request.Header.Set("Accept", accept)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		representation := recorder.Header().Get("ETag")
+		if recorder.Code != http.StatusOK || representation == "" {
+			t.Fatalf("%s: expected a response with an ETag, but got %d %v", accept, recorder.Code, recorder.Header())
+		}
+		if other, ok := etags[representation]; ok {
+			t.Errorf("Expected different ETags for %s and %s, but got %s", accept, other, representation)
+		}
+		etags[representation] = accept
+		if !EntityETagMatches(representation, etag) || !EntityETagMatches(`"other", `+representation, etag) {
+			t.Errorf("%s: expected %s to match the entity %s", accept, representation, etag)
+		}
+	}
+	if etags[etag] != jsonMediaType {
+		t.Errorf("Expected the JSON representation to keep the ETag of the entity, but got %v", etags)
+	}
+	if EntityETagMatches(`"other-xml"`, etag) || EntityETagMatches("W/"+etag, etag) {
+		t.Errorf("Expected other and weak ETags not to match the entity %s", etag)
+	}
+
+	// The JSON ETag does not validate the XML representation
+	request := httptest.NewRequest("GET", "/skus", nil)
+	request.Header.Set("Accept", xmlMediaType)
+	request.Header.Set("If-None-Match", etag)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || recorder.Body.Len() == 0 {
+		t.Errorf("Expected the XML representation, but got %d %q", recorder.Code, recorder.Body)
+	}
+}
@@ -0,0 +1,433 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package web
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	jsonMediaType = "application/json"
+	xmlMediaType  = "application/xml"
+	csvMediaType  = "text/csv"
+
+	// xmlRoot is the element wrapping XML responses
+	xmlRoot = "response"
+	// xmlItem is the element of each array item in XML responses
+	xmlItem = "item"
+	// csvSeparator joins the values of arrays of scalars in a CSV cell
+	csvSeparator = ";"
+)
+
+// Formatter renders the data of a response in a media type
+type Formatter func(data interface{}) ([]byte, error)
+
+type registeredFormatter struct {
+	mediaType   string
+	contentType string
+	format      Formatter
+}
+
+var (
+	formattersMutex sync.RWMutex
+	// formatters are in order of preference, the first one being the default
+	formatters = []registeredFormatter{
+		{jsonMediaType, jsonMediaType, json.Marshal},
+		{xmlMediaType, xmlMediaType + "; charset=utf-8", FormatXML},
+		{"text/xml", "text/xml; charset=utf-8", FormatXML},
+		{csvMediaType, csvMediaType + "; charset=utf-8", FormatCSV},
+	}
+)
+
+// RegisterFormatter makes Respond render the responses of the clients accepting mediaType with format,
+// replacing the formatter already registered for it if any. contentType is the Content-Type header
+// of these responses, mediaType being used when it is empty.
+func RegisterFormatter(mediaType string, contentType string, format Formatter) {
+
+	mediaType = strings.ToLower(mediaType)
+	if contentType == "" {
+		contentType = mediaType
+	}
+
+	formattersMutex.Lock()
+	defer formattersMutex.Unlock()
+
+	for i, formatter := range formatters {
+		if formatter.mediaType == mediaType {
+			formatters[i] = registeredFormatter{mediaType, contentType, format}
+			return
+		}
+	}
+	formatters = append(formatters, registeredFormatter{mediaType, contentType, format})
+}
+
+// MediaTypes lists the media types the responses can be rendered in, in order of preference
+func MediaTypes() []string {
+
+	formattersMutex.RLock()
+	defer formattersMutex.RUnlock()
+
+	mediaTypes := make([]string, len(formatters))
+	for i, formatter := range formatters {
+		mediaTypes[i] = formatter.mediaType
+	}
+	return mediaTypes
+}
+
+// negotiateFormatter returns the formatter of the media type with the highest quality in an Accept
+// header, the first registered one being preferred on a tie and used when nothing matches
+func negotiateFormatter(accept string) registeredFormatter {
+
+	formattersMutex.RLock()
+	defer formattersMutex.RUnlock()
+
+	best, bestQuality := formatters[0], 0.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mediaType == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				value, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					value = 0
+				}
+				quality = value
+			}
+		}
+		if quality <= bestQuality {
+			continue
+		}
+
+		for _, formatter := range formatters {
+			if matchesMediaRange(mediaType, formatter.mediaType) {
+				best, bestQuality = formatter, quality
+				break
+			}
+		}
+	}
+	return best
+}
+
+// matchesMediaRange tells whether a media type is in a media range like text/* or */*
+func matchesMediaRange(mediaRange string, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	return strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+}
+
+// field is a member of a JSON object, whose order is kept when rendering it in other formats
+type field struct {
+	name  string
+	value interface{}
+}
+
+// object is a JSON object with its members in order
+type object []field
+
+// toGeneric converts data to the objects, arrays and scalars of its JSON representation
+func toGeneric(data interface{}) (interface{}, error) {
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	return decodeGeneric(decoder)
+}
+
+func decodeGeneric(decoder *json.Decoder) (interface{}, error) {
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		var members object
+		for decoder.More() {
+			name, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeGeneric(decoder)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, field{name.(string), value})
+		}
+		_, err = decoder.Token()
+		return members, err
+	case json.Delim('['):
+		items := []interface{}{}
+		for decoder.More() {
+			item, err := decodeGeneric(decoder)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err = decoder.Token()
+		return items, err
+	}
+	return token, nil
+}
+
+// scalarString renders a JSON scalar, null being empty
+func scalarString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	return ""
+}
+
+// FormatXML renders data as XML, objects members becoming elements named after them and
+// array items becoming item elements, all wrapped in a response element. Members whose name
+// is not a valid XML name are rendered as field elements with a name attribute.
+func FormatXML(data interface{}) ([]byte, error) {
+
+	value, err := toGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buffer)
+	if err := encodeXML(encoder, xml.StartElement{Name: xml.Name{Local: xmlRoot}}, value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func encodeXML(encoder *xml.Encoder, start xml.StartElement, value interface{}) error {
+
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case object:
+		for _, member := range value {
+			if err := encodeXML(encoder, xmlElement(member.name), member.value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := encodeXML(encoder, xml.StartElement{Name: xml.Name{Local: xmlItem}}, item); err != nil {
+				return err
+			}
+		}
+	default:
+		if text := scalarString(value); text != "" {
+			if err := encoder.EncodeToken(xml.CharData(text)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
+
+// xmlElement returns the element of an object member, named after it when it is a valid XML name
+func xmlElement(name string) xml.StartElement {
+
+	valid := name != "" && !strings.HasPrefix(strings.ToLower(name), "xml")
+	for i, char := range name {
+		letter := char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+		digit := char == '-' || char == '.' || (char >= '0' && char <= '9')
+		if !letter && (i == 0 || !digit) {
+			valid = false
+			break
+		}
+	}
+
+	if valid {
+		return xml.StartElement{Name: xml.Name{Local: name}}
+	}
+	return xml.StartElement{
+		Name: xml.Name{Local: "field"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: name}},
+	}
+}
+
+// FormatCSV renders data as CSV with a header row. The results of a response, or the items of an
+// array, are the rows. Nested objects are flattened into columns named after their path, like
+// productList.metadata.color, and arrays of objects into one row per item, repeating the values
+// of their parent. Arrays of scalars are joined in a single cell.
+func FormatCSV(data interface{}) ([]byte, error) {
+
+	value, err := toGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Results are rendered without the envelope around them
+	if members, ok := value.(object); ok {
+		for _, member := range members {
+			if member.name == "results" || member.name == "value" {
+				if items, ok := member.value.([]interface{}); ok {
+					value = items
+				}
+			}
+		}
+	}
+
+	var columns []string
+	known := map[string]bool{}
+	rows := flattenCSV(value, "", func(column string) {
+		if !known[column] {
+			known[column] = true
+			columns = append(columns, column)
+		}
+	})
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	if len(columns) > 0 {
+		if err := writer.Write(columns); err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+// flattenCSV returns the rows of a value, calling addColumn for each column in order of appearance
+func flattenCSV(value interface{}, prefix string, addColumn func(string)) []map[string]string {
+
+	switch value := value.(type) {
+	case object:
+		rows := []map[string]string{{}}
+		for _, member := range value {
+			name := member.name
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			rows = crossRows(rows, flattenCSV(member.value, name, addColumn))
+		}
+		return rows
+	case []interface{}:
+		if !hasObjects(value) {
+			cells := make([]string, len(value))
+			for i, item := range value {
+				cells[i] = scalarString(item)
+			}
+			return scalarRow(prefix, strings.Join(cells, csvSeparator), addColumn)
+		}
+		var rows []map[string]string
+		for _, item := range value {
+			rows = append(rows, flattenCSV(item, prefix, addColumn)...)
+		}
+		if len(rows) == 0 {
+			rows = []map[string]string{{}}
+		}
+		return rows
+	}
+	return scalarRow(prefix, scalarString(value), addColumn)
+}
+
+func scalarRow(column string, cell string, addColumn func(string)) []map[string]string {
+	if column == "" {
+		column = "value"
+	}
+	addColumn(column)
+	return []map[string]string{{column: cell}}
+}
+
+func hasObjects(items []interface{}) bool {
+	for _, item := range items {
+		switch item.(type) {
+		case object, []interface{}:
+			return true
+		}
+	}
+	return false
+}
+
+// crossRows combines each row with each of the rows of another member of the same object
+func crossRows(rows []map[string]string, others []map[string]string) []map[string]string {
+
+	if len(others) == 1 {
+		for _, row := range rows {
+			for column, cell := range others[0] {
+				row[column] = cell
+			}
+		}
+		return rows
+	}
+
+	combined := make([]map[string]string, 0, len(rows)*len(others))
+	for _, row := range rows {
+		for _, other := range others {
+			merged := make(map[string]string, len(row)+len(other))
+			for column, cell := range row {
+				merged[column] = cell
+			}
+			for column, cell := range other {
+				merged[column] = cell
+			}
+			combined = append(combined, merged)
+		}
+	}
+	return combined
+}
+
+// formatResponse renders data with the formatter negotiated for an Accept header, falling back to
+// JSON when it fails, and returns the Content-Type of the result
+func formatResponse(accept string, data interface{}) (string, []byte, error) {
+
+	formatter := negotiateFormatter(accept)
+	payload, err := formatter.format(data)
+	if err == nil {
+		return formatter.contentType, payload, nil
+	}
+	if formatter.mediaType == jsonMediaType {
+		return jsonMediaType, nil, err
+	}
+
+	payload, jsonErr := json.Marshal(data)
+	if jsonErr != nil {
+		return jsonMediaType, nil, jsonErr
+	}
+	return jsonMediaType, payload, errors.Wrapf(err, "unable to render %s", formatter.mediaType)
+}
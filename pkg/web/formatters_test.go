@@ -0,0 +1,167 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testProduct struct {
+	ProductID string                 `json:"productId"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type testSku struct {
+	SKU         string        `json:"sku"`
+	ProductList []testProduct `json:"productList"`
+}
+
+type testResults struct {
+	Results interface{} `json:"results"`
+}
+
+var testSkus = testResults{Results: []testSku{
+	{"MS122-32", []testProduct{
+		{"00888446671444", map[string]interface{}{"color": "blue", "size": "M"}},
+		{"889319762751", map[string]interface{}{"color": "red, dark"}},
+	}},
+	{"MS122-34", []testProduct{{"90388987132758", nil}}},
+}}
+
+func TestNegotiateFormatter(t *testing.T) {
+
+	tests := map[string]string{
+		"":                                     jsonMediaType,
+		"*/*":                                  jsonMediaType,
+		"application/xml":                      xmlMediaType,
+		"text/xml":                             "text/xml",
+		"text/csv":                             csvMediaType,
+		"text/*":                               "text/xml",
+		"text/html, application/xml;q=0.9":     xmlMediaType,
+		"text/csv;q=0.5, application/xml":      xmlMediaType,
+		"application/json, text/csv":           jsonMediaType,
+		"image/png":                            jsonMediaType,
+		"application/xml;q=0, application/pdf": jsonMediaType,
+	}
+	for accept, expected := range tests {
+		if formatter := negotiateFormatter(accept); formatter.mediaType != expected {
+			t.Errorf("Expected %s for %q, but got %s", expected, accept, formatter.mediaType)
+		}
+	}
+}
+
+func TestFormatXML(t *testing.T) {
+
+	payload, err := FormatXML(testSkus)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<response><results><item><sku>MS122-32</sku><productList>` +
+		`<item><productId>00888446671444</productId><metadata><color>blue</color><size>M</size></metadata></item>` +
+		`<item><productId>889319762751</productId><metadata><color>red, dark</color></metadata></item>` +
+		`</productList></item><item><sku>MS122-34</sku><productList>` +
+		`<item><productId>90388987132758</productId></item></productList></item></results></response>`
+	if !strings.HasSuffix(string(payload), expected) {
+		t.Errorf("Unexpected XML %s", payload)
+	}
+
+	payload, err = FormatXML(map[string]string{"2nd size": "<M>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(payload), `<field name="2nd size">&lt;M&gt;</field>`) {
+		t.Errorf("Expected an invalid name to be an attribute, but got %s", payload)
+	}
+}
+
+func TestFormatCSV(t *testing.T) {
+
+	payload, err := FormatCSV(testSkus)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "sku,productList.productId,productList.metadata.color,productList.metadata.size\n" +
+		"MS122-32,00888446671444,blue,M\n" +
+		"MS122-32,889319762751,\"red, dark\",\n" +
+		"MS122-34,90388987132758,,\n"
+	if string(payload) != expected {
+		t.Errorf("Expected CSV\n%s but got\n%s", expected, payload)
+	}
+
+	payload, err = FormatCSV(JSONError{Error: "Entity not found"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != "error\nEntity not found\n" {
+		t.Errorf("Unexpected CSV error %q", payload)
+	}
+}
+
+func TestRespondNegotiatesFormat(t *testing.T) {
+
+	handler := Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		if request.URL.Path == "/error" {
+			return NotFoundError()
+		}
+		Respond(ctx, writer, testSkus, http.StatusOK)
+		return nil
+	})
+
+	tests := []struct {
+		target      string
+		accept      string
+		contentType string
+		prefix      string
+	}{
+		{"/skus", "", "application/json", `{"results":`},
+		{"/skus", "application/xml", "application/xml; charset=utf-8", `<?xml`},
+		{"/skus", "text/csv", "text/csv; charset=utf-8", "sku,"},
+		{"/error", "text/csv", "text/csv; charset=utf-8", "error\n"},
+		{"/error", "application/xml", "application/xml; charset=utf-8", `<?xml`},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", test.target, nil)
+		request.Header.Set("Accept", test.accept)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if contentType := recorder.Header().Get("Content-Type"); contentType != test.contentType {
+			t.Errorf("Expected %s for %q, but got %s", test.contentType, test.accept, contentType)
+		}
+		if !strings.HasPrefix(recorder.Body.String(), test.prefix) {
+			t.Errorf("Unexpected body for %q: %.50s", test.accept, recorder.Body)
+		}
+		if recorder.Header().Get("Vary") != "Accept" {
+			t.Errorf("Expected the response to vary on Accept, but got %v", recorder.Header())
+		}
+	}
+}
+
+func TestRegisterFormatter(t *testing.T) {
+
+	RegisterFormatter("text/plain", "", func(data interface{}) ([]byte, error) {
+		return []byte("plain"), nil
+	})
+	defer func() {
+		formatters = formatters[:len(formatters)-1]
+	}()
+
+	if contentType, payload, err := formatResponse("text/plain", testSkus); err != nil || contentType != "text/plain" || string(payload) != "plain" {
+		t.Errorf("Expected the registered formatter to be used, but got %s %s %v", contentType, payload, err)
+	}
+
+	mediaTypes := MediaTypes()
+	if mediaTypes[0] != "application/json" || mediaTypes[len(mediaTypes)-1] != "text/plain" {
+		t.Errorf("Expected JSON to be preferred and the registered formatter to be listed, but got %v", mediaTypes)
+	}
+}
@@ -8,7 +8,6 @@ package web
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -38,6 +37,14 @@ func NotAuthorizedError() error {
 	}
 }
 
+// ForbiddenError occurs when the caller is authenticated but not allowed to make the call.
+func ForbiddenError() error {
+	return CommonError{
+		error: errors.New("Forbidden"),
+		Code:  http.StatusForbidden,
+	}
+}
+
 // InvalidIDError occurs when an ID is not in a valid form.
 func InvalidIDError() error {
 	return CommonError{
@@ -70,6 +77,54 @@ func EntityTooLargeError() error {
 	}
 }
 
+// TooManyRequestsError occurs when the caller sent more requests than allowed.
+func TooManyRequestsError() error {
+	return CommonError{
+		error: errors.New("Too many requests"),
+		Code:  http.StatusTooManyRequests,
+	}
+}
+
+// UnsupportedMediaTypeError occurs when the request body is not in the expected format.
+func UnsupportedMediaTypeError(mediaType string) error {
+	return CommonError{
+		error: errors.Errorf("Unsupported media type, expecting %s", mediaType),
+		Code:  http.StatusUnsupportedMediaType,
+	}
+}
+
+// ConflictError occurs when the request conflicts with the current state of the entity, giving a message.
+func ConflictError(msg string) error {
+	return CommonError{
+		error: errors.New(msg),
+		Code:  http.StatusConflict,
+	}
+}
+
+// PreconditionFailedError occurs when an If-Match precondition does not hold for the entity.
+func PreconditionFailedError() error {
+	return CommonError{
+		error: errors.New("Precondition failed, the entity was modified"),
+		Code:  http.StatusPreconditionFailed,
+	}
+}
+
+// QueryTimeoutError occurs when a query runs for longer than allowed.
+func QueryTimeoutError() error {
+	return CommonError{
+		error: errors.New("The query took too long, narrow it down and try again"),
+		Code:  http.StatusServiceUnavailable,
+	}
+}
+
+// UnprocessableEntityError occurs when the request is well formed but cannot be processed, giving a message.
+func UnprocessableEntityError(msg string) error {
+	return CommonError{
+		error: errors.New(msg),
+		Code:  http.StatusUnprocessableEntity,
+	}
+}
+
 func NotFoundError() error {
 	return CommonError{
 		error: errors.New("Entity not found"),
@@ -112,8 +167,11 @@ func RespondError(ctx context.Context, writer http.ResponseWriter, err error, co
 	Respond(ctx, writer, JSONError{Error: err.Error()}, code)
 }
 
-// Respond sends JSON to the client.
+// Respond sends data to the client, as JSON or in the format its Accept header prefers
+// among the registered formatters.
 // If code is StatusNoContent, v is expected to be nil.
+// Successful GET and HEAD responses carry an ETag, and are answered with
+// StatusNotModified when the request's If-None-Match header matches it.
 func Respond(ctx context.Context, writer http.ResponseWriter, data interface{}, code int) {
 
 	// Just set the status code and we are done.
@@ -125,16 +183,11 @@ func Respond(ctx context.Context, writer http.ResponseWriter, data interface{},
 		data = "Successful"
 	}
 
-	tracerID := ctx.Value(KeyValues).(*ContextValues).TraceID
-
-	// Set the content type.
-	writer.Header().Set("Content-Type", "application/json")
-
-	// Write the status code to the response
-	writer.WriteHeader(code)
+	contextValues := ctx.Value(KeyValues).(*ContextValues)
+	tracerID := contextValues.TraceID
 
-	// Marshal the response data
-	jsonData, err := json.Marshal(data)
+	// Render the response data in the format accepted by the client
+	contentType, payload, err := formatResponse(contextValues.Accept, data)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"Method":  "web.response",
@@ -142,11 +195,36 @@ func Respond(ctx context.Context, writer http.ResponseWriter, data interface{},
 			"TraceId": tracerID,
 			"Error":   err.Error(),
 		}).Error("Error Marshalling JSON response")
-		jsonData = []byte("{}")
+		if payload == nil {
+			payload = []byte("{}")
+		}
+	}
+	writer.Header().Add("Vary", "Accept")
+
+	if code == http.StatusOK && (contextValues.Method == http.MethodGet || contextValues.Method == http.MethodHead) {
+		// Handlers may have set the ETag of the underlying entity already, from which the one of
+		// the representation is derived
+		etag := writer.Header().Get("ETag")
+		if etag == "" {
+			etag = ETag(payload)
+		} else {
+			etag = RepresentationETag(etag, contentType)
+		}
+		writer.Header().Set("ETag", etag)
+		if contextValues.IfNoneMatch != "" && ETagMatches(contextValues.IfNoneMatch, etag, true) {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
 	}
 
+	// Set the content type.
+	writer.Header().Set("Content-Type", contentType)
+
+	// Write the status code to the response
+	writer.WriteHeader(code)
+
 	// Send the result back to the client.
-	_, err = writer.Write(jsonData)
+	_, err = writer.Write(payload)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"Method":  "web.response",
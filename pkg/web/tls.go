@@ -0,0 +1,166 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// TLSFiles locates the certificate of the server and the CA bundle verifying client certificates
+type TLSFiles struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, when set, makes client certificates signed by one of its CAs mandatory
+	ClientCAFile string
+}
+
+// CertReloader serves the certificate and client CAs of the files it was created with,
+// loading them again when they change so that certificates are renewed without a restart
+type CertReloader struct {
+	files TLSFiles
+
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	modified    map[string]time.Time
+}
+
+// NewCertReloader loads the certificate, key and client CA bundle
+func NewCertReloader(files TLSFiles) (*CertReloader, error) {
+
+	if files.CertFile == "" || files.KeyFile == "" {
+		return nil, errors.New("both a certificate and a key file are required")
+	}
+
+	reloader := &CertReloader{files: files}
+	if _, err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// TLSConfig returns the server configuration using the latest certificate and client CAs
+func (reloader *CertReloader) TLSConfig() *tls.Config {
+	config := baseTLSConfig()
+	config.GetCertificate = reloader.getCertificate
+	config.GetConfigForClient = reloader.configForClient
+	return config
+}
+
+// baseTLSConfig is the configuration shared by the server and the configurations returned per client.
+// The ALPN protocols are listed since http.Server only adds h2 to the server configuration, which
+// the configurations returned per client replace.
+func baseTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+}
+
+func (reloader *CertReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+	return reloader.certificate, nil
+}
+
+func (reloader *CertReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+
+	config := baseTLSConfig()
+	config.Certificates = []tls.Certificate{*reloader.certificate}
+	if reloader.clientCAs != nil {
+		config.ClientCAs = reloader.clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Reload loads the files again if any of them changed since they were last loaded, and tells
+// whether they were. The files in use are kept when the new ones are invalid.
+func (reloader *CertReloader) Reload() (bool, error) {
+
+	modified := make(map[string]time.Time)
+	changed := false
+	for _, file := range []string{reloader.files.CertFile, reloader.files.KeyFile, reloader.files.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, errors.Wrapf(err, "unable to read %s", file)
+		}
+		modified[file] = info.ModTime()
+		if !info.ModTime().Equal(reloader.modified[file]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(reloader.files.CertFile, reloader.files.KeyFile)
+	if err != nil {
+		return false, errors.Wrap(err, "invalid certificate or key")
+	}
+
+	var clientCAs *x509.CertPool
+	if reloader.files.ClientCAFile != "" {
+		bundle, err := ioutil.ReadFile(reloader.files.ClientCAFile)
+		if err != nil {
+			return false, errors.Wrap(err, "unable to read the client CA bundle")
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(bundle) {
+			return false, errors.New("no certificate found in the client CA bundle")
+		}
+	}
+
+	reloader.mutex.Lock()
+	reloader.certificate = &certificate
+	reloader.clientCAs = clientCAs
+	reloader.modified = modified
+	reloader.mutex.Unlock()
+
+	return true, nil
+}
+
+// Run checks the files every interval until the context is done
+func (reloader *CertReloader) Run(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := reloader.Reload()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"Method": "web.Run",
+					"Action": "Reload certificate",
+					"Error":  err.Error(),
+				}).Error("unable to reload the TLS certificate, keeping the current one")
+				continue
+			}
+			if reloaded {
+				log.WithField("Method", "web.Run").Info("TLS certificate reloaded")
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate generated for the tests, signed by parent or self-signed
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCert(t *testing.T, serial int64, name string, parent *testCert) *testCert {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (cert *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(cert.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (cert *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	certificate, err := tls.X509KeyPair(cert.pem, cert.keyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+func writeFile(t *testing.T, file string, content []byte, modified time.Time) {
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, 1, "Test CA", nil)
+	server := newTestCert(t, 2, "localhost", ca)
+	client := newTestCert(t, 3, "erp", ca)
+	untrusted := newTestCert(t, 4, "erp", newTestCert(t, 5, "Other CA", nil))
+
+	files := TLSFiles{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	modified := time.Now().Add(-time.Minute)
+	writeFile(t, files.CertFile, server.pem, modified)
+	writeFile(t, files.KeyFile, server.keyPEM(t), modified)
+	writeFile(t, files.ClientCAFile, ca.pem, modified)
+
+	reloader, err := NewCertReloader(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpServer := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+	httpServer.TLS = reloader.TLSConfig()
+	httpServer.StartTLS()
+	defer httpServer.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	// get returns the serial number of the server certificate
+	get := func(clientCert *testCert) (int64, error) {
+		config := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+		if clientCert != nil {
+			config.Certificates = []tls.Certificate{clientCert.tlsCertificate(t)}
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+		response, err := httpClient.Get(httpServer.URL)
+		if err != nil {
+			return 0, err
+		}
+		defer response.Body.Close()
+		return response.TLS.PeerCertificates[0].SerialNumber.Int64(), nil
+	}
+
+	if serial, err := get(client); err != nil || serial != 2 {
+		t.Errorf("Expected the server certificate 2, but got %d, %v", serial, err)
+	}
+	if _, err := get(nil); err == nil {
+		t.Error("Expected a client without certificate to be rejected")
+	}
+
+	// HTTP/2 is negotiated with the clients supporting it
+	for _, protocols := range [][]string{{"h2", "http/1.1"}, {"http/1.1"}} {
+		conn, err := tls.Dial("tcp", httpServer.Listener.Addr().String(), &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: []tls.Certificate{client.tlsCertificate(t)},
+			NextProtos:   protocols,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if negotiated := conn.ConnectionState().NegotiatedProtocol; negotiated != protocols[0] {
+			t.Errorf("Expected %s to be negotiated, but got %q", protocols[0], negotiated)
+		}
+		conn.Close()
+	}
+	if _, err := get(untrusted); err == nil {
+		t.Error("Expected a client certificate of another CA to be rejected")
+	}
+
+	// Unchanged files are not loaded again
+	if reloaded, err := reloader.Reload(); err != nil || reloaded {
+		t.Errorf("Expected no reload, but got %v, %v", reloaded, err)
+	}
+
+	// A certificate renewed halfway is ignored until its key is written
+	renewed := newTestCert(t, 6, "localhost", ca)
+	writeFile(t, files.CertFile, renewed.pem, time.Now())
+	if _, err := reloader.Reload(); err == nil {
+		t.Error("Expected a mismatched key to be rejected")
+	}
+	if serial, err := get(client); err != nil || serial != 2 {
+		t.Errorf("Expected the server certificate 2 to be kept, but got %d, %v", serial, err)
+	}
+
+	writeFile(t, files.KeyFile, renewed.keyPEM(t), time.Now())
+	if reloaded, err := reloader.Reload(); err != nil || !reloaded {
+		t.Fatalf("Expected the certificate to be reloaded, but got %v, %v", reloaded, err)
+	}
+	if serial, err := get(client); err != nil || serial != 6 {
+		t.Errorf("Expected the renewed server certificate 6, but got %d, %v", serial, err)
+	}
+}
+
+func TestCertReloaderInvalid(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert := newTestCert(t, 1, "localhost", nil)
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	writeFile(t, certFile, cert.pem, time.Now())
+	writeFile(t, keyFile, cert.keyPEM(t), time.Now())
+	writeFile(t, filepath.Join(dir, "empty.crt"), []byte("not a certificate"), time.Now())
+
+	invalid := []TLSFiles{
+		{CertFile: certFile},
+		{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.key")},
+		{CertFile: certFile, KeyFile: certFile},
+		{CertFile: certFile, KeyFile: keyFile, ClientCAFile: filepath.Join(dir, "empty.crt")},
+	}
+	for _, files := range invalid {
+		if _, err := NewCertReloader(files); err == nil {
+			t.Errorf("Expected %+v to be rejected", files)
+		}
+	}
+}
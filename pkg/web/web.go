@@ -20,9 +20,11 @@ const KeyValues ctxKey = 1
 
 // ContextValues used during log
 type ContextValues struct {
-	TraceID    string
-	Method     string
-	RequestURI string
+	TraceID     string
+	Method      string
+	RequestURI  string
+	IfNoneMatch string
+	Accept      string
 }
 
 // Handler is a type that handles a http request
@@ -35,14 +37,17 @@ type Middleware func(Handler) Handler
 // ServeHTTP interface is implemented by Handler
 func (fn Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 
-	// Create the context for the request.
-	ctx, cancel := context.WithCancel(context.Background())
+	// Create the context for the request, which is cancelled when the client disconnects so
+	// that the queries run for it are cancelled too.
+	ctx, cancel := context.WithCancel(request.Context())
 	defer cancel()
 
 	values := ContextValues{
-		TraceID:    uuid.New(),
-		Method:     request.Method,
-		RequestURI: request.RequestURI,
+		TraceID:     uuid.New(),
+		Method:      request.Method,
+		RequestURI:  request.RequestURI,
+		IfNoneMatch: request.Header.Get("If-None-Match"),
+		Accept:      request.Header.Get("Accept"),
 	}
 	ctx = context.WithValue(ctx, KeyValues, &values)
 
@@ -0,0 +1,34 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeHTTPCancelledWithRequest(t *testing.T) {
+
+	var handlerErr error
+	handler := Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		handlerErr = ctx.Err()
+		if ctx.Value(KeyValues) == nil {
+			t.Error("Expected the context values to be set")
+		}
+		return nil
+	})
+
+	requestCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := httptest.NewRequest("GET", "/skus", nil).WithContext(requestCtx)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	if handlerErr != context.Canceled {
+		t.Errorf("Expected the context of the handler to be cancelled with the request, but got %v", handlerErr)
+	}
+}